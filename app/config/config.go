@@ -3,32 +3,176 @@ package config
 import (
 	"fmt"
 	"log"
+	"os"
+	"path"
+	"regexp"
+	"time"
 
 	"github.com/ilyakaznacheev/cleanenv"
 	"github.com/joho/godotenv"
+
+	"github.com/pkarpovich/tg-relay-bot/app/templates"
 )
 
 type TelegramConfig struct {
 	Token      string  `env:"TELEGRAM_TOKEN"`
 	SuperUsers []int64 `env:"TELEGRAM_SUPER_USERS" env-separator:","`
+	Retry      RetryConfig
+	RateLimit  RateLimitConfig
+
+	DocumentFallbackChunks int `env:"TELEGRAM_DOCUMENT_FALLBACK_CHUNKS" env-default:"0"`
+}
+
+type RateLimitConfig struct {
+	Global   float64 `env:"TELEGRAM_RATE_LIMIT_GLOBAL" env-default:"30"`
+	PerChat  float64 `env:"TELEGRAM_RATE_LIMIT_PER_CHAT" env-default:"1"`
+	PerGroup float64 `env:"TELEGRAM_RATE_LIMIT_PER_GROUP" env-default:"0.33"`
+}
+
+type RetryConfig struct {
+	MaxAttempts int           `env:"TELEGRAM_RETRY_MAX_ATTEMPTS" env-default:"8"`
+	BaseDelay   time.Duration `env:"TELEGRAM_RETRY_BASE_DELAY" env-default:"2s"`
+	MaxDelay    time.Duration `env:"TELEGRAM_RETRY_MAX_DELAY" env-default:"10m"`
 }
 
 type HttpConfig struct {
-	Port         int    `env:"HTTP_PORT" env-default:"8080"`
-	SecretApiKey string `env:"HTTP_SECRET"`
+	Port         int           `env:"HTTP_PORT" env-default:"8080"`
+	SecretApiKey string        `env:"HTTP_SECRET"`
+	WaitTimeout  time.Duration `env:"HTTP_WAIT_TIMEOUT" env-default:"30s"`
+
+	IdempotencyTTL time.Duration `env:"HTTP_IDEMPOTENCY_TTL" env-default:"24h"`
+	DedupWindow    time.Duration `env:"HTTP_DEDUP_WINDOW" env-default:"0s"`
+	MaxUploadSize  int64         `env:"HTTP_MAX_UPLOAD_SIZE" env-default:"52428800"`
+
+	FetchPrivateImages bool `env:"HTTP_FETCH_PRIVATE_IMAGES"`
+
+	APIKeys []APIKeyConfig `yaml:"api_keys"`
 }
 
+// APIKeyConfig is a named key for the HTTP API. Empty Endpoints and Routes allow all
+// of them; RateLimit is in requests per minute, zero for unlimited.
+type APIKeyConfig struct {
+	Name      string    `yaml:"name"`
+	Key       string    `yaml:"key"`
+	Endpoints []string  `yaml:"endpoints"`
+	Routes    []string  `yaml:"routes"`
+	RateLimit int       `yaml:"rate_limit"`
+	ExpiresAt time.Time `yaml:"expires_at"`
+}
+
+// SuperUsersRoute stands for messages without a route in APIKeyConfig.Routes.
+const SuperUsersRoute = "@superusers"
+
+// LegacyKeyName is the name of the key configured with HTTP_SECRET.
+const LegacyKeyName = "default"
+
+var apiEndpoints = map[string]bool{"send": true, "webhook": true, "messages": true, "scheduled": true, "deadletters": true}
+
 type SmtpConfig struct {
 	AllowedHosts []string `env:"SMTP_ALLOWED_HOSTS" env-separator:","`
 	ListenAddr   string   `env:"SMTP_LISTEN_ADDR" env-default:"0.0.0.0:2525"`
+
+	ParseMode   string            `env:"SMTP_PARSE_MODE" env-default:"HTML"`
+	Layout      string            `env:"SMTP_LAYOUT" yaml:"layout"`
+	Rules       []EmailRuleConfig `yaml:"rules"`
+	Attachments AttachmentConfig
+	TLS         SmtpTLSConfig  `yaml:"tls"`
+	Auth        SmtpAuthConfig `yaml:"auth"`
+
+	MaxMessageSize int64               `env:"SMTP_MAX_MESSAGE_SIZE" env-default:"31457280" yaml:"max_message_size"`
+	Senders        SenderConfig        `yaml:"senders"`
+	RateLimit      SmtpRateLimitConfig `yaml:"rate_limit"`
+	SPF            SPFConfig           `yaml:"spf"`
+}
+
+type SenderConfig struct {
+	Allow []string `env:"SMTP_SENDER_ALLOW" env-separator:"," yaml:"allow"`
+	Deny  []string `env:"SMTP_SENDER_DENY" env-separator:"," yaml:"deny"`
+}
+
+type SmtpRateLimitConfig struct {
+	Connections int `env:"SMTP_RATE_LIMIT_CONNECTIONS" env-default:"0" yaml:"connections"`
+	Messages    int `env:"SMTP_RATE_LIMIT_MESSAGES" env-default:"0" yaml:"messages"`
+}
+
+type SPFConfig struct {
+	Enabled        bool   `env:"SMTP_SPF_CHECK" yaml:"enabled"`
+	Resolver       string `env:"SMTP_SPF_RESOLVER" yaml:"resolver"`
+	RejectSoftFail bool   `env:"SMTP_SPF_REJECT_SOFTFAIL" yaml:"reject_softfail"`
+}
+
+type SmtpTLSConfig struct {
+	CertFile string `env:"SMTP_TLS_CERT_FILE" yaml:"cert_file"`
+	KeyFile  string `env:"SMTP_TLS_KEY_FILE" yaml:"key_file"`
+	Implicit bool   `env:"SMTP_TLS_IMPLICIT" yaml:"implicit"`
+}
+
+type SmtpAuthConfig struct {
+	Required      bool             `env:"SMTP_AUTH_REQUIRED" yaml:"required"`
+	AllowInsecure bool             `env:"SMTP_AUTH_ALLOW_INSECURE" yaml:"allow_insecure"`
+	Users         []SmtpUserConfig `yaml:"users"`
+}
+
+type SmtpUserConfig struct {
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	Route    string `yaml:"route"`
+}
+
+type AttachmentConfig struct {
+	MaxSize int      `env:"SMTP_ATTACHMENT_MAX_SIZE" env-default:"20971520"`
+	Allow   []string `env:"SMTP_ATTACHMENT_ALLOW" env-separator:","`
+	Deny    []string `env:"SMTP_ATTACHMENT_DENY" env-separator:","`
+}
+
+type EmailRuleConfig struct {
+	Match    string `yaml:"match"`
+	Route    string `yaml:"route"`
+	Template string `yaml:"template"`
+}
+
+type StoreConfig struct {
+	Path        string        `env:"STORE_PATH" env-default:"relay.db"`
+	DeliveryTTL time.Duration `env:"STORE_DELIVERY_TTL" env-default:"168h"`
+}
+
+type RouteConfig struct {
+	ChatID   int64 `yaml:"chat_id"`
+	ThreadID int   `yaml:"thread_id"`
+	Silent   bool  `yaml:"silent"`
+}
+
+// WebhookConfig is a named source posting to /webhook/{name}. Requests must carry the
+// token, a valid HMAC signature of the body, or both, depending on what is set.
+// Events and Branches limit what the GitHub and GitLab receivers relay. Template
+// renders any JSON body into the message instead of expecting {"content": ...}.
+type WebhookConfig struct {
+	Route       string   `yaml:"route"`
+	Token       string   `yaml:"token"`
+	TokenHeader string   `yaml:"token_header"`
+	HMACSecret  string   `yaml:"hmac_secret"`
+	HMACHeader  string   `yaml:"hmac_header"`
+	Events      []string `yaml:"events"`
+	Branches    []string `yaml:"branches"`
+	Template    string   `yaml:"template"`
+	ParseMode   string   `yaml:"parse_mode"`
 }
 
 type Config struct {
 	Telegram TelegramConfig
 	Http     HttpConfig
 	Smtp     SmtpConfig
+	Store    StoreConfig
+	Routes   map[string]RouteConfig   `yaml:"routes"`
+	Webhooks map[string]WebhookConfig `yaml:"webhooks"`
 }
 
+var routeNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]*$`)
+
+// reservedRouteNames are top-level HTTP endpoints that take POST, so ntfy-style
+// publishing to POST /{topic} could never reach routes named after them.
+var reservedRouteNames = map[string]bool{"send": true, "message": true, "webhook": true}
+
 func Init() (*Config, error) {
 	err := godotenv.Load()
 	if err != nil {
@@ -36,9 +180,173 @@ func Init() (*Config, error) {
 	}
 
 	var cfg Config
-	if err = cleanenv.ReadEnv(&cfg); err != nil {
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		if err = cleanenv.ReadConfig(path, &cfg); err != nil {
+			return nil, fmt.Errorf("read config file %s: %w", path, err)
+		}
+	} else if err = cleanenv.ReadEnv(&cfg); err != nil {
 		return nil, fmt.Errorf("read env config: %w", err)
 	}
 
+	if err = cfg.validateRoutes(); err != nil {
+		return nil, err
+	}
+	if err = cfg.validateEmailRules(); err != nil {
+		return nil, err
+	}
+	if err = cfg.validateSmtpAuth(); err != nil {
+		return nil, err
+	}
+	if err = cfg.validateWebhooks(); err != nil {
+		return nil, err
+	}
+	if err = cfg.validateAPIKeys(); err != nil {
+		return nil, err
+	}
+
 	return &cfg, nil
 }
+
+func (c *Config) validateRoutes() error {
+	for name, route := range c.Routes {
+		if !routeNamePattern.MatchString(name) {
+			return fmt.Errorf("invalid route name %q: use lowercase letters, digits, '.', '_' and '-'", name)
+		}
+		if reservedRouteNames[name] {
+			return fmt.Errorf("invalid route name %q: it's reserved for an HTTP endpoint", name)
+		}
+		if route.ChatID == 0 {
+			return fmt.Errorf("route %q: chat_id is required", name)
+		}
+	}
+	return nil
+}
+
+func (c *Config) validateEmailRules() error {
+	switch c.Smtp.ParseMode {
+	case "", "HTML", "MarkdownV2":
+	default:
+		return fmt.Errorf("unsupported SMTP_PARSE_MODE %q", c.Smtp.ParseMode)
+	}
+
+	for i, rule := range c.Smtp.Rules {
+		if rule.Match == "" {
+			return fmt.Errorf("smtp rule %d: match is required", i+1)
+		}
+		if _, ok := c.Routes[rule.Route]; rule.Route != "" && !ok {
+			return fmt.Errorf("smtp rule %d: unknown route %q", i+1, rule.Route)
+		}
+	}
+	return nil
+}
+
+func (c *Config) validateSmtpAuth() error {
+	tls := c.Smtp.TLS
+	if (tls.CertFile == "") != (tls.KeyFile == "") {
+		return fmt.Errorf("smtp tls: both cert_file and key_file are required")
+	}
+	if tls.Implicit && tls.CertFile == "" {
+		return fmt.Errorf("smtp tls: implicit TLS needs cert_file and key_file")
+	}
+
+	auth := c.Smtp.Auth
+	if auth.Required && len(auth.Users) == 0 {
+		return fmt.Errorf("smtp auth: required is set but no users are configured")
+	}
+	if len(auth.Users) > 0 && tls.CertFile == "" && !auth.AllowInsecure {
+		return fmt.Errorf("smtp auth: configure TLS or set allow_insecure to accept passwords in plain text")
+	}
+
+	seen := make(map[string]bool, len(auth.Users))
+	for i, user := range auth.Users {
+		if user.Username == "" || user.Password == "" {
+			return fmt.Errorf("smtp user %d: username and password are required", i+1)
+		}
+		if seen[user.Username] {
+			return fmt.Errorf("smtp user %q is configured twice", user.Username)
+		}
+		seen[user.Username] = true
+		if _, ok := c.Routes[user.Route]; user.Route != "" && !ok {
+			return fmt.Errorf("smtp user %q: unknown route %q", user.Username, user.Route)
+		}
+	}
+	return nil
+}
+
+func (c *Config) validateWebhooks() error {
+	tokens := map[string]string{}
+	for name, webhook := range c.Webhooks {
+		if !routeNamePattern.MatchString(name) {
+			return fmt.Errorf("invalid webhook name %q: use lowercase letters, digits, '.', '_' and '-'", name)
+		}
+		if webhook.Token == "" && webhook.HMACSecret == "" {
+			return fmt.Errorf("webhook %q: token or hmac_secret is required", name)
+		}
+		if other, ok := tokens[webhook.Token]; ok && webhook.Token != "" {
+			return fmt.Errorf("webhooks %q and %q share a token", other, name)
+		}
+		tokens[webhook.Token] = name
+		if _, ok := c.Routes[webhook.Route]; webhook.Route != "" && !ok {
+			return fmt.Errorf("webhook %q: unknown route %q", name, webhook.Route)
+		}
+		switch webhook.ParseMode {
+		case "", "HTML", "MarkdownV2":
+		default:
+			return fmt.Errorf("webhook %q: unsupported parse_mode %q", name, webhook.ParseMode)
+		}
+		for _, branch := range webhook.Branches {
+			if _, err := path.Match(branch, ""); err != nil {
+				return fmt.Errorf("webhook %q: invalid branch pattern %q: %w", name, branch, err)
+			}
+		}
+		if webhook.Template == "" {
+			continue
+		}
+		if _, err := templates.Parse(name, webhook.Template); err != nil {
+			return fmt.Errorf("webhook %q: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func (c *Config) validateAPIKeys() error {
+	if c.Http.SecretApiKey == "" && len(c.Http.APIKeys) == 0 {
+		log.Printf("[WARN] no HTTP API keys configured, authenticated HTTP endpoints will reject every request")
+	}
+
+	names := map[string]bool{}
+	keys := map[string]bool{}
+	if c.Http.SecretApiKey != "" {
+		names[LegacyKeyName] = true
+		keys[c.Http.SecretApiKey] = true
+	}
+
+	for i, key := range c.Http.APIKeys {
+		if key.Name == "" || key.Key == "" {
+			return fmt.Errorf("api key %d: name and key are required", i+1)
+		}
+		if names[key.Name] {
+			return fmt.Errorf("api key %q is configured twice", key.Name)
+		}
+		if keys[key.Key] {
+			return fmt.Errorf("api key %q reuses the secret of another key", key.Name)
+		}
+		names[key.Name] = true
+		keys[key.Key] = true
+
+		for _, endpoint := range key.Endpoints {
+			if !apiEndpoints[endpoint] {
+				return fmt.Errorf("api key %q: unknown endpoint %q", key.Name, endpoint)
+			}
+		}
+		for _, route := range key.Routes {
+			if _, ok := c.Routes[route]; !ok && route != SuperUsersRoute {
+				return fmt.Errorf("api key %q: unknown route %q", key.Name, route)
+			}
+		}
+		if key.RateLimit < 0 {
+			return fmt.Errorf("api key %q: rate_limit must not be negative", key.Name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package events
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// attachmentsBucket keeps attachment data once per delivery, however many queue
+// entries and dead letters refer to it. Each delivery has a nested bucket with the
+// data under its blob key and a count of the entries that still hold a reference.
+var (
+	attachmentsBucket = []byte("attachments")
+	attachmentRefsKey = []byte("refs")
+)
+
+// blobKey identifies attachment data within its delivery.
+func blobKey(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// retainAttachments stores the data of new attachments for the delivery, counts one
+// more reference to it and returns the attachments without their data. Attachments
+// stored before blobs existed have no key and are kept inline.
+func retainAttachments(tx *bolt.Tx, deliveryID string, attachments []Attachment) ([]Attachment, error) {
+	if !hasBlobs(attachments) {
+		return attachments, nil
+	}
+
+	b, err := tx.Bucket(attachmentsBucket).CreateBucketIfNotExists([]byte(deliveryID))
+	if err != nil {
+		return nil, fmt.Errorf("create attachments of delivery %s: %w", deliveryID, err)
+	}
+
+	for _, a := range attachments {
+		if a.Blob == "" || a.Data == nil || b.Get([]byte(a.Blob)) != nil {
+			continue
+		}
+		if err := b.Put([]byte(a.Blob), a.Data); err != nil {
+			return nil, fmt.Errorf("store attachment %s of delivery %s: %w", a.Name, deliveryID, err)
+		}
+	}
+
+	if err := b.Put(attachmentRefsKey, itob(attachmentRefs(b)+1)); err != nil {
+		return nil, fmt.Errorf("reference attachments of delivery %s: %w", deliveryID, err)
+	}
+	return stripAttachments(attachments), nil
+}
+
+// releaseAttachments drops one reference to the delivery's attachments and deletes
+// them with the last one.
+func releaseAttachments(tx *bolt.Tx, deliveryID string, attachments []Attachment) error {
+	if !hasBlobs(attachments) {
+		return nil
+	}
+
+	parent := tx.Bucket(attachmentsBucket)
+	b := parent.Bucket([]byte(deliveryID))
+	if b == nil {
+		return nil
+	}
+
+	if refs := attachmentRefs(b); refs > 1 {
+		return b.Put(attachmentRefsKey, itob(refs-1))
+	}
+	if err := parent.DeleteBucket([]byte(deliveryID)); err != nil {
+		return fmt.Errorf("delete attachments of delivery %s: %w", deliveryID, err)
+	}
+	return nil
+}
+
+// loadAttachments returns the attachments with their data read back from the store.
+func loadAttachments(tx *bolt.Tx, deliveryID string, attachments []Attachment) ([]Attachment, error) {
+	if !hasBlobs(attachments) {
+		return attachments, nil
+	}
+
+	b := tx.Bucket(attachmentsBucket).Bucket([]byte(deliveryID))
+	if b == nil {
+		return nil, fmt.Errorf("attachments of delivery %s are missing", deliveryID)
+	}
+
+	loaded := make([]Attachment, len(attachments))
+	for i, a := range attachments {
+		if a.Blob != "" {
+			data := b.Get([]byte(a.Blob))
+			if data == nil {
+				return nil, fmt.Errorf("attachment %s of delivery %s is missing", a.Name, deliveryID)
+			}
+			a.Data = append([]byte(nil), data...)
+		}
+		loaded[i] = a
+	}
+	return loaded, nil
+}
+
+// stripAttachments drops the data of attachments that live in the store.
+func stripAttachments(attachments []Attachment) []Attachment {
+	if !hasBlobs(attachments) {
+		return attachments
+	}
+
+	stripped := make([]Attachment, len(attachments))
+	for i, a := range attachments {
+		if a.Blob != "" {
+			a.Data = nil
+		}
+		stripped[i] = a
+	}
+	return stripped
+}
+
+func hasBlobs(attachments []Attachment) bool {
+	for _, a := range attachments {
+		if a.Blob != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func attachmentRefs(b *bolt.Bucket) uint64 {
+	v := b.Get(attachmentRefsKey)
+	if len(v) != 8 {
+		return 0
+	}
+	return binary.BigEndian.Uint64(v)
+}
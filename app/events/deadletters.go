@@ -0,0 +1,212 @@
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	deadLettersBucket = []byte("dead_letters")
+
+	ErrDeadLetterNotFound = errors.New("dead letter not found")
+)
+
+type DeadLetter struct {
+	ID         uint64         `json:"id"`
+	DeliveryID string         `json:"delivery_id"`
+	ChatID     int64          `json:"chat_id"`
+	ThreadID   int            `json:"thread_id,omitempty"`
+	Silent     bool           `json:"silent,omitempty"`
+	Payload    MessagePayload `json:"payload"`
+	Attempts   int            `json:"attempts"`
+	Error      string         `json:"error"`
+	CreatedAt  time.Time      `json:"created_at"`
+	FailedAt   time.Time      `json:"failed_at"`
+}
+
+type DeadLetters struct {
+	db    *bolt.DB
+	queue *Queue
+}
+
+func NewDeadLetters(db *bolt.DB, queue *Queue) (*DeadLetters, error) {
+	err := db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(attachmentsBucket); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucketIfNotExists(deadLettersBucket)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create dead letters bucket: %w", err)
+	}
+
+	return &DeadLetters{db: db, queue: queue}, nil
+}
+
+func (d *DeadLetters) Add(queued QueuedMessage, attempts int, sendErr error) error {
+	err := d.db.Update(func(tx *bolt.Tx) error {
+		payload := queued.Payload
+		attachments, err := retainAttachments(tx, queued.DeliveryID, payload.Attachments)
+		if err != nil {
+			return err
+		}
+		payload.Attachments = attachments
+
+		return putDeadLetter(tx, DeadLetter{
+			DeliveryID: queued.DeliveryID,
+			ChatID:     queued.ChatID,
+			ThreadID:   queued.ThreadID,
+			Silent:     queued.Silent,
+			Payload:    payload,
+			Attempts:   attempts,
+			Error:      sendErr.Error(),
+			CreatedAt:  queued.CreatedAt,
+			FailedAt:   time.Now(),
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("store dead letter for message %d: %w", queued.ID, err)
+	}
+	return nil
+}
+
+func (d *DeadLetters) List() ([]DeadLetter, error) {
+	deadLetters := make([]DeadLetter, 0)
+	err := d.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(deadLettersBucket).ForEach(func(k, v []byte) error {
+			var dl DeadLetter
+			if err := json.Unmarshal(v, &dl); err != nil {
+				return fmt.Errorf("decode dead letter %x: %w", k, err)
+			}
+			deadLetters = append(deadLetters, dl)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list dead letters: %w", err)
+	}
+	return deadLetters, nil
+}
+
+func (d *DeadLetters) Get(id uint64) (DeadLetter, error) {
+	var dl DeadLetter
+	err := d.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(deadLettersBucket).Get(itob(id))
+		if v == nil {
+			return ErrDeadLetterNotFound
+		}
+		return json.Unmarshal(v, &dl)
+	})
+	if err != nil {
+		return DeadLetter{}, fmt.Errorf("get dead letter %d: %w", id, err)
+	}
+	return dl, nil
+}
+
+// Replay queues the dead letter again and deletes it in the same transaction, so it
+// can't be queued twice.
+func (d *DeadLetters) Replay(id uint64) error {
+	err := d.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(deadLettersBucket)
+		v := b.Get(itob(id))
+		if v == nil {
+			return ErrDeadLetterNotFound
+		}
+		var dl DeadLetter
+		if err := json.Unmarshal(v, &dl); err != nil {
+			return fmt.Errorf("decode dead letter: %w", err)
+		}
+
+		// queue first, so the attachments keep a reference while the dead letter lets go
+		err := d.queue.push(tx, QueuedMessage{
+			DeliveryID: dl.DeliveryID,
+			ChatID:     dl.ChatID,
+			ThreadID:   dl.ThreadID,
+			Silent:     dl.Silent,
+			Payload:    dl.Payload,
+		})
+		if err != nil {
+			return err
+		}
+		if err := releaseAttachments(tx, dl.DeliveryID, dl.Payload.Attachments); err != nil {
+			return err
+		}
+		return b.Delete(itob(id))
+	})
+	if err != nil {
+		return fmt.Errorf("replay dead letter %d: %w", id, err)
+	}
+
+	d.queue.wakeUp()
+	return nil
+}
+
+func (d *DeadLetters) Delete(id uint64) error {
+	err := d.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(deadLettersBucket)
+		v := b.Get(itob(id))
+		if v == nil {
+			return ErrDeadLetterNotFound
+		}
+		if err := releaseDeadLetter(tx, v); err != nil {
+			return err
+		}
+		return b.Delete(itob(id))
+	})
+	if err != nil {
+		return fmt.Errorf("delete dead letter %d: %w", id, err)
+	}
+	return nil
+}
+
+func (d *DeadLetters) Purge() (int, error) {
+	var n int
+	err := d.db.Update(func(tx *bolt.Tx) error {
+		c := tx.Bucket(deadLettersBucket).Cursor()
+		for k, v := c.First(); k != nil; k, v = c.First() {
+			if err := releaseDeadLetter(tx, v); err != nil {
+				return err
+			}
+			if err := c.Delete(); err != nil {
+				return err
+			}
+			n++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("purge dead letters: %w", err)
+	}
+	return n, nil
+}
+
+// putDeadLetter stores dl under the next dead-letter ID.
+func putDeadLetter(tx *bolt.Tx, dl DeadLetter) error {
+	b, err := tx.CreateBucketIfNotExists(deadLettersBucket)
+	if err != nil {
+		return err
+	}
+	if dl.ID, err = b.NextSequence(); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(dl)
+	if err != nil {
+		return fmt.Errorf("encode dead letter: %w", err)
+	}
+	return b.Put(itob(dl.ID), data)
+}
+
+// releaseDeadLetter drops the dead letter's reference to its delivery's attachments.
+func releaseDeadLetter(tx *bolt.Tx, v []byte) error {
+	var dl DeadLetter
+	if err := json.Unmarshal(v, &dl); err != nil {
+		return fmt.Errorf("decode dead letter: %w", err)
+	}
+	return releaseAttachments(tx, dl.DeliveryID, dl.Payload.Attachments)
+}
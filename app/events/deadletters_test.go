@@ -0,0 +1,96 @@
+package events
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeadLettersReplay(t *testing.T) {
+	queue := newTestQueue(t)
+	deadLetters, err := NewDeadLetters(queue.db, queue)
+	require.NoError(t, err)
+
+	queued := QueuedMessage{ID: 7, DeliveryID: "d1", ChatID: 111, Payload: MessagePayload{Text: "lost", ParseMode: "HTML"}}
+	require.NoError(t, deadLetters.Add(queued, 3, errors.New("Forbidden: bot was blocked by the user")))
+
+	stored, err := deadLetters.List()
+	require.NoError(t, err)
+	require.Len(t, stored, 1)
+	assert.Equal(t, 3, stored[0].Attempts)
+	assert.Equal(t, "Forbidden: bot was blocked by the user", stored[0].Error)
+
+	require.NoError(t, deadLetters.Replay(stored[0].ID))
+
+	msg, err := queue.Next(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, "d1", msg.DeliveryID)
+	assert.Equal(t, int64(111), msg.ChatID)
+	assert.Equal(t, queued.Payload, msg.Payload)
+	assert.Zero(t, msg.Attempts)
+
+	_, err = deadLetters.Get(stored[0].ID)
+	require.ErrorIs(t, err, ErrDeadLetterNotFound)
+}
+
+func TestDeadLettersReplayOnce(t *testing.T) {
+	queue := newTestQueue(t)
+	deadLetters, err := NewDeadLetters(queue.db, queue)
+	require.NoError(t, err)
+	require.NoError(t, deadLetters.Add(QueuedMessage{DeliveryID: "d1", ChatID: 111, Payload: MessagePayload{Text: "lost"}}, 1, errors.New("boom")))
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 2)
+	for range 2 {
+		wg.Go(func() { errs <- deadLetters.Replay(1) })
+	}
+	wg.Wait()
+	close(errs)
+
+	var replayed int
+	for err := range errs {
+		if err == nil {
+			replayed++
+			continue
+		}
+		require.ErrorIs(t, err, ErrDeadLetterNotFound)
+	}
+	assert.Equal(t, 1, replayed)
+
+	msg, err := queue.Next(t.Context())
+	require.NoError(t, err)
+	require.NoError(t, queue.Ack(msg.ID))
+	_, found, _, _, err := queue.peek(time.Now())
+	require.NoError(t, err)
+	assert.False(t, found, "the dead letter is queued once")
+}
+
+func TestDeadLettersPurge(t *testing.T) {
+	queue := newTestQueue(t)
+	deadLetters, err := NewDeadLetters(queue.db, queue)
+	require.NoError(t, err)
+
+	for range 3 {
+		require.NoError(t, deadLetters.Add(QueuedMessage{ChatID: 1}, 1, errors.New("boom")))
+	}
+
+	n, err := deadLetters.Purge()
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+
+	stored, err := deadLetters.List()
+	require.NoError(t, err)
+	assert.Empty(t, stored)
+
+	require.NoError(t, deadLetters.Add(QueuedMessage{ChatID: 1}, 1, errors.New("boom")))
+	stored, err = deadLetters.List()
+	require.NoError(t, err)
+	require.Len(t, stored, 1)
+	assert.Equal(t, uint64(4), stored[0].ID)
+
+	require.ErrorIs(t, deadLetters.Delete(1), ErrDeadLetterNotFound)
+}
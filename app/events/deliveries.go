@@ -0,0 +1,306 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+type DeliveryStatus string
+
+const (
+	StatusPending   DeliveryStatus = "pending"
+	StatusDelivered DeliveryStatus = "delivered"
+	StatusPartial   DeliveryStatus = "partial"
+	StatusFailed    DeliveryStatus = "failed"
+
+	deliveriesPruneInterval = time.Hour
+)
+
+var (
+	deliveriesBucket = []byte("deliveries")
+
+	ErrDeliveryNotFound = errors.New("delivery not found")
+)
+
+type Delivery struct {
+	ID         string            `json:"id"`
+	Route      string            `json:"route,omitempty"`
+	Status     DeliveryStatus    `json:"status"`
+	Recipients []RecipientStatus `json:"recipients"`
+	CreatedAt  time.Time         `json:"created_at"`
+	UpdatedAt  time.Time         `json:"updated_at"`
+}
+
+type RecipientStatus struct {
+	ChatID     int64          `json:"chat_id"`
+	Status     DeliveryStatus `json:"status"`
+	Parts      int            `json:"parts"`
+	MessageIDs []int          `json:"message_ids,omitempty"`
+	Attempts   int            `json:"attempts,omitempty"`
+	Error      string         `json:"error,omitempty"`
+}
+
+type Deliveries struct {
+	db       *bolt.DB
+	mu       sync.Mutex
+	watchers map[string][]chan struct{}
+}
+
+func NewDeliveries(db *bolt.DB) (*Deliveries, error) {
+	err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(deliveriesBucket)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create deliveries bucket: %w", err)
+	}
+
+	return &Deliveries{
+		db:       db,
+		watchers: make(map[string][]chan struct{}),
+	}, nil
+}
+
+func (d *Deliveries) Create(id, route string, chatIDs []int64, parts int) error {
+	err := d.db.Update(func(tx *bolt.Tx) error {
+		return d.create(tx, id, route, chatIDs, parts)
+	})
+	if err != nil {
+		return fmt.Errorf("create delivery %s: %w", id, err)
+	}
+	return nil
+}
+
+// create stores a pending delivery within tx, so it can be written together with
+// its queue entries.
+func (d *Deliveries) create(tx *bolt.Tx, id, route string, chatIDs []int64, parts int) error {
+	now := time.Now()
+	delivery := Delivery{
+		ID:         id,
+		Route:      route,
+		Recipients: make([]RecipientStatus, 0, len(chatIDs)),
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	for _, chatID := range chatIDs {
+		delivery.Recipients = append(delivery.Recipients, RecipientStatus{
+			ChatID: chatID,
+			Status: StatusPending,
+			Parts:  parts,
+		})
+	}
+	delivery.Status = delivery.aggregateStatus()
+
+	return putDelivery(tx.Bucket(deliveriesBucket), delivery)
+}
+
+func (d *Deliveries) Get(id string) (Delivery, error) {
+	var delivery Delivery
+	err := d.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(deliveriesBucket).Get([]byte(id))
+		if v == nil {
+			return ErrDeliveryNotFound
+		}
+		return json.Unmarshal(v, &delivery)
+	})
+	if err != nil {
+		return Delivery{}, fmt.Errorf("get delivery %s: %w", id, err)
+	}
+	return delivery, nil
+}
+
+func (d *Deliveries) RecordSent(id string, chatID int64, messageIDs ...int) error {
+	return d.update(id, chatID, func(r *RecipientStatus) {
+		r.Attempts++
+		r.MessageIDs = append(r.MessageIDs, messageIDs...)
+		r.Error = ""
+		if len(r.MessageIDs) >= r.Parts {
+			r.Status = StatusDelivered
+		}
+	})
+}
+
+func (d *Deliveries) RecordError(id string, chatID int64, sendErr error, final bool) error {
+	return d.update(id, chatID, func(r *RecipientStatus) {
+		r.Attempts++
+		r.Error = sendErr.Error()
+		if final {
+			r.Status = StatusFailed
+		}
+	})
+}
+
+// Wait blocks until every recipient of the delivery is either delivered or failed,
+// or until ctx is done, and returns the latest known state in both cases.
+func (d *Deliveries) Wait(ctx context.Context, id string) (Delivery, error) {
+	for {
+		ch := make(chan struct{})
+		d.mu.Lock()
+		d.watchers[id] = append(d.watchers[id], ch)
+		d.mu.Unlock()
+
+		delivery, err := d.Get(id)
+		if err != nil || delivery.Status != StatusPending {
+			d.unwatch(id, ch)
+			return delivery, err
+		}
+
+		select {
+		case <-ctx.Done():
+			d.unwatch(id, ch)
+			return delivery, fmt.Errorf("wait for delivery %s: %w", id, ctx.Err())
+		case <-ch:
+		}
+	}
+}
+
+func (d *Deliveries) Run(ctx context.Context, ttl time.Duration) {
+	ticker := time.NewTicker(deliveriesPruneInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := d.Prune(time.Now().Add(-ttl))
+			if err != nil {
+				log.Printf("[ERROR] %v", err)
+				continue
+			}
+			if n > 0 {
+				log.Printf("[INFO] Pruned %d finished deliveries", n)
+			}
+		}
+	}
+}
+
+func (d *Deliveries) Prune(before time.Time) (int, error) {
+	var n int
+	err := d.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(deliveriesBucket)
+
+		var expired [][]byte
+		err := b.ForEach(func(k, v []byte) error {
+			var delivery Delivery
+			if err := json.Unmarshal(v, &delivery); err != nil {
+				return fmt.Errorf("decode delivery %s: %w", k, err)
+			}
+			if delivery.Status != StatusPending && delivery.UpdatedAt.Before(before) {
+				expired = append(expired, append([]byte(nil), k...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, k := range expired {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+		n = len(expired)
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("prune deliveries: %w", err)
+	}
+	return n, nil
+}
+
+func (d *Deliveries) update(id string, chatID int64, fn func(r *RecipientStatus)) error {
+	err := d.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(deliveriesBucket)
+		v := b.Get([]byte(id))
+		if v == nil {
+			return ErrDeliveryNotFound
+		}
+
+		var delivery Delivery
+		if err := json.Unmarshal(v, &delivery); err != nil {
+			return fmt.Errorf("decode delivery: %w", err)
+		}
+
+		for i := range delivery.Recipients {
+			if delivery.Recipients[i].ChatID == chatID {
+				fn(&delivery.Recipients[i])
+			}
+		}
+		delivery.Status = delivery.aggregateStatus()
+		delivery.UpdatedAt = time.Now()
+
+		return putDelivery(b, delivery)
+	})
+	if err != nil {
+		return fmt.Errorf("update delivery %s for %d: %w", id, chatID, err)
+	}
+
+	d.notify(id)
+	return nil
+}
+
+func (d *Deliveries) notify(id string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, ch := range d.watchers[id] {
+		close(ch)
+	}
+	delete(d.watchers, id)
+}
+
+func (d *Deliveries) unwatch(id string, ch chan struct{}) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	watchers := d.watchers[id]
+	for i, w := range watchers {
+		if w == ch {
+			d.watchers[id] = append(watchers[:i], watchers[i+1:]...)
+			break
+		}
+	}
+	if len(d.watchers[id]) == 0 {
+		delete(d.watchers, id)
+	}
+}
+
+func (dl Delivery) aggregateStatus() DeliveryStatus {
+	var delivered, failed int
+	for _, r := range dl.Recipients {
+		switch r.Status {
+		case StatusPending:
+			return StatusPending
+		case StatusDelivered:
+			delivered++
+		case StatusFailed:
+			failed++
+		case StatusPartial:
+		}
+	}
+
+	switch {
+	case failed == 0:
+		return StatusDelivered
+	case delivered == 0:
+		return StatusFailed
+	default:
+		return StatusPartial
+	}
+}
+
+func putDelivery(b *bolt.Bucket, delivery Delivery) error {
+	data, err := json.Marshal(delivery)
+	if err != nil {
+		return fmt.Errorf("encode delivery: %w", err)
+	}
+	return b.Put([]byte(delivery.ID), data)
+}
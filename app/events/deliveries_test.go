@@ -0,0 +1,114 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeliveriesStatus(t *testing.T) {
+	tests := []struct {
+		name       string
+		record     func(d *Deliveries)
+		wantStatus DeliveryStatus
+	}{
+		{
+			name:       "nothing sent yet",
+			record:     func(d *Deliveries) {},
+			wantStatus: StatusPending,
+		},
+		{
+			name: "all parts sent to all recipients",
+			record: func(d *Deliveries) {
+				require.NoError(t, d.RecordSent("d1", 111, 1))
+				require.NoError(t, d.RecordSent("d1", 111, 2))
+				require.NoError(t, d.RecordSent("d1", 222, 3, 4))
+			},
+			wantStatus: StatusDelivered,
+		},
+		{
+			name: "one recipient still has a part in flight",
+			record: func(d *Deliveries) {
+				require.NoError(t, d.RecordSent("d1", 111, 1))
+				require.NoError(t, d.RecordSent("d1", 222, 3, 4))
+				require.NoError(t, d.RecordError("d1", 111, errors.New("timeout"), false))
+			},
+			wantStatus: StatusPending,
+		},
+		{
+			name: "one recipient failed permanently",
+			record: func(d *Deliveries) {
+				require.NoError(t, d.RecordSent("d1", 111, 1, 2))
+				require.NoError(t, d.RecordError("d1", 222, errors.New("chat not found"), true))
+			},
+			wantStatus: StatusPartial,
+		},
+		{
+			name: "every recipient failed",
+			record: func(d *Deliveries) {
+				require.NoError(t, d.RecordError("d1", 111, errors.New("chat not found"), true))
+				require.NoError(t, d.RecordError("d1", 222, errors.New("chat not found"), true))
+			},
+			wantStatus: StatusFailed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			deliveries := newTestDeliveries(t, newTestQueue(t))
+			require.NoError(t, deliveries.Create("d1", "", []int64{111, 222}, 2))
+
+			tt.record(deliveries)
+
+			delivery, err := deliveries.Get("d1")
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantStatus, delivery.Status)
+		})
+	}
+}
+
+func TestDeliveriesWait(t *testing.T) {
+	deliveries := newTestDeliveries(t, newTestQueue(t))
+	require.NoError(t, deliveries.Create("d1", "", []int64{111}, 1))
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		_ = deliveries.RecordSent("d1", 111, 42)
+	}()
+
+	delivery, err := deliveries.Wait(t.Context(), "d1")
+	require.NoError(t, err)
+	assert.Equal(t, StatusDelivered, delivery.Status)
+	assert.Equal(t, []int{42}, delivery.Recipients[0].MessageIDs)
+
+	require.NoError(t, deliveries.Create("d2", "", []int64{111}, 1))
+	ctx, cancel := context.WithTimeout(t.Context(), 20*time.Millisecond)
+	defer cancel()
+
+	delivery, err = deliveries.Wait(ctx, "d2")
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, StatusPending, delivery.Status)
+
+	_, err = deliveries.Wait(t.Context(), "missing")
+	require.ErrorIs(t, err, ErrDeliveryNotFound)
+}
+
+func TestDeliveriesPrune(t *testing.T) {
+	deliveries := newTestDeliveries(t, newTestQueue(t))
+	require.NoError(t, deliveries.Create("done", "", []int64{111}, 1))
+	require.NoError(t, deliveries.RecordSent("done", 111, 1))
+	require.NoError(t, deliveries.Create("pending", "", []int64{111}, 1))
+
+	n, err := deliveries.Prune(time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	_, err = deliveries.Get("done")
+	require.ErrorIs(t, err, ErrDeliveryNotFound)
+	_, err = deliveries.Get("pending")
+	require.NoError(t, err)
+}
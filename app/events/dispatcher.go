@@ -0,0 +1,186 @@
+package events
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var ErrUnknownRoute = errors.New("unknown route")
+
+// Route is a named destination: a chat, group or channel, optionally a forum topic in it.
+type Route struct {
+	ChatID   int64
+	ThreadID int
+	Silent   bool
+}
+
+type Dispatcher struct {
+	queue                  *Queue
+	deliveries             *Deliveries
+	superUsers             []int64
+	routes                 map[string]Route
+	documentFallbackChunks int
+}
+
+// NewDispatcher creates a dispatcher that fans payloads out to superUsers, or to the
+// named route when the payload has one. Texts that would need more than
+// documentFallbackChunks messages are sent as a .txt document instead; zero disables
+// the fallback.
+func NewDispatcher(
+	queue *Queue,
+	deliveries *Deliveries,
+	superUsers []int64,
+	routes map[string]Route,
+	documentFallbackChunks int,
+) *Dispatcher {
+	return &Dispatcher{
+		queue:                  queue,
+		deliveries:             deliveries,
+		superUsers:             superUsers,
+		routes:                 routes,
+		documentFallbackChunks: documentFallbackChunks,
+	}
+}
+
+func (d *Dispatcher) Dispatch(payload MessagePayload) (string, error) {
+	deliveryID := newDeliveryID()
+	if err := d.dispatch(deliveryID, payload); err != nil {
+		return "", err
+	}
+	return deliveryID, nil
+}
+
+func (d *Dispatcher) dispatch(deliveryID string, payload MessagePayload) error {
+	destinations, err := d.destinations(payload.Route)
+	if err != nil {
+		return err
+	}
+	// key the attachments once here rather than for every destination's copy
+	payload.Attachments = withBlobKeys(payload.Attachments)
+	parts := d.split(payload)
+	for i := range parts {
+		parts[i].Route = payload.Route
+	}
+	messageCount := 0
+	for _, part := range parts {
+		messageCount += max(1, len(part.Attachments))
+	}
+
+	chatIDs := make([]int64, 0, len(destinations))
+	messages := make([]QueuedMessage, 0, len(destinations)*len(parts))
+	for _, dest := range destinations {
+		chatIDs = append(chatIDs, dest.ChatID)
+		for _, part := range parts {
+			messages = append(messages, QueuedMessage{
+				DeliveryID: deliveryID,
+				ChatID:     dest.ChatID,
+				ThreadID:   dest.ThreadID,
+				Silent:     dest.Silent || payload.Silent,
+				Payload:    part,
+			})
+		}
+	}
+
+	// the delivery and its queue entries are written together, so a delivery never
+	// stays pending without anything left to send
+	err = d.queue.db.Update(func(tx *bolt.Tx) error {
+		if err := d.deliveries.create(tx, deliveryID, payload.Route, chatIDs, messageCount); err != nil {
+			return err
+		}
+		return d.queue.push(tx, messages...)
+	})
+	if err != nil {
+		return fmt.Errorf("enqueue delivery %s: %w", deliveryID, err)
+	}
+
+	d.queue.wakeUp()
+	return nil
+}
+
+func (d *Dispatcher) destinations(route string) ([]Route, error) {
+	if route == "" {
+		destinations := make([]Route, 0, len(d.superUsers))
+		for _, chatID := range d.superUsers {
+			destinations = append(destinations, Route{ChatID: chatID})
+		}
+		return destinations, nil
+	}
+
+	dest, ok := d.routes[route]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownRoute, route)
+	}
+	return []Route{dest}, nil
+}
+
+func (d *Dispatcher) split(payload MessagePayload) []MessagePayload {
+	groups := groupAttachments(payload.Attachments)
+	if len(groups) > 0 && textLength(payload.Text) <= MaxCaptionLength {
+		parts := make([]MessagePayload, 0, len(groups))
+		for i, group := range groups {
+			part := MessagePayload{Attachments: group}
+			if i == 0 {
+				part.Text = payload.Text
+				part.ParseMode = payload.ParseMode
+			}
+			parts = append(parts, part)
+		}
+		return parts
+	}
+
+	chunks := SplitMessage(payload.Text, payload.ParseMode, MaxMessageLength)
+	if len(chunks) == 1 && len(payload.Attachments) == 0 {
+		return []MessagePayload{payload}
+	}
+
+	if len(payload.Attachments) == 0 && d.documentFallbackChunks > 0 && len(chunks) > d.documentFallbackChunks {
+		preview := SplitMessage(payload.Text, payload.ParseMode, MaxCaptionLength)[0]
+		return []MessagePayload{{
+			Text:        preview,
+			ParseMode:   payload.ParseMode,
+			Attachments: []Attachment{{Name: "message.txt", ContentType: "text/plain", Data: []byte(payload.Text)}},
+		}}
+	}
+
+	parts := make([]MessagePayload, 0, len(chunks)+1)
+	for _, chunk := range chunks {
+		parts = append(parts, MessagePayload{Text: chunk, ParseMode: payload.ParseMode})
+	}
+	for _, group := range groups {
+		parts = append(parts, MessagePayload{Attachments: group})
+	}
+	return parts
+}
+
+// groupAttachments batches attachments into media groups of up to MaxMediaGroup files.
+// Telegram doesn't mix photos and documents in one group, so each kind is batched on its own.
+func groupAttachments(attachments []Attachment) [][]Attachment {
+	var photos, documents []Attachment
+	for _, a := range attachments {
+		if a.isPhoto() {
+			photos = append(photos, a)
+		} else {
+			documents = append(documents, a)
+		}
+	}
+
+	var groups [][]Attachment
+	for _, kind := range [][]Attachment{photos, documents} {
+		for len(kind) > 0 {
+			n := min(len(kind), MaxMediaGroup)
+			groups = append(groups, kind[:n])
+			kind = kind[n:]
+		}
+	}
+	return groups
+}
+
+func newDeliveryID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,161 @@
+package events
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDispatcherSplitsLongMessages(t *testing.T) {
+	text := strings.Repeat(strings.Repeat("x", 3000)+"\n\n", 3)
+
+	tests := []struct {
+		name          string
+		fallback      int
+		payload       MessagePayload
+		wantTexts     int
+		wantDocuments int
+	}{
+		{
+			name:      "short message is sent as is",
+			payload:   MessagePayload{Text: "hello"},
+			wantTexts: 1,
+		},
+		{
+			name:      "long message is split into chunks",
+			payload:   MessagePayload{Text: text},
+			wantTexts: 3,
+		},
+		{
+			name:      "chunks within the fallback threshold are still split",
+			fallback:  3,
+			payload:   MessagePayload{Text: text},
+			wantTexts: 3,
+		},
+		{
+			name:          "too many chunks fall back to a document",
+			fallback:      2,
+			payload:       MessagePayload{Text: text},
+			wantDocuments: 1,
+		},
+		{
+			name:          "long caption is sent before the attachment",
+			payload:       MessagePayload{Text: strings.Repeat("y", 2000), Attachments: []Attachment{{Name: "a.txt", Data: []byte("a")}}},
+			wantTexts:     1,
+			wantDocuments: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			queue := newTestQueue(t)
+			_, err := NewDispatcher(queue, newTestDeliveries(t, queue), []int64{111}, nil, tt.fallback).Dispatch(tt.payload)
+			require.NoError(t, err)
+
+			var texts, documents int
+			for range tt.wantTexts + tt.wantDocuments {
+				msg, err := queue.Next(t.Context())
+				require.NoError(t, err)
+				require.NoError(t, queue.Ack(msg.ID))
+
+				if len(msg.Payload.Attachments) > 0 {
+					documents++
+					assert.LessOrEqual(t, textLength(msg.Payload.Text), MaxCaptionLength)
+					continue
+				}
+				texts++
+				assert.LessOrEqual(t, textLength(msg.Payload.Text), MaxMessageLength)
+			}
+
+			assert.Equal(t, tt.wantTexts, texts)
+			assert.Equal(t, tt.wantDocuments, documents)
+		})
+	}
+}
+
+func TestDispatcherRoutes(t *testing.T) {
+	routes := map[string]Route{"ci": {ChatID: -100123, ThreadID: 42, Silent: true}}
+
+	tests := []struct {
+		name    string
+		route   string
+		silent  bool
+		want    []QueuedMessage
+		wantErr error
+	}{
+		{
+			name:  "no route goes to super users",
+			route: "",
+			want:  []QueuedMessage{{ChatID: 111}, {ChatID: 222}},
+		},
+		{
+			name:  "named route goes to its chat and topic",
+			route: "ci",
+			want:  []QueuedMessage{{ChatID: -100123, ThreadID: 42, Silent: true}},
+		},
+		{
+			name:   "silent payload",
+			silent: true,
+			want:   []QueuedMessage{{ChatID: 111, Silent: true}, {ChatID: 222, Silent: true}},
+		},
+		{
+			name:    "unknown route",
+			route:   "billing",
+			wantErr: ErrUnknownRoute,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			queue := newTestQueue(t)
+			dispatcher := NewDispatcher(queue, newTestDeliveries(t, queue), []int64{111, 222}, routes, 0)
+
+			_, err := dispatcher.Dispatch(MessagePayload{Text: "build passed", Route: tt.route, Silent: tt.silent})
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+
+			for _, want := range tt.want {
+				msg, err := queue.Next(t.Context())
+				require.NoError(t, err)
+				require.NoError(t, queue.Ack(msg.ID))
+				assert.Equal(t, want.ChatID, msg.ChatID)
+				assert.Equal(t, want.ThreadID, msg.ThreadID)
+				assert.Equal(t, want.Silent, msg.Silent)
+			}
+		})
+	}
+}
+
+func TestGroupAttachments(t *testing.T) {
+	photo := Attachment{Name: "a.png", ContentType: "image/png", Data: []byte("png")}
+	bigPhoto := Attachment{Name: "big.jpg", ContentType: "image/jpeg", Data: make([]byte, MaxPhotoSize+1)}
+	doc := Attachment{Name: "a.pdf", ContentType: "application/pdf", Data: []byte("pdf")}
+
+	tests := []struct {
+		name        string
+		attachments []Attachment
+		wantSizes   []int
+	}{
+		{name: "none", wantSizes: nil},
+		{name: "single document", attachments: []Attachment{doc}, wantSizes: []int{1}},
+		{name: "photos and documents are kept apart", attachments: []Attachment{doc, photo, doc, photo}, wantSizes: []int{2, 2}},
+		{name: "oversized photo is a document", attachments: []Attachment{photo, bigPhoto}, wantSizes: []int{1, 1}},
+		{name: "groups hold at most ten files", attachments: slices.Repeat([]Attachment{photo}, 12), wantSizes: []int{10, 2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sizes []int
+			for _, group := range groupAttachments(tt.attachments) {
+				sizes = append(sizes, len(group))
+			}
+			assert.Equal(t, tt.wantSizes, sizes)
+		})
+	}
+}
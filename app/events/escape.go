@@ -0,0 +1,38 @@
+package events
+
+import (
+	"strings"
+
+	tbapi "github.com/OvyFlash/telegram-bot-api"
+)
+
+var (
+	htmlEscaper       = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+	markdownV2Escaper = strings.NewReplacer(
+		"\\", "\\\\", "_", "\\_", "*", "\\*", "[", "\\[", "]", "\\]", "(", "\\(", ")", "\\)",
+		"~", "\\~", "`", "\\`", ">", "\\>", "#", "\\#", "+", "\\+", "-", "\\-", "=", "\\=",
+		"|", "\\|", "{", "\\{", "}", "\\}", ".", "\\.", "!", "\\!",
+	)
+)
+
+// EscapeHTML escapes the characters Telegram treats as markup in HTML mode.
+func EscapeHTML(s string) string {
+	return htmlEscaper.Replace(s)
+}
+
+// EscapeMarkdownV2 escapes every character that has a meaning in MarkdownV2.
+func EscapeMarkdownV2(s string) string {
+	return markdownV2Escaper.Replace(s)
+}
+
+// Escape makes plain text safe to embed into a message with the given parse mode.
+func Escape(s, parseMode string) string {
+	switch parseMode {
+	case tbapi.ModeHTML:
+		return EscapeHTML(s)
+	case tbapi.ModeMarkdownV2:
+		return EscapeMarkdownV2(s)
+	default:
+		return s
+	}
+}
@@ -0,0 +1,22 @@
+package events
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEscape(t *testing.T) {
+	tests := []struct {
+		parseMode string
+		want      string
+	}{
+		{parseMode: "", want: `a_b *c* <d> & e.f!`},
+		{parseMode: "HTML", want: `a_b *c* &lt;d&gt; &amp; e.f!`},
+		{parseMode: "MarkdownV2", want: `a\_b \*c\* <d\> & e\.f\!`},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, Escape(`a_b *c* <d> & e.f!`, tt.parseMode), tt.parseMode)
+	}
+}
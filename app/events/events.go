@@ -7,18 +7,51 @@ import (
 	"fmt"
 	"log"
 	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	tbapi "github.com/OvyFlash/telegram-bot-api"
 	"github.com/pkarpovich/tg-relay-bot/app/bot"
 )
 
 const (
-	PingCommand = "ping"
+	PingCommand        = "ping"
+	DeadLettersCommand = "deadletters"
+	ScheduledCommand   = "scheduled"
+
+	deadLettersListLimit = 10
+
+	queueErrorDelay = 10 * time.Second
 )
 
 type MessagePayload struct {
-	Text      string
-	ParseMode string
+	Text        string       `json:"text"`
+	ParseMode   string       `json:"parse_mode,omitempty"`
+	Route       string       `json:"route,omitempty"`
+	Attachments []Attachment `json:"attachments,omitempty"`
+	// Silent sends the message without a notification, even when its route doesn't.
+	Silent bool `json:"silent,omitempty"`
+}
+
+type Attachment struct {
+	Name        string `json:"name"`
+	ContentType string `json:"content_type,omitempty"`
+	Data        []byte `json:"data,omitempty"`
+	// Blob is the key of the data in the attachment store. Queue entries and dead
+	// letters keep only the key, the data is loaded back when the message is sent.
+	Blob string `json:"blob,omitempty"`
+}
+
+// isPhoto reports whether Telegram accepts the attachment as a photo. Anything else,
+// including images over the photo size limit, is sent as a document.
+func (a Attachment) isPhoto() bool {
+	switch a.ContentType {
+	case "image/jpeg", "image/png":
+		return len(a.Data) <= MaxPhotoSize
+	default:
+		return false
+	}
 }
 
 type Bot interface {
@@ -28,14 +61,20 @@ type Bot interface {
 type TbAPI interface {
 	GetUpdatesChan(config tbapi.UpdateConfig) tbapi.UpdatesChannel
 	Send(c tbapi.Chattable) (tbapi.Message, error)
+	SendMediaGroup(config tbapi.MediaGroupConfig) ([]tbapi.Message, error)
 	Request(c tbapi.Chattable) (*tbapi.APIResponse, error)
 }
 
 type TelegramListener struct {
-	SuperUsers      []int64
-	TbAPI           TbAPI
-	Bot             Bot
-	MessagesForSend chan MessagePayload
+	SuperUsers  []int64
+	TbAPI       TbAPI
+	Bot         Bot
+	Queue       *Queue
+	DeadLetters *DeadLetters
+	Deliveries  *Deliveries
+	Scheduler   *Scheduler
+	Retry       RetryPolicy
+	Limiter     *RateLimiter
 }
 
 func (tl *TelegramListener) Do(ctx context.Context) error {
@@ -93,9 +132,16 @@ func (tl *TelegramListener) processEvent(update tbapi.Update) error {
 		return nil
 	}
 
-	if update.Message.Command() == PingCommand {
+	switch update.Message.Command() {
+	case PingCommand:
 		tl.handlePingCommand(update)
 		return nil
+	case DeadLettersCommand:
+		tl.handleDeadLettersCommand(update)
+		return nil
+	case ScheduledCommand:
+		tl.handleScheduledCommand(update)
+		return nil
 	}
 
 	msg := tl.transform(update.Message)
@@ -168,22 +214,276 @@ func (tl *TelegramListener) handlePingCommand(update tbapi.Update) {
 	}
 }
 
+func (tl *TelegramListener) handleDeadLettersCommand(update tbapi.Update) {
+	text, err := tl.runDeadLettersCommand(update.Message.CommandArguments())
+	if err != nil {
+		text = "💥 Error: " + err.Error()
+	}
+
+	msg := tbapi.NewMessage(update.Message.Chat.ID, text)
+	if _, err := tl.TbAPI.Send(msg); err != nil {
+		log.Printf("[ERROR] failed to send message: %v", err)
+	}
+}
+
+func (tl *TelegramListener) runDeadLettersCommand(args string) (string, error) {
+	fields := strings.Fields(args)
+	if len(fields) == 0 {
+		deadLetters, err := tl.DeadLetters.List()
+		if err != nil {
+			return "", err
+		}
+		return formatDeadLetters(deadLetters), nil
+	}
+
+	switch fields[0] {
+	case "replay":
+		if len(fields) != 2 {
+			return "", errors.New("usage: /deadletters replay <id>")
+		}
+		id, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return "", fmt.Errorf("invalid dead letter id %q", fields[1])
+		}
+		if err := tl.DeadLetters.Replay(id); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("🔁 Dead letter %d queued for delivery", id), nil
+	case "purge":
+		n, err := tl.DeadLetters.Purge()
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("🗑 Purged %d dead letter(s)", n), nil
+	default:
+		return "", fmt.Errorf("unknown subcommand %q, use replay <id> or purge", fields[0])
+	}
+}
+
+func formatDeadLetters(deadLetters []DeadLetter) string {
+	if len(deadLetters) == 0 {
+		return "📭 No dead letters"
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "📬 %d dead letter(s)", len(deadLetters))
+	if len(deadLetters) > deadLettersListLimit {
+		fmt.Fprintf(&sb, ", showing the latest %d", deadLettersListLimit)
+		deadLetters = deadLetters[len(deadLetters)-deadLettersListLimit:]
+	}
+	sb.WriteString(":\n")
+
+	for _, dl := range deadLetters {
+		fmt.Fprintf(&sb, "\n#%d → %d, %d attempt(s), %s\n%s\n", dl.ID, dl.ChatID, dl.Attempts, dl.FailedAt.Format(time.DateTime), dl.Error)
+	}
+
+	return sb.String()
+}
+
+func (tl *TelegramListener) handleScheduledCommand(update tbapi.Update) {
+	text, err := tl.runScheduledCommand(update.Message.CommandArguments())
+	if err != nil {
+		text = "💥 Error: " + err.Error()
+	}
+
+	msg := tbapi.NewMessage(update.Message.Chat.ID, text)
+	if _, err := tl.TbAPI.Send(msg); err != nil {
+		log.Printf("[ERROR] failed to send message: %v", err)
+	}
+}
+
+func (tl *TelegramListener) runScheduledCommand(args string) (string, error) {
+	fields := strings.Fields(args)
+	if len(fields) == 0 {
+		scheduled, err := tl.Scheduler.List()
+		if err != nil {
+			return "", err
+		}
+		return formatScheduled(scheduled), nil
+	}
+
+	if fields[0] != "cancel" || len(fields) != 2 {
+		return "", errors.New("usage: /scheduled or /scheduled cancel <id>")
+	}
+	if err := tl.Scheduler.Cancel(fields[1]); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("🚫 Scheduled message %s canceled", fields[1]), nil
+}
+
+func formatScheduled(scheduled []ScheduledMessage) string {
+	if len(scheduled) == 0 {
+		return "📭 No scheduled messages"
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "⏰ %d scheduled message(s):\n", len(scheduled))
+	for _, msg := range scheduled {
+		fmt.Fprintf(&sb, "\n%s at %s\n%s\n", msg.ID, msg.SendAt.Local().Format(time.DateTime), preview(msg.Payload.Text))
+	}
+	return sb.String()
+}
+
+func preview(text string) string {
+	const maxRunes = 80
+
+	runes := []rune(strings.Join(strings.Fields(text), " "))
+	if len(runes) <= maxRunes {
+		return string(runes)
+	}
+	return string(runes[:maxRunes]) + "…"
+}
+
 func (tl *TelegramListener) SendMessagesForAdmins(ctx context.Context) {
 	for {
-		select {
-		case <-ctx.Done():
+		queued, err := tl.Queue.Next(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Printf("[ERROR] failed to read message from queue: %v", err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(queueErrorDelay):
+			}
+			continue
+		}
+
+		if wait := tl.Limiter.ReserveChat(queued.ChatID); wait > 0 {
+			tl.Queue.Throttle(queued.ChatID, time.Now().Add(wait))
+			continue
+		}
+
+		if err := tl.Limiter.Wait(ctx); err != nil {
 			return
-		case payload := <-tl.MessagesForSend:
-			for _, adminID := range tl.SuperUsers {
-				msg := tbapi.NewMessage(adminID, payload.Text)
-				msg.ParseMode = payload.ParseMode
-				_, err := tl.TbAPI.Send(msg)
-				if err != nil {
-					log.Printf("[ERROR] failed to send message: %v", err)
-				}
+		}
+
+		tl.deliver(queued)
+	}
+}
+
+func (tl *TelegramListener) deliver(queued QueuedMessage) {
+	messageIDs, err := tl.send(queued)
+	if err != nil {
+		tl.handleSendError(queued, err)
+		return
+	}
+
+	if err := tl.Deliveries.RecordSent(queued.DeliveryID, queued.ChatID, messageIDs...); err != nil {
+		log.Printf("[ERROR] %v", err)
+	}
+
+	if err := tl.Queue.Ack(queued.ID); err != nil {
+		log.Printf("[ERROR] %v", err)
+	}
+}
+
+func (tl *TelegramListener) handleSendError(queued QueuedMessage, sendErr error) {
+	attempt := queued.Attempts + 1
+
+	retry := tl.Retry.ShouldRetry(attempt, sendErr)
+	if err := tl.Deliveries.RecordError(queued.DeliveryID, queued.ChatID, sendErr, !retry); err != nil {
+		log.Printf("[ERROR] %v", err)
+	}
+
+	if !retry {
+		log.Printf("[ERROR] giving up on message %d to %d after %d attempt(s): %v", queued.ID, queued.ChatID, attempt, sendErr)
+		if err := tl.DeadLetters.Add(queued, attempt, sendErr); err != nil {
+			log.Printf("[ERROR] %v", err)
+			// keep the message out of the way until the dead-letter store can take it
+			if err := tl.Queue.Postpone(queued, time.Now().Add(tl.Retry.Delay(attempt, sendErr))); err != nil {
+				log.Printf("[ERROR] %v", err)
 			}
+			return
+		}
+		if err := tl.Queue.Ack(queued.ID); err != nil {
+			log.Printf("[ERROR] %v", err)
+		}
+		return
+	}
+
+	delay := tl.Retry.Delay(attempt, sendErr)
+	log.Printf("[WARN] failed to send message %d to %d (attempt %d), retrying in %s: %v", queued.ID, queued.ChatID, attempt, delay, sendErr)
+	if err := tl.Queue.Retry(queued, time.Now().Add(delay)); err != nil {
+		log.Printf("[ERROR] %v", err)
+	}
+}
+
+func (tl *TelegramListener) send(queued QueuedMessage) ([]int, error) {
+	if len(queued.Payload.Attachments) > 1 {
+		sent, err := tl.TbAPI.SendMediaGroup(newMediaGroup(queued))
+		if err != nil {
+			return nil, err
+		}
+		messageIDs := make([]int, 0, len(sent))
+		for _, msg := range sent {
+			messageIDs = append(messageIDs, msg.MessageID)
+		}
+		return messageIDs, nil
+	}
+
+	sent, err := tl.TbAPI.Send(newChattable(queued))
+	if err != nil {
+		return nil, err
+	}
+	return []int{sent.MessageID}, nil
+}
+
+func newChattable(queued QueuedMessage) tbapi.Chattable {
+	payload := queued.Payload
+	if len(payload.Attachments) == 0 {
+		msg := tbapi.NewMessage(queued.ChatID, payload.Text)
+		msg.ParseMode = payload.ParseMode
+		msg.MessageThreadID = queued.ThreadID
+		msg.DisableNotification = queued.Silent
+		return msg
+	}
+
+	file := payload.Attachments[0]
+	data := tbapi.FileBytes{Name: file.Name, Bytes: file.Data}
+	if file.isPhoto() {
+		photo := tbapi.NewPhoto(queued.ChatID, data)
+		photo.Caption = payload.Text
+		photo.ParseMode = payload.ParseMode
+		photo.MessageThreadID = queued.ThreadID
+		photo.DisableNotification = queued.Silent
+		return photo
+	}
+
+	doc := tbapi.NewDocument(queued.ChatID, data)
+	doc.Caption = payload.Text
+	doc.ParseMode = payload.ParseMode
+	doc.MessageThreadID = queued.ThreadID
+	doc.DisableNotification = queued.Silent
+	return doc
+}
+
+func newMediaGroup(queued QueuedMessage) tbapi.MediaGroupConfig {
+	payload := queued.Payload
+	media := make([]tbapi.InputMedia, 0, len(payload.Attachments))
+	for i, file := range payload.Attachments {
+		data := tbapi.FileBytes{Name: file.Name, Bytes: file.Data}
+		base := tbapi.NewBaseInputMedia("document", data)
+		if file.isPhoto() {
+			base.Type = "photo"
+		}
+		if i == 0 {
+			base.Caption = payload.Text
+			base.ParseMode = payload.ParseMode
+		}
+
+		if file.isPhoto() {
+			media = append(media, &tbapi.InputMediaPhoto{BaseInputMedia: base})
+		} else {
+			media = append(media, &tbapi.InputMediaDocument{BaseInputMedia: base})
 		}
 	}
+
+	group := tbapi.NewMediaGroup(queued.ChatID, media)
+	group.MessageThreadID = queued.ThreadID
+	group.DisableNotification = queued.Silent
+	return group
 }
 
 func (tl *TelegramListener) isSuperUser(userID int64) bool {
@@ -209,4 +509,3 @@ func (tl *TelegramListener) reactToMessage(chatID int64, messageID int, reaction
 
 	return nil
 }
-
@@ -1,6 +1,7 @@
 package events
 
 import (
+	"errors"
 	"fmt"
 	"sync"
 	"testing"
@@ -14,6 +15,9 @@ import (
 type mockTbAPI struct {
 	mu       sync.Mutex
 	messages []tbapi.MessageConfig
+	groups   []tbapi.MediaGroupConfig
+	sendErrs []error
+	calls    int
 }
 
 func (m *mockTbAPI) GetUpdatesChan(_ tbapi.UpdateConfig) tbapi.UpdatesChannel {
@@ -23,12 +27,32 @@ func (m *mockTbAPI) GetUpdatesChan(_ tbapi.UpdateConfig) tbapi.UpdatesChannel {
 func (m *mockTbAPI) Send(c tbapi.Chattable) (tbapi.Message, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	m.calls++
+	if len(m.sendErrs) > 0 {
+		err := m.sendErrs[0]
+		m.sendErrs = m.sendErrs[1:]
+		if err != nil {
+			return tbapi.Message{}, err
+		}
+	}
 	msg, ok := c.(tbapi.MessageConfig)
 	if !ok {
 		return tbapi.Message{}, fmt.Errorf("unexpected Chattable type: %T", c)
 	}
 	m.messages = append(m.messages, msg)
-	return tbapi.Message{}, nil
+	return tbapi.Message{MessageID: len(m.messages)}, nil
+}
+
+func (m *mockTbAPI) SendMediaGroup(config tbapi.MediaGroupConfig) ([]tbapi.Message, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls++
+	m.groups = append(m.groups, config)
+	sent := make([]tbapi.Message, 0, len(config.Media))
+	for i := range config.Media {
+		sent = append(sent, tbapi.Message{MessageID: 100*len(m.groups) + i})
+	}
+	return sent, nil
 }
 
 func (m *mockTbAPI) Request(_ tbapi.Chattable) (*tbapi.APIResponse, error) {
@@ -43,6 +67,12 @@ func (m *mockTbAPI) getMessages() []tbapi.MessageConfig {
 	return result
 }
 
+func (m *mockTbAPI) getCalls() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.calls
+}
+
 func TestSendMessagesForAdmins(t *testing.T) {
 	tests := []struct {
 		name          string
@@ -73,17 +103,20 @@ func TestSendMessagesForAdmins(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			mock := &mockTbAPI{}
-			ch := make(chan MessagePayload, 1)
+			queue := newTestQueue(t)
+			deliveries := newTestDeliveries(t, queue)
 
 			tl := &TelegramListener{
-				SuperUsers:      tt.superUsers,
-				TbAPI:           mock,
-				MessagesForSend: ch,
+				SuperUsers: tt.superUsers,
+				TbAPI:      mock,
+				Queue:      queue,
+				Deliveries: deliveries,
 			}
 
 			go tl.SendMessagesForAdmins(t.Context())
 
-			ch <- tt.payload
+			_, err := NewDispatcher(queue, deliveries, tt.superUsers, nil, 0).Dispatch(tt.payload)
+			require.NoError(t, err)
 
 			require.Eventually(t, func() bool {
 				return len(mock.getMessages()) == len(tt.superUsers)
@@ -100,3 +133,146 @@ func TestSendMessagesForAdmins(t *testing.T) {
 		})
 	}
 }
+
+func TestSendMessagesForAdminsRetries(t *testing.T) {
+	tests := []struct {
+		name            string
+		sendErrs        []error
+		wantCalls       int
+		wantSent        int
+		wantDeadLetters int
+	}{
+		{
+			name:      "transient errors are retried until success",
+			sendErrs:  []error{errors.New("connection reset"), &tbapi.Error{Code: 429}},
+			wantCalls: 3,
+			wantSent:  1,
+		},
+		{
+			name:            "permanent error is not retried",
+			sendErrs:        []error{&tbapi.Error{Code: 403, Message: "Forbidden: bot was blocked by the user"}},
+			wantCalls:       1,
+			wantSent:        0,
+			wantDeadLetters: 1,
+		},
+		{
+			name:            "gives up after max attempts",
+			sendErrs:        []error{errors.New("timeout"), errors.New("timeout"), errors.New("timeout"), errors.New("timeout")},
+			wantCalls:       3,
+			wantSent:        0,
+			wantDeadLetters: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := &mockTbAPI{sendErrs: tt.sendErrs}
+			queue := newTestQueue(t)
+			deliveries := newTestDeliveries(t, queue)
+			deadLetters, err := NewDeadLetters(queue.db, queue)
+			require.NoError(t, err)
+
+			tl := &TelegramListener{
+				TbAPI:       mock,
+				Queue:       queue,
+				DeadLetters: deadLetters,
+				Deliveries:  deliveries,
+				Retry:       RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond},
+			}
+
+			go tl.SendMessagesForAdmins(t.Context())
+
+			_, err = NewDispatcher(queue, deliveries, []int64{111}, nil, 0).Dispatch(MessagePayload{Text: "hello"})
+			require.NoError(t, err)
+
+			require.Eventually(t, func() bool {
+				return mock.getCalls() == tt.wantCalls
+			}, time.Second, 5*time.Millisecond)
+
+			time.Sleep(30 * time.Millisecond)
+			assert.Equal(t, tt.wantCalls, mock.getCalls())
+			assert.Len(t, mock.getMessages(), tt.wantSent)
+
+			stored, err := deadLetters.List()
+			require.NoError(t, err)
+			require.Len(t, stored, tt.wantDeadLetters)
+			if tt.wantDeadLetters > 0 {
+				assert.Equal(t, int64(111), stored[0].ChatID)
+				assert.Equal(t, "hello", stored[0].Payload.Text)
+				assert.NotEmpty(t, stored[0].Error)
+			}
+		})
+	}
+}
+
+func TestSendMessagesForAdminsPacesPerChat(t *testing.T) {
+	mock := &mockTbAPI{}
+	queue := newTestQueue(t)
+
+	deliveries := newTestDeliveries(t, queue)
+
+	tl := &TelegramListener{
+		TbAPI:      mock,
+		Queue:      queue,
+		Deliveries: deliveries,
+		Limiter:    NewRateLimiter(0, 10, 10),
+	}
+
+	dispatcher := NewDispatcher(queue, deliveries, []int64{111}, nil, 0)
+	for _, text := range []string{"one", "two", "three"} {
+		_, err := dispatcher.Dispatch(MessagePayload{Text: text})
+		require.NoError(t, err)
+	}
+
+	start := time.Now()
+	go tl.SendMessagesForAdmins(t.Context())
+
+	require.Eventually(t, func() bool {
+		return len(mock.getMessages()) == 3
+	}, time.Second, 5*time.Millisecond)
+
+	assert.GreaterOrEqual(t, time.Since(start), 200*time.Millisecond)
+
+	msgs := mock.getMessages()
+	assert.Equal(t, "one", msgs[0].Text)
+	assert.Equal(t, "two", msgs[1].Text)
+	assert.Equal(t, "three", msgs[2].Text)
+}
+
+func TestSendMessagesForAdminsMediaGroup(t *testing.T) {
+	mock := &mockTbAPI{}
+	queue := newTestQueue(t)
+	deliveries := newTestDeliveries(t, queue)
+
+	tl := &TelegramListener{
+		TbAPI:      mock,
+		Queue:      queue,
+		Deliveries: deliveries,
+	}
+
+	id, err := NewDispatcher(queue, deliveries, []int64{111}, nil, 0).Dispatch(MessagePayload{
+		Text: "screenshots",
+		Attachments: []Attachment{
+			{Name: "a.png", ContentType: "image/png", Data: []byte("a")},
+			{Name: "b.png", ContentType: "image/png", Data: []byte("b")},
+			{Name: "c.png", ContentType: "image/png", Data: []byte("c")},
+		},
+	})
+	require.NoError(t, err)
+
+	go tl.SendMessagesForAdmins(t.Context())
+
+	delivery, err := deliveries.Wait(t.Context(), id)
+	require.NoError(t, err)
+	assert.Equal(t, StatusDelivered, delivery.Status)
+	assert.Equal(t, []int{100, 101, 102}, delivery.Recipients[0].MessageIDs)
+
+	mock.mu.Lock()
+	groups := mock.groups
+	mock.mu.Unlock()
+	require.Len(t, groups, 1)
+	require.Len(t, groups[0].Media, 3)
+	first, ok := groups[0].Media[0].(*tbapi.InputMediaPhoto)
+	require.True(t, ok)
+	assert.Equal(t, "screenshots", first.Caption)
+}
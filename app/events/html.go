@@ -0,0 +1,233 @@
+package events
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+var telegramTags = map[atom.Atom]string{
+	atom.B:      "b",
+	atom.Strong: "b",
+	atom.I:      "i",
+	atom.Em:     "i",
+	atom.U:      "u",
+	atom.Ins:    "u",
+	atom.S:      "s",
+	atom.Strike: "s",
+	atom.Del:    "s",
+	atom.Code:   "code",
+}
+
+var linkSchemes = map[string]bool{"http": true, "https": true, "mailto": true, "tg": true}
+
+type htmlConverter struct {
+	sb       strings.Builder
+	breaks   int
+	space    bool
+	trailing int
+	pre      int
+	lists    []int
+}
+
+// ConvertHTML renders an HTML document as Telegram HTML. Supported formatting and
+// links are kept, block elements become line breaks, and every other tag and
+// attribute is dropped.
+func ConvertHTML(src string) string {
+	doc, err := html.Parse(strings.NewReader(src))
+	if err != nil {
+		return EscapeHTML(src)
+	}
+
+	c := &htmlConverter{}
+	c.walk(doc)
+	return strings.TrimSpace(c.sb.String())
+}
+
+func (c *htmlConverter) walk(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		c.text(n.Data)
+		return
+	case html.ElementNode:
+	default:
+		c.children(n)
+		return
+	}
+
+	switch n.DataAtom {
+	case atom.Head, atom.Script, atom.Style, atom.Title, atom.Template:
+	case atom.Br:
+		c.flush()
+		c.sb.WriteString("\n")
+		c.trailing++
+	case atom.Hr:
+		c.lineBreak(1)
+		c.open("———")
+		c.lineBreak(1)
+	case atom.P, atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		c.lineBreak(2)
+		if n.DataAtom == atom.P {
+			c.children(n)
+		} else {
+			c.wrap("b", n)
+		}
+		c.lineBreak(2)
+	case atom.Div, atom.Section, atom.Article, atom.Header, atom.Footer, atom.Table, atom.Tr:
+		c.lineBreak(1)
+		c.children(n)
+		c.lineBreak(1)
+	case atom.Ul, atom.Ol:
+		counter := 0
+		if n.DataAtom == atom.Ul {
+			counter = -1
+		}
+		c.lineBreak(1)
+		c.lists = append(c.lists, counter)
+		c.children(n)
+		c.lists = c.lists[:len(c.lists)-1]
+		c.lineBreak(1)
+	case atom.Li:
+		c.lineBreak(1)
+		c.open(strings.Repeat("  ", max(0, len(c.lists)-1)) + c.bullet())
+		c.children(n)
+		c.lineBreak(1)
+	case atom.Td, atom.Th:
+		c.space = c.space || n.PrevSibling != nil
+		c.children(n)
+	case atom.A:
+		href, ok := safeLink(attr(n, "href"))
+		if !ok || c.pre > 0 {
+			c.children(n)
+			return
+		}
+		c.open(`<a href="` + strings.ReplaceAll(EscapeHTML(href), `"`, "&quot;") + `">`)
+		c.children(n)
+		c.close("</a>")
+	case atom.Pre:
+		c.lineBreak(1)
+		c.wrap("pre", n)
+		c.lineBreak(1)
+	case atom.Blockquote:
+		c.lineBreak(1)
+		c.wrap("blockquote", n)
+		c.lineBreak(1)
+	default:
+		tag, ok := telegramTags[n.DataAtom]
+		if !ok || c.pre > 0 {
+			c.children(n)
+			return
+		}
+		c.wrap(tag, n)
+	}
+}
+
+func (c *htmlConverter) children(n *html.Node) {
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		c.walk(child)
+	}
+}
+
+// wrap renders the children inside tag. Telegram allows no tags inside <pre>, so
+// there only the children are rendered.
+func (c *htmlConverter) wrap(tag string, n *html.Node) {
+	if c.pre > 0 {
+		c.children(n)
+		return
+	}
+
+	c.open("<" + tag + ">")
+	if tag == "pre" {
+		c.pre++
+		defer func() { c.pre-- }()
+	}
+	c.children(n)
+	c.close("</" + tag + ">")
+}
+
+func (c *htmlConverter) text(s string) {
+	if c.pre > 0 {
+		c.open(EscapeHTML(s))
+		c.trailing = len(s) - len(strings.TrimRight(s, "\n"))
+		return
+	}
+
+	if startsWithSpace(s) {
+		c.space = true
+	}
+	if words := strings.Fields(s); len(words) > 0 {
+		c.open(EscapeHTML(strings.Join(words, " ")))
+		c.space = endsWithSpace(s)
+	}
+}
+
+// open writes s after any pending line breaks or space, so that they end up in front
+// of an opening tag rather than inside it.
+func (c *htmlConverter) open(s string) {
+	c.flush()
+	c.sb.WriteString(s)
+	c.trailing = 0
+}
+
+// close writes s right away. Pending breaks and spaces move after a closing tag.
+func (c *htmlConverter) close(s string) {
+	c.sb.WriteString(s)
+}
+
+func (c *htmlConverter) lineBreak(n int) {
+	if c.pre > 0 {
+		return
+	}
+	c.breaks = max(c.breaks, n)
+	c.space = false
+}
+
+func (c *htmlConverter) flush() {
+	switch {
+	case c.sb.Len() == 0:
+	case c.breaks > c.trailing:
+		c.sb.WriteString(strings.Repeat("\n", c.breaks-c.trailing))
+		c.trailing = c.breaks
+	case c.space && c.trailing == 0:
+		c.sb.WriteString(" ")
+	}
+	c.breaks = 0
+	c.space = false
+}
+
+func (c *htmlConverter) bullet() string {
+	top := len(c.lists) - 1
+	if top < 0 || c.lists[top] < 0 {
+		return "• "
+	}
+	c.lists[top]++
+	return strconv.Itoa(c.lists[top]) + ". "
+}
+
+func safeLink(href string) (string, bool) {
+	u, err := url.Parse(strings.TrimSpace(href))
+	if err != nil || !linkSchemes[strings.ToLower(u.Scheme)] {
+		return "", false
+	}
+	return u.String(), true
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func startsWithSpace(s string) bool {
+	return s != "" && strings.ContainsRune(" \t\r\n", rune(s[0]))
+}
+
+func endsWithSpace(s string) bool {
+	return s != "" && strings.ContainsRune(" \t\r\n", rune(s[len(s)-1]))
+}
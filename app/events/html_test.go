@@ -0,0 +1,82 @@
+package events
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConvertHTML(t *testing.T) {
+	tests := []struct {
+		name string
+		html string
+		want string
+	}{
+		{
+			name: "formatting tags are mapped",
+			html: `<p>Hello <strong>world</strong>, <em>nice</em> <u>day</u> <del>or not</del></p>`,
+			want: "Hello <b>world</b>, <i>nice</i> <u>day</u> <s>or not</s>",
+		},
+		{
+			name: "paragraphs and line breaks",
+			html: "<p>one\n   two</p><p>three<br>four<br><br>five</p><div>six</div>",
+			want: "one two\n\nthree\nfour\n\nfive\n\nsix",
+		},
+		{
+			name: "links keep only safe hrefs",
+			html: `<a href="https://example.com/?a=1&amp;b=&quot;2&quot;" style="color:red" onclick="x()">site</a> <a href="javascript:alert(1)">bad</a>`,
+			want: `<a href="https://example.com/?a=1&amp;b=&quot;2&quot;">site</a> bad`,
+		},
+		{
+			name: "unsupported tags are stripped",
+			html: `<html><head><title>t</title><style>p{}</style></head><body><span class="x">a</span> <font color="red">b</font><script>evil()</script></body></html>`,
+			want: "a b",
+		},
+		{
+			name: "lists",
+			html: `<ul><li>first</li><li>second<ol><li>nested</li></ol></li></ul>`,
+			want: "• first\n• second\n  1. nested",
+		},
+		{
+			name: "pre keeps whitespace and drops inner tags",
+			html: "<p>Log:</p><pre><code>a  &lt; b\n  <b>c</b></code></pre><p>done</p>",
+			want: "Log:\n\n<pre>a  &lt; b\n  c</pre>\n\ndone",
+		},
+		{
+			name: "headings inside pre are plain text",
+			html: "<pre>log\n<h2>Errors</h2>none</pre>",
+			want: "<pre>log\nErrorsnone</pre>",
+		},
+		{
+			name: "blockquotes inside pre are plain text",
+			html: "<pre><blockquote>quoted</blockquote></pre>",
+			want: "<pre>quoted</pre>",
+		},
+		{
+			name: "nested pre is flattened",
+			html: "<pre>outer <pre>inner</pre> tail</pre>",
+			want: "<pre>outer inner tail</pre>",
+		},
+		{
+			name: "headings and blockquotes",
+			html: `<h1>Alert</h1><blockquote>disk <i>full</i></blockquote>`,
+			want: "<b>Alert</b>\n\n<blockquote>disk <i>full</i></blockquote>",
+		},
+		{
+			name: "table cells",
+			html: `<table><tr><td>host</td><td>db1</td></tr><tr><th>load</th><th>0.9</th></tr></table>`,
+			want: "host db1\nload 0.9",
+		},
+		{
+			name: "text is escaped",
+			html: `<p>1 &lt; 2 &amp;&amp; 3 &gt; 2</p>`,
+			want: "1 &lt; 2 &amp;&amp; 3 &gt; 2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, ConvertHTML(tt.html))
+		})
+	}
+}
@@ -0,0 +1,442 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"log"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	queueBucket = []byte("queue")
+	// queueDueBucket indexes entries by NotBefore, so finding the next due message
+	// doesn't decode the ones that have to wait.
+	queueDueBucket = []byte("queue_due")
+	// queueOrderBucket indexes entries by recipient, so a part is only sent once the
+	// parts before it for the same delivery and chat are gone.
+	queueOrderBucket = []byte("queue_order")
+)
+
+type QueuedMessage struct {
+	ID         uint64         `json:"id"`
+	DeliveryID string         `json:"delivery_id"`
+	ChatID     int64          `json:"chat_id"`
+	ThreadID   int            `json:"thread_id,omitempty"`
+	Silent     bool           `json:"silent,omitempty"`
+	Payload    MessagePayload `json:"payload"`
+	Attempts   int            `json:"attempts"`
+	NotBefore  time.Time      `json:"not_before"`
+	CreatedAt  time.Time      `json:"created_at"`
+}
+
+type Queue struct {
+	db     *bolt.DB
+	notify chan struct{}
+
+	mu        sync.Mutex
+	throttled map[int64]time.Time
+}
+
+func NewQueue(db *bolt.DB) (*Queue, error) {
+	err := db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(queueBucket); err != nil {
+			return err
+		}
+		if _, err := tx.CreateBucketIfNotExists(attachmentsBucket); err != nil {
+			return err
+		}
+		if tx.Bucket(queueDueBucket) != nil {
+			return nil
+		}
+		return indexQueue(tx)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create queue bucket: %w", err)
+	}
+
+	return &Queue{
+		db:        db,
+		notify:    make(chan struct{}, 1),
+		throttled: make(map[int64]time.Time),
+	}, nil
+}
+
+// indexQueue builds the queue indexes for entries written before they existed.
+func indexQueue(tx *bolt.Tx) error {
+	if _, err := tx.CreateBucket(queueDueBucket); err != nil {
+		return err
+	}
+	if _, err := tx.CreateBucketIfNotExists(queueOrderBucket); err != nil {
+		return err
+	}
+
+	return tx.Bucket(queueBucket).ForEach(func(k, v []byte) error {
+		var msg QueuedMessage
+		if err := json.Unmarshal(v, &msg); err != nil {
+			return fmt.Errorf("decode queued message %x: %w", k, err)
+		}
+		return indexQueuedMessage(tx, msg)
+	})
+}
+
+func (q *Queue) Push(messages ...QueuedMessage) error {
+	err := q.db.Update(func(tx *bolt.Tx) error {
+		return q.push(tx, messages...)
+	})
+	if err != nil {
+		return fmt.Errorf("push to queue: %w", err)
+	}
+
+	q.wakeUp()
+	return nil
+}
+
+// push adds messages to the queue within tx. The caller wakes the queue up once tx
+// is committed.
+func (q *Queue) push(tx *bolt.Tx, messages ...QueuedMessage) error {
+	b := tx.Bucket(queueBucket)
+	for _, msg := range messages {
+		id, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		msg.ID = id
+		if msg.CreatedAt.IsZero() {
+			msg.CreatedAt = time.Now()
+		}
+		msg.Payload.Attachments, err = retainAttachments(tx, msg.DeliveryID, withBlobKeys(msg.Payload.Attachments))
+		if err != nil {
+			return err
+		}
+		if err := putQueuedMessage(tx, msg); err != nil {
+			return err
+		}
+		if err := indexQueuedMessage(tx, msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Next blocks until a message is due and returns it with its attachment data loaded.
+// Entries that can't be read are moved to dead letters on the way.
+func (q *Queue) Next(ctx context.Context) (QueuedMessage, error) {
+	for {
+		msg, found, wakeAt, broken, err := q.peek(time.Now())
+		if err != nil {
+			return QueuedMessage{}, err
+		}
+		if len(broken) > 0 {
+			err := q.discard(broken)
+			if !found {
+				if err != nil {
+					return QueuedMessage{}, err
+				}
+				// parts that waited behind a broken entry may be due now
+				continue
+			}
+			if err != nil {
+				log.Printf("[ERROR] %v", err)
+			}
+		}
+		if found {
+			return msg, nil
+		}
+
+		if err := waitUntil(ctx, wakeAt, q.notify); err != nil {
+			return QueuedMessage{}, fmt.Errorf("wait for queued message: %w", err)
+		}
+	}
+}
+
+func (q *Queue) Retry(msg QueuedMessage, at time.Time) error {
+	msg.Attempts++
+	return q.Postpone(msg, at)
+}
+
+func (q *Queue) Postpone(msg QueuedMessage, at time.Time) error {
+	err := q.db.Update(func(tx *bolt.Tx) error {
+		stored, err := getQueuedMessage(tx, msg.ID)
+		if err != nil {
+			return err
+		}
+		if err := unindexQueuedMessage(tx, stored); err != nil {
+			return err
+		}
+
+		msg.NotBefore = at
+		msg.Payload.Attachments = stripAttachments(msg.Payload.Attachments)
+		if err := putQueuedMessage(tx, msg); err != nil {
+			return err
+		}
+		return indexQueuedMessage(tx, msg)
+	})
+	if err != nil {
+		return fmt.Errorf("reschedule queued message %d: %w", msg.ID, err)
+	}
+
+	q.wakeUp()
+	return nil
+}
+
+// Throttle holds back every message for chatID until the given time. It's kept in
+// memory only, so rate-limited chats don't rewrite their queue entries on each hit.
+func (q *Queue) Throttle(chatID int64, until time.Time) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.throttled[chatID] = until
+}
+
+func (q *Queue) Ack(id uint64) error {
+	err := q.db.Update(func(tx *bolt.Tx) error {
+		msg, err := getQueuedMessage(tx, id)
+		if err != nil {
+			return err
+		}
+		if err := unindexQueuedMessage(tx, msg); err != nil {
+			return err
+		}
+		if err := releaseAttachments(tx, msg.DeliveryID, msg.Payload.Attachments); err != nil {
+			return err
+		}
+		return tx.Bucket(queueBucket).Delete(itob(id))
+	})
+	if err != nil {
+		return fmt.Errorf("ack queued message %d: %w", id, err)
+	}
+	return nil
+}
+
+// brokenEntry is a queue entry that can't be sent: its record is missing or can't be
+// decoded, or its attachment data is gone. msg is nil when there's no record to decode.
+type brokenEntry struct {
+	due       []byte
+	recipient []byte
+	msg       *QueuedMessage
+	err       error
+}
+
+// peek walks the due index in order and returns the first message that isn't waiting
+// for an earlier part to the same recipient, or when the next one becomes due. Only
+// the chosen entry is decoded; the broken entries it passes are returned to be discarded.
+func (q *Queue) peek(now time.Time) (msg QueuedMessage, found bool, wakeAt time.Time, broken []brokenEntry, err error) {
+	throttled := q.throttledChats(now)
+
+	err = q.db.View(func(tx *bolt.Tx) error {
+		order := tx.Bucket(queueOrderBucket).Cursor()
+		c := tx.Bucket(queueDueBucket).Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			if notBefore := dueTime(k); notBefore.After(now) {
+				wakeAt = earliest(wakeAt, notBefore)
+				return nil
+			}
+
+			chatID := int64(binary.BigEndian.Uint64(v))
+			if until, ok := throttled[chatID]; ok {
+				wakeAt = earliest(wakeAt, until)
+				continue
+			}
+
+			id := binary.BigEndian.Uint64(k[8:])
+			if first, _ := order.Seek(v); first == nil || !bytes.Equal(first, slices.Concat(v, itob(id))) {
+				continue
+			}
+
+			entry := brokenEntry{due: slices.Clone(k), recipient: slices.Clone(v)}
+			stored, err := getQueuedMessage(tx, id)
+			if err != nil {
+				entry.err = err
+				broken = append(broken, entry)
+				continue
+			}
+			if stored.Payload.Attachments, err = loadAttachments(tx, stored.DeliveryID, stored.Payload.Attachments); err != nil {
+				entry.msg, entry.err = &stored, err
+				broken = append(broken, entry)
+				continue
+			}
+			msg, found = stored, true
+			return nil
+		}
+		return nil
+	})
+	if err != nil {
+		return QueuedMessage{}, false, time.Time{}, nil, fmt.Errorf("read queue: %w", err)
+	}
+	return msg, found, wakeAt, broken, nil
+}
+
+// discard moves broken entries out of the queue and its indexes into dead letters, so
+// they don't hold up the rest of the queue. Their attachments are left out of the dead
+// letters, since the data may be what's missing.
+func (q *Queue) discard(broken []brokenEntry) error {
+	err := q.db.Update(func(tx *bolt.Tx) error {
+		for _, entry := range broken {
+			id := binary.BigEndian.Uint64(entry.due[8:])
+			chatID, deliveryID := parseRecipientKey(entry.recipient)
+			log.Printf("[ERROR] moving unreadable message %d to %d to dead letters: %v", id, chatID, entry.err)
+
+			if err := tx.Bucket(queueDueBucket).Delete(entry.due); err != nil {
+				return err
+			}
+			if err := tx.Bucket(queueOrderBucket).Delete(slices.Concat(entry.recipient, itob(id))); err != nil {
+				return err
+			}
+			if err := tx.Bucket(queueBucket).Delete(itob(id)); err != nil {
+				return err
+			}
+
+			dl := DeadLetter{DeliveryID: deliveryID, ChatID: chatID, Error: entry.err.Error(), FailedAt: time.Now()}
+			if entry.msg != nil {
+				if err := releaseAttachments(tx, deliveryID, entry.msg.Payload.Attachments); err != nil {
+					return err
+				}
+				dl.ThreadID, dl.Silent, dl.Attempts, dl.CreatedAt = entry.msg.ThreadID, entry.msg.Silent, entry.msg.Attempts, entry.msg.CreatedAt
+				dl.Payload = entry.msg.Payload
+				dl.Payload.Attachments = nil
+			}
+			if err := putDeadLetter(tx, dl); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("discard unreadable queued messages: %w", err)
+	}
+	return nil
+}
+
+// throttledChats returns a snapshot of the chats still held back at now and forgets
+// the ones whose time has passed.
+func (q *Queue) throttledChats(now time.Time) map[int64]time.Time {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	maps.DeleteFunc(q.throttled, func(_ int64, until time.Time) bool {
+		return !until.After(now)
+	})
+	return maps.Clone(q.throttled)
+}
+
+func (q *Queue) wakeUp() {
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+func getQueuedMessage(tx *bolt.Tx, id uint64) (QueuedMessage, error) {
+	var msg QueuedMessage
+	v := tx.Bucket(queueBucket).Get(itob(id))
+	if v == nil {
+		return msg, fmt.Errorf("queued message %d not found", id)
+	}
+	if err := json.Unmarshal(v, &msg); err != nil {
+		return msg, fmt.Errorf("decode queued message %d: %w", id, err)
+	}
+	return msg, nil
+}
+
+func putQueuedMessage(tx *bolt.Tx, msg QueuedMessage) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("encode queued message: %w", err)
+	}
+	return tx.Bucket(queueBucket).Put(itob(msg.ID), data)
+}
+
+// indexQueuedMessage adds the entry to the due index, keyed by NotBefore and ID with
+// the recipient as the value, and to the order index, keyed by recipient and ID.
+func indexQueuedMessage(tx *bolt.Tx, msg QueuedMessage) error {
+	recipient := recipientKey(msg)
+	if err := tx.Bucket(queueDueBucket).Put(dueKey(msg), recipient); err != nil {
+		return err
+	}
+	return tx.Bucket(queueOrderBucket).Put(slices.Concat(recipient, itob(msg.ID)), nil)
+}
+
+func unindexQueuedMessage(tx *bolt.Tx, msg QueuedMessage) error {
+	if err := tx.Bucket(queueDueBucket).Delete(dueKey(msg)); err != nil {
+		return err
+	}
+	return tx.Bucket(queueOrderBucket).Delete(slices.Concat(recipientKey(msg), itob(msg.ID)))
+}
+
+func dueKey(msg QueuedMessage) []byte {
+	var nanos uint64
+	if !msg.NotBefore.IsZero() && msg.NotBefore.UnixNano() > 0 {
+		nanos = uint64(msg.NotBefore.UnixNano())
+	}
+	return append(itob(nanos), itob(msg.ID)...)
+}
+
+func dueTime(key []byte) time.Time {
+	nanos := binary.BigEndian.Uint64(key[:8])
+	if nanos == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, int64(nanos))
+}
+
+// recipientKey starts with the chat ID, and length-prefixes the delivery ID so no
+// recipient's key is a prefix of another's.
+func recipientKey(msg QueuedMessage) []byte {
+	key := itob(uint64(msg.ChatID))
+	key = append(key, byte(len(msg.DeliveryID)))
+	return append(key, msg.DeliveryID...)
+}
+
+func parseRecipientKey(key []byte) (chatID int64, deliveryID string) {
+	return int64(binary.BigEndian.Uint64(key[:8])), string(key[9:])
+}
+
+// withBlobKeys keys the attachments for the attachment store. Empty files stay inline.
+func withBlobKeys(attachments []Attachment) []Attachment {
+	keyed := slices.Clone(attachments)
+	for i, a := range keyed {
+		if a.Blob == "" && len(a.Data) > 0 {
+			keyed[i].Blob = blobKey(a.Data)
+		}
+	}
+	return keyed
+}
+
+func earliest(a, b time.Time) time.Time {
+	if a.IsZero() || b.Before(a) {
+		return b
+	}
+	return a
+}
+
+func itob(id uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, id)
+	return key
+}
+
+// waitUntil blocks until wakeAt, a signal on notify or ctx cancellation. A zero
+// wakeAt waits for notify or ctx only.
+func waitUntil(ctx context.Context, wakeAt time.Time, notify <-chan struct{}) error {
+	var timer <-chan time.Time
+	if !wakeAt.IsZero() {
+		t := time.NewTimer(time.Until(wakeAt))
+		defer t.Stop()
+		timer = t.C
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-notify:
+	case <-timer:
+	}
+	return nil
+}
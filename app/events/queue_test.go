@@ -0,0 +1,304 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+)
+
+func openTestDB(t *testing.T, path string) *bolt.DB {
+	t.Helper()
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: time.Second})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+	return db
+}
+
+func newTestQueue(t *testing.T) *Queue {
+	t.Helper()
+	queue, err := NewQueue(openTestDB(t, filepath.Join(t.TempDir(), "test.db")))
+	require.NoError(t, err)
+	return queue
+}
+
+func newTestDeliveries(t *testing.T, queue *Queue) *Deliveries {
+	t.Helper()
+	deliveries, err := NewDeliveries(queue.db)
+	require.NoError(t, err)
+	return deliveries
+}
+
+func TestQueueSurvivesReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+
+	db := openTestDB(t, path)
+	queue, err := NewQueue(db)
+	require.NoError(t, err)
+	require.NoError(t, queue.Push(
+		QueuedMessage{DeliveryID: "d1", ChatID: 1, Payload: MessagePayload{Text: "first"}},
+		QueuedMessage{DeliveryID: "d1", ChatID: 2, Payload: MessagePayload{Text: "second"}},
+	))
+	require.NoError(t, db.Close())
+
+	queue, err = NewQueue(openTestDB(t, path))
+	require.NoError(t, err)
+
+	msg, err := queue.Next(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, "first", msg.Payload.Text)
+	assert.Equal(t, int64(1), msg.ChatID)
+
+	require.NoError(t, queue.Ack(msg.ID))
+
+	msg, err = queue.Next(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, "second", msg.Payload.Text)
+}
+
+func TestQueueRetryDelaysMessage(t *testing.T) {
+	queue := newTestQueue(t)
+	require.NoError(t, queue.Push(QueuedMessage{ChatID: 1, Payload: MessagePayload{Text: "hello"}}))
+
+	msg, err := queue.Next(t.Context())
+	require.NoError(t, err)
+	require.NoError(t, queue.Retry(msg, time.Now().Add(time.Hour)))
+
+	ctx, cancel := context.WithTimeout(t.Context(), 50*time.Millisecond)
+	defer cancel()
+	_, err = queue.Next(ctx)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	require.NoError(t, queue.Retry(msg, time.Now()))
+	msg, err = queue.Next(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, 1, msg.Attempts)
+}
+
+func TestQueueNextWakesOnPush(t *testing.T) {
+	queue := newTestQueue(t)
+
+	result := make(chan QueuedMessage, 1)
+	go func() {
+		msg, err := queue.Next(t.Context())
+		if err == nil {
+			result <- msg
+		}
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	require.NoError(t, queue.Push(QueuedMessage{ChatID: 1, Payload: MessagePayload{Text: "late"}}))
+
+	select {
+	case msg := <-result:
+		assert.Equal(t, "late", msg.Payload.Text)
+	case <-time.After(time.Second):
+		t.Fatal("Next did not return after Push")
+	}
+}
+
+func TestQueueKeepsDeliveryPartsInOrder(t *testing.T) {
+	queue := newTestQueue(t)
+	require.NoError(t, queue.Push(
+		QueuedMessage{DeliveryID: "d1", ChatID: 1, Payload: MessagePayload{Text: "part 1"}},
+		QueuedMessage{DeliveryID: "d1", ChatID: 1, Payload: MessagePayload{Text: "part 2"}},
+		QueuedMessage{DeliveryID: "d1", ChatID: 2, Payload: MessagePayload{Text: "part 1"}},
+	))
+
+	msg, err := queue.Next(t.Context())
+	require.NoError(t, err)
+	require.NoError(t, queue.Retry(msg, time.Now().Add(time.Hour)))
+
+	msg, err = queue.Next(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), msg.ChatID, "part 2 for chat 1 waits for part 1")
+}
+
+func TestQueueThrottleSkipsChat(t *testing.T) {
+	queue := newTestQueue(t)
+	require.NoError(t, queue.Push(
+		QueuedMessage{DeliveryID: "d1", ChatID: 1, Payload: MessagePayload{Text: "throttled"}},
+		QueuedMessage{DeliveryID: "d2", ChatID: 2, Payload: MessagePayload{Text: "free"}},
+	))
+
+	queue.Throttle(1, time.Now().Add(50*time.Millisecond))
+
+	msg, err := queue.Next(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), msg.ChatID)
+	require.NoError(t, queue.Ack(msg.ID))
+
+	start := time.Now()
+	msg, err = queue.Next(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), msg.ChatID)
+	assert.Zero(t, msg.NotBefore, "throttling doesn't rewrite the queue entry")
+	assert.GreaterOrEqual(t, time.Since(start), 40*time.Millisecond)
+}
+
+func TestQueueStoresAttachmentsOncePerDelivery(t *testing.T) {
+	queue := newTestQueue(t)
+	deadLetters, err := NewDeadLetters(queue.db, queue)
+	require.NoError(t, err)
+
+	file := Attachment{Name: "report.pdf", ContentType: "application/pdf", Data: []byte("%PDF-1.4 report")}
+	payload := MessagePayload{Text: "report", Attachments: []Attachment{file}}
+	require.NoError(t, queue.Push(
+		QueuedMessage{DeliveryID: "d1", ChatID: 1, Payload: payload},
+		QueuedMessage{DeliveryID: "d1", ChatID: 2, Payload: payload},
+	))
+
+	blobs := func() (entries int, refs uint64) {
+		require.NoError(t, queue.db.View(func(tx *bolt.Tx) error {
+			b := tx.Bucket(attachmentsBucket).Bucket([]byte("d1"))
+			if b == nil {
+				return nil
+			}
+			refs = attachmentRefs(b)
+			return b.ForEach(func(_, _ []byte) error {
+				entries++
+				return nil
+			})
+		}))
+		return entries, refs
+	}
+
+	entries, refs := blobs()
+	assert.Equal(t, 2, entries, "the data and the reference count")
+	assert.Equal(t, uint64(2), refs)
+
+	require.NoError(t, queue.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(queueBucket).Get(itob(1))
+		assert.NotContains(t, string(v), `"data"`, "queue entries keep only the blob key")
+		return nil
+	}))
+
+	first, err := queue.Next(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, file.Data, first.Payload.Attachments[0].Data)
+	require.NoError(t, deadLetters.Add(first, 1, errors.New("boom")))
+	require.NoError(t, queue.Ack(first.ID))
+
+	second, err := queue.Next(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, file.Data, second.Payload.Attachments[0].Data)
+	require.NoError(t, queue.Ack(second.ID))
+
+	_, refs = blobs()
+	assert.Equal(t, uint64(1), refs, "the dead letter still holds the data")
+
+	stored, err := deadLetters.List()
+	require.NoError(t, err)
+	require.NoError(t, deadLetters.Replay(stored[0].ID))
+
+	replayed, err := queue.Next(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, file.Data, replayed.Payload.Attachments[0].Data)
+	require.NoError(t, queue.Ack(replayed.ID))
+
+	entries, _ = blobs()
+	assert.Zero(t, entries, "the last reference deletes the data")
+}
+
+func TestQueueIndexesExistingEntries(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+
+	db := openTestDB(t, path)
+	require.NoError(t, db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucket(queueBucket)
+		if err != nil {
+			return err
+		}
+		for id, text := range map[uint64]string{1: "later", 2: "now"} {
+			msg := QueuedMessage{ID: id, ChatID: int64(id), Payload: MessagePayload{Text: text}}
+			if text == "later" {
+				msg.NotBefore = time.Now().Add(time.Hour)
+			}
+			data, err := json.Marshal(msg)
+			if err != nil {
+				return err
+			}
+			if err := b.Put(itob(id), data); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+
+	queue, err := NewQueue(db)
+	require.NoError(t, err)
+
+	msg, err := queue.Next(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, "now", msg.Payload.Text)
+	require.NoError(t, queue.Ack(msg.ID))
+
+	_, found, wakeAt, _, err := queue.peek(time.Now())
+	require.NoError(t, err)
+	assert.False(t, found)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), wakeAt, time.Minute)
+}
+
+func TestQueueMovesUnreadableEntriesToDeadLetters(t *testing.T) {
+	queue := newTestQueue(t)
+	deadLetters, err := NewDeadLetters(queue.db, queue)
+	require.NoError(t, err)
+
+	file := Attachment{Name: "report.pdf", Data: []byte("%PDF-1.4 report")}
+	require.NoError(t, queue.Push(
+		QueuedMessage{DeliveryID: "d1", ChatID: 1, Payload: MessagePayload{Text: "corrupt"}},
+		QueuedMessage{DeliveryID: "d2", ChatID: 2, Payload: MessagePayload{Text: "blob gone", Attachments: []Attachment{file}}},
+		QueuedMessage{DeliveryID: "d3", ChatID: 3, Payload: MessagePayload{Text: "good"}},
+	))
+	require.NoError(t, queue.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.Bucket(queueBucket).Put(itob(1), []byte("{not json")); err != nil {
+			return err
+		}
+		return tx.Bucket(attachmentsBucket).DeleteBucket([]byte("d2"))
+	}))
+
+	msg, err := queue.Next(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, "good", msg.Payload.Text)
+	require.NoError(t, queue.Ack(msg.ID))
+
+	stored, err := deadLetters.List()
+	require.NoError(t, err)
+	require.Len(t, stored, 2)
+	assert.Equal(t, "d1", stored[0].DeliveryID)
+	assert.Equal(t, int64(1), stored[0].ChatID)
+	assert.Equal(t, "d2", stored[1].DeliveryID)
+	assert.Equal(t, "blob gone", stored[1].Payload.Text)
+	assert.Empty(t, stored[1].Payload.Attachments)
+
+	require.NoError(t, queue.db.View(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{queueBucket, queueDueBucket, queueOrderBucket} {
+			k, _ := tx.Bucket(name).Cursor().First()
+			assert.Nil(t, k, "%s is empty", name)
+		}
+		return nil
+	}))
+}
+
+func TestQueueSendsPartsAfterUnreadableEntry(t *testing.T) {
+	queue := newTestQueue(t)
+	require.NoError(t, queue.Push(
+		QueuedMessage{DeliveryID: "d1", ChatID: 1, Payload: MessagePayload{Text: "part 1"}},
+		QueuedMessage{DeliveryID: "d1", ChatID: 1, Payload: MessagePayload{Text: "part 2"}},
+	))
+	require.NoError(t, queue.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(queueBucket).Put(itob(1), []byte("{not json"))
+	}))
+
+	ctx, cancel := context.WithTimeout(t.Context(), time.Second)
+	defer cancel()
+	msg, err := queue.Next(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "part 2", msg.Payload.Text)
+}
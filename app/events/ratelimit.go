@@ -0,0 +1,118 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+type RateLimiter struct {
+	mu       sync.Mutex
+	global   *tokenBucket
+	chats    map[int64]*tokenBucket
+	perChat  float64
+	perGroup float64
+	now      func() time.Time
+}
+
+// NewRateLimiter creates a limiter with rates in messages per second. Group and
+// channel chats (negative IDs) use perGroup, private chats use perChat.
+func NewRateLimiter(global, perChat, perGroup float64) *RateLimiter {
+	l := &RateLimiter{
+		chats:    make(map[int64]*tokenBucket),
+		perChat:  perChat,
+		perGroup: perGroup,
+		now:      time.Now,
+	}
+	if global > 0 {
+		l.global = newTokenBucket(global, math.Max(global, 1), l.now())
+	}
+	return l
+}
+
+// ReserveChat takes a token for chatID when one is available and returns zero,
+// otherwise it returns how long the caller should wait without taking anything.
+func (l *RateLimiter) ReserveChat(chatID int64) time.Duration {
+	if l == nil {
+		return 0
+	}
+
+	rate := l.perChat
+	if chatID < 0 {
+		rate = l.perGroup
+	}
+	if rate <= 0 {
+		return 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	bucket, ok := l.chats[chatID]
+	if !ok {
+		bucket = newTokenBucket(rate, 1, now)
+		l.chats[chatID] = bucket
+	}
+
+	if wait := bucket.delay(now); wait > 0 {
+		return wait
+	}
+	bucket.take()
+	return 0
+}
+
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	if l == nil || l.global == nil {
+		return nil
+	}
+
+	l.mu.Lock()
+	now := l.now()
+	wait := l.global.delay(now)
+	l.global.take()
+	l.mu.Unlock()
+
+	if wait <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return fmt.Errorf("wait for global rate limit: %w", ctx.Err())
+	case <-timer.C:
+		return nil
+	}
+}
+
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate, burst float64, now time.Time) *tokenBucket {
+	return &tokenBucket{rate: rate, burst: burst, tokens: burst, last: now}
+}
+
+func (b *tokenBucket) delay(now time.Time) time.Duration {
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = math.Min(b.burst, b.tokens+elapsed.Seconds()*b.rate)
+		b.last = now
+	}
+
+	if b.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
+
+func (b *tokenBucket) take() {
+	b.tokens--
+}
@@ -0,0 +1,46 @@
+package events
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimiterReserveChat(t *testing.T) {
+	now := time.Unix(0, 0)
+	l := NewRateLimiter(0, 1, 0.5)
+	l.now = func() time.Time { return now }
+
+	assert.Zero(t, l.ReserveChat(111), "first message to a chat goes out immediately")
+	assert.Equal(t, time.Second, l.ReserveChat(111), "second message has to wait a full interval")
+	assert.Zero(t, l.ReserveChat(222), "other chats are not affected")
+
+	assert.Zero(t, l.ReserveChat(-100))
+	assert.Equal(t, 2*time.Second, l.ReserveChat(-100), "groups use their own rate")
+
+	now = now.Add(500 * time.Millisecond)
+	assert.Equal(t, 500*time.Millisecond, l.ReserveChat(111))
+
+	now = now.Add(500 * time.Millisecond)
+	assert.Zero(t, l.ReserveChat(111))
+}
+
+func TestRateLimiterWaitPacesGlobally(t *testing.T) {
+	l := NewRateLimiter(20, 0, 0)
+
+	start := time.Now()
+	for range 25 {
+		require.NoError(t, l.Wait(t.Context()))
+	}
+
+	assert.GreaterOrEqual(t, time.Since(start), 200*time.Millisecond, "burst of 20 then 5 more at 20/s")
+}
+
+func TestRateLimiterNilIsUnlimited(t *testing.T) {
+	var l *RateLimiter
+
+	assert.Zero(t, l.ReserveChat(111))
+	require.NoError(t, l.Wait(t.Context()))
+}
@@ -0,0 +1,59 @@
+package events
+
+import (
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"time"
+
+	tbapi "github.com/OvyFlash/telegram-bot-api"
+)
+
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+func (p RetryPolicy) ShouldRetry(attempt int, err error) bool {
+	return attempt < p.MaxAttempts && IsRetryable(err)
+}
+
+// Delay returns how long to wait before the next attempt, using exponential
+// backoff with equal jitter, but never less than the retry_after Telegram asked for.
+func (p RetryPolicy) Delay(attempt int, err error) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < attempt && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	if delay > 0 {
+		delay = delay/2 + rand.N(delay/2+1)
+	}
+
+	if retryAfter := RetryAfter(err); retryAfter > delay {
+		delay = retryAfter
+	}
+
+	return delay
+}
+
+func IsRetryable(err error) bool {
+	var apiErr *tbapi.Error
+	if !errors.As(err, &apiErr) {
+		return true
+	}
+
+	return apiErr.Code == http.StatusTooManyRequests || apiErr.Code >= http.StatusInternalServerError
+}
+
+func RetryAfter(err error) time.Duration {
+	var apiErr *tbapi.Error
+	if !errors.As(err, &apiErr) {
+		return 0
+	}
+
+	return time.Duration(apiErr.RetryAfter) * time.Second
+}
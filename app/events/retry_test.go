@@ -0,0 +1,74 @@
+package events
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	tbapi "github.com/OvyFlash/telegram-bot-api"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "network error", err: errors.New("dial tcp: i/o timeout"), want: true},
+		{name: "too many requests", err: &tbapi.Error{Code: 429}, want: true},
+		{name: "server error", err: &tbapi.Error{Code: 502}, want: true},
+		{name: "wrapped server error", err: fmt.Errorf("send: %w", &tbapi.Error{Code: 500}), want: true},
+		{name: "bot blocked", err: &tbapi.Error{Code: 403, Message: "Forbidden: bot was blocked by the user"}, want: false},
+		{name: "chat not found", err: &tbapi.Error{Code: 400, Message: "Bad Request: chat not found"}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, IsRetryable(tt.err))
+		})
+	}
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 5, BaseDelay: time.Second, MaxDelay: 10 * time.Second}
+
+	tests := []struct {
+		name    string
+		attempt int
+		err     error
+		wantMin time.Duration
+		wantMax time.Duration
+	}{
+		{name: "first attempt", attempt: 1, err: errors.New("timeout"), wantMin: 500 * time.Millisecond, wantMax: time.Second},
+		{name: "third attempt doubles twice", attempt: 3, err: errors.New("timeout"), wantMin: 2 * time.Second, wantMax: 4 * time.Second},
+		{name: "capped by max delay", attempt: 10, err: errors.New("timeout"), wantMin: 5 * time.Second, wantMax: 10 * time.Second},
+		{
+			name:    "retry_after wins over backoff",
+			attempt: 1,
+			err:     &tbapi.Error{Code: 429, ResponseParameters: tbapi.ResponseParameters{RetryAfter: 30}},
+			wantMin: 30 * time.Second,
+			wantMax: 30 * time.Second,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for range 20 {
+				delay := policy.Delay(tt.attempt, tt.err)
+				assert.GreaterOrEqual(t, delay, tt.wantMin)
+				assert.LessOrEqual(t, delay, tt.wantMax)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyShouldRetry(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 3}
+
+	assert.True(t, policy.ShouldRetry(1, errors.New("timeout")))
+	assert.True(t, policy.ShouldRetry(2, errors.New("timeout")))
+	assert.False(t, policy.ShouldRetry(3, errors.New("timeout")))
+	assert.False(t, policy.ShouldRetry(1, &tbapi.Error{Code: 403}))
+}
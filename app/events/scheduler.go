@@ -0,0 +1,204 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	scheduledBucket = []byte("scheduled")
+
+	ErrScheduledMessageNotFound = errors.New("scheduled message not found")
+)
+
+type ScheduledMessage struct {
+	ID        string         `json:"id"`
+	Payload   MessagePayload `json:"payload"`
+	SendAt    time.Time      `json:"send_at"`
+	CreatedAt time.Time      `json:"created_at"`
+}
+
+type Scheduler struct {
+	db         *bolt.DB
+	dispatcher *Dispatcher
+	notify     chan struct{}
+}
+
+func NewScheduler(db *bolt.DB, dispatcher *Dispatcher) (*Scheduler, error) {
+	err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(scheduledBucket)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create scheduled bucket: %w", err)
+	}
+
+	return &Scheduler{
+		db:         db,
+		dispatcher: dispatcher,
+		notify:     make(chan struct{}, 1),
+	}, nil
+}
+
+func (s *Scheduler) Schedule(payload MessagePayload, at time.Time) (string, error) {
+	msg := ScheduledMessage{
+		ID:        newDeliveryID(),
+		Payload:   payload,
+		SendAt:    at,
+		CreatedAt: time.Now(),
+	}
+
+	if err := s.put(msg); err != nil {
+		return "", fmt.Errorf("schedule message for %s: %w", at.Format(time.RFC3339), err)
+	}
+
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+
+	return msg.ID, nil
+}
+
+func (s *Scheduler) List() ([]ScheduledMessage, error) {
+	messages := make([]ScheduledMessage, 0)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(scheduledBucket).ForEach(func(k, v []byte) error {
+			var msg ScheduledMessage
+			if err := json.Unmarshal(v, &msg); err != nil {
+				return fmt.Errorf("decode scheduled message %s: %w", k, err)
+			}
+			messages = append(messages, msg)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list scheduled messages: %w", err)
+	}
+
+	slices.SortFunc(messages, func(a, b ScheduledMessage) int {
+		return a.SendAt.Compare(b.SendAt)
+	})
+	return messages, nil
+}
+
+func (s *Scheduler) Get(id string) (ScheduledMessage, error) {
+	var msg ScheduledMessage
+	err := s.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(scheduledBucket).Get([]byte(id))
+		if v == nil {
+			return ErrScheduledMessageNotFound
+		}
+		return json.Unmarshal(v, &msg)
+	})
+	if err != nil {
+		return ScheduledMessage{}, fmt.Errorf("get scheduled message %s: %w", id, err)
+	}
+	return msg, nil
+}
+
+func (s *Scheduler) Cancel(id string) error {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(scheduledBucket)
+		if b.Get([]byte(id)) == nil {
+			return ErrScheduledMessageNotFound
+		}
+		return b.Delete([]byte(id))
+	})
+	if err != nil {
+		return fmt.Errorf("cancel scheduled message %s: %w", id, err)
+	}
+	return nil
+}
+
+func (s *Scheduler) Run(ctx context.Context) {
+	for {
+		next, err := s.releaseDue(time.Now())
+		if err != nil {
+			log.Printf("[ERROR] %v", err)
+			next = time.Now().Add(queueErrorDelay)
+		}
+
+		if err := waitUntil(ctx, next, s.notify); err != nil {
+			return
+		}
+	}
+}
+
+// releaseDue hands every message whose time has come to the dispatcher and returns
+// when the next one is due, or the zero time if nothing is scheduled.
+func (s *Scheduler) releaseDue(now time.Time) (time.Time, error) {
+	messages, err := s.List()
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	for _, msg := range messages {
+		if msg.SendAt.After(now) {
+			return msg.SendAt, nil
+		}
+
+		// claiming first means a cancel either wins and the message is never sent, or
+		// finds nothing left to cancel
+		claimed, err := s.claim(msg.ID)
+		if errors.Is(err, ErrScheduledMessageNotFound) {
+			continue
+		}
+		if err != nil {
+			return time.Time{}, err
+		}
+
+		err = s.dispatcher.dispatch(claimed.ID, claimed.Payload)
+		switch {
+		case errors.Is(err, ErrUnknownRoute):
+			log.Printf("[WARN] Dropping scheduled message %s: %v", claimed.ID, err)
+			continue
+		case err != nil:
+			if err := s.put(claimed); err != nil {
+				log.Printf("[ERROR] Scheduled message %s is lost: %v", claimed.ID, err)
+			}
+			return time.Time{}, fmt.Errorf("release scheduled message %s: %w", claimed.ID, err)
+		}
+		log.Printf("[INFO] Released scheduled message %s", claimed.ID)
+	}
+
+	return time.Time{}, nil
+}
+
+// claim removes a pending message and returns it, so only one of a release and a
+// cancel can take it.
+func (s *Scheduler) claim(id string) (ScheduledMessage, error) {
+	var msg ScheduledMessage
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(scheduledBucket)
+		v := b.Get([]byte(id))
+		if v == nil {
+			return ErrScheduledMessageNotFound
+		}
+		if err := json.Unmarshal(v, &msg); err != nil {
+			return err
+		}
+		return b.Delete([]byte(id))
+	})
+	if err != nil {
+		return ScheduledMessage{}, fmt.Errorf("claim scheduled message %s: %w", id, err)
+	}
+	return msg, nil
+}
+
+func (s *Scheduler) put(msg ScheduledMessage) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		data, err := json.Marshal(msg)
+		if err != nil {
+			return fmt.Errorf("encode scheduled message: %w", err)
+		}
+		return tx.Bucket(scheduledBucket).Put([]byte(msg.ID), data)
+	})
+}
@@ -0,0 +1,88 @@
+package events
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchedulerReleasesDueMessages(t *testing.T) {
+	queue := newTestQueue(t)
+	deliveries := newTestDeliveries(t, queue)
+	scheduler, err := NewScheduler(queue.db, NewDispatcher(queue, deliveries, []int64{111}, nil, 0))
+	require.NoError(t, err)
+
+	now := time.Now()
+	dueID, err := scheduler.Schedule(MessagePayload{Text: "due"}, now.Add(time.Minute))
+	require.NoError(t, err)
+	laterID, err := scheduler.Schedule(MessagePayload{Text: "later"}, now.Add(time.Hour))
+	require.NoError(t, err)
+
+	scheduled, err := scheduler.List()
+	require.NoError(t, err)
+	require.Len(t, scheduled, 2)
+	assert.Equal(t, dueID, scheduled[0].ID)
+
+	next, err := scheduler.releaseDue(now.Add(2 * time.Minute))
+	require.NoError(t, err)
+	assert.WithinDuration(t, now.Add(time.Hour), next, time.Millisecond)
+
+	msg, err := queue.Next(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, dueID, msg.DeliveryID)
+	assert.Equal(t, "due", msg.Payload.Text)
+
+	delivery, err := deliveries.Get(dueID)
+	require.NoError(t, err)
+	assert.Equal(t, StatusPending, delivery.Status)
+
+	_, err = scheduler.Get(dueID)
+	require.ErrorIs(t, err, ErrScheduledMessageNotFound)
+	_, err = scheduler.Get(laterID)
+	require.NoError(t, err)
+}
+
+func TestSchedulerCancel(t *testing.T) {
+	queue := newTestQueue(t)
+	scheduler, err := NewScheduler(queue.db, NewDispatcher(queue, newTestDeliveries(t, queue), []int64{111}, nil, 0))
+	require.NoError(t, err)
+
+	id, err := scheduler.Schedule(MessagePayload{Text: "never"}, time.Now().Add(time.Minute))
+	require.NoError(t, err)
+
+	require.NoError(t, scheduler.Cancel(id))
+	require.ErrorIs(t, scheduler.Cancel(id), ErrScheduledMessageNotFound)
+
+	next, err := scheduler.releaseDue(time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.True(t, next.IsZero())
+
+	scheduled, err := scheduler.List()
+	require.NoError(t, err)
+	assert.Empty(t, scheduled)
+}
+
+func TestSchedulerClaimRacesCancel(t *testing.T) {
+	queue := newTestQueue(t)
+	scheduler, err := NewScheduler(queue.db, NewDispatcher(queue, newTestDeliveries(t, queue), []int64{111}, nil, 0))
+	require.NoError(t, err)
+
+	id, err := scheduler.Schedule(MessagePayload{Text: "once"}, time.Now())
+	require.NoError(t, err)
+
+	claimed, err := scheduler.claim(id)
+	require.NoError(t, err)
+	assert.Equal(t, "once", claimed.Payload.Text)
+
+	require.ErrorIs(t, scheduler.Cancel(id), ErrScheduledMessageNotFound, "a claimed message can't be canceled")
+	_, err = scheduler.claim(id)
+	require.ErrorIs(t, err, ErrScheduledMessageNotFound, "a message is claimed only once")
+
+	id, err = scheduler.Schedule(MessagePayload{Text: "canceled"}, time.Now())
+	require.NoError(t, err)
+	require.NoError(t, scheduler.Cancel(id))
+	_, err = scheduler.claim(id)
+	require.ErrorIs(t, err, ErrScheduledMessageNotFound, "a canceled message is never released")
+}
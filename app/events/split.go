@@ -0,0 +1,333 @@
+package events
+
+import (
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	tbapi "github.com/OvyFlash/telegram-bot-api"
+)
+
+const (
+	MaxMessageLength = 4096
+	MaxCaptionLength = 1024
+	MaxPhotoSize     = 10 << 20
+	MaxMediaGroup    = 10
+)
+
+type breakPriority int
+
+const (
+	breakNone breakPriority = iota
+	breakAny
+	breakSpace
+	breakLine
+	breakParagraph
+)
+
+type markupEntity struct {
+	open  string
+	close string
+}
+
+type markupToken struct {
+	text  string
+	open  *markupEntity
+	close bool
+}
+
+type breakPoint struct {
+	token    int
+	length   int
+	cut      int
+	stack    []markupEntity
+	priority breakPriority
+}
+
+// SplitMessage cuts text into chunks of at most limit UTF-16 code units, preferring
+// paragraph, line and word boundaries. Formatting entities that are open at a cut are
+// closed at the end of the chunk and reopened at the start of the next one.
+func SplitMessage(text, parseMode string, limit int) []string {
+	if textLength(text) <= limit {
+		return []string{text}
+	}
+
+	var tokens []markupToken
+	switch parseMode {
+	case tbapi.ModeHTML:
+		tokens = tokenizeHTML(text)
+	case tbapi.ModeMarkdownV2:
+		tokens = tokenizeMarkdownV2(text)
+	default:
+		tokens = tokenizePlain(text)
+	}
+
+	return splitTokens(tokens, limit)
+}
+
+func splitTokens(tokens []markupToken, limit int) []string {
+	var chunks []string
+	var stack []markupEntity
+
+	for i := 0; i < len(tokens); {
+		var sb strings.Builder
+		for _, e := range stack {
+			sb.WriteString(e.open)
+		}
+		prefixLen := sb.Len()
+		length := textLength(sb.String())
+		var best *breakPoint
+
+		for ; i < len(tokens); i++ {
+			tok := tokens[i]
+			nextStack := applyToken(stack, tok)
+			tokLen := textLength(tok.text)
+
+			if length+tokLen+closingLength(nextStack) > limit && sb.Len() > prefixLen {
+				break
+			}
+
+			sb.WriteString(tok.text)
+			length += tokLen
+			stack = nextStack
+
+			if p := tokenBreakPriority(tokens, i); p > breakNone && (best == nil || betterBreak(best, p, length, limit)) {
+				best = &breakPoint{
+					token:    i,
+					length:   length,
+					cut:      sb.Len(),
+					stack:    append([]markupEntity(nil), stack...),
+					priority: p,
+				}
+			}
+		}
+
+		chunk := sb.String()
+		if i < len(tokens) && best != nil && best.token < i-1 && !breaksBefore(tokens, i, best, length, limit) {
+			chunk = chunk[:best.cut]
+			stack = best.stack
+			i = best.token + 1
+		}
+
+		for i < len(tokens) && tokens[i].open == nil && !tokens[i].close && isBlank(tokens[i].text) {
+			i++
+		}
+
+		body := trimTrailingBlank(chunk)
+		for j := len(stack) - 1; j >= 0; j-- {
+			body += stack[j].close
+		}
+		if strings.TrimSpace(body) != "" {
+			chunks = append(chunks, body)
+		}
+	}
+
+	return chunks
+}
+
+func breaksBefore(tokens []markupToken, i int, best *breakPoint, length, limit int) bool {
+	if tokens[i].open != nil || tokens[i].close || !isBlank(tokens[i].text) {
+		return false
+	}
+	return betterBreak(best, tokenBreakPriority(tokens, i), length, limit)
+}
+
+func betterBreak(current *breakPoint, priority breakPriority, length, limit int) bool {
+	if length < limit/2 {
+		return priority >= current.priority
+	}
+	if current.length < limit/2 {
+		return true
+	}
+	return priority >= current.priority
+}
+
+func tokenBreakPriority(tokens []markupToken, i int) breakPriority {
+	tok := tokens[i]
+	if tok.open != nil || tok.close {
+		return breakNone
+	}
+
+	switch tok.text {
+	case "\n":
+		if i > 0 && tokens[i-1].text == "\n" {
+			return breakParagraph
+		}
+		return breakLine
+	case " ":
+		return breakSpace
+	default:
+		return breakAny
+	}
+}
+
+func applyToken(stack []markupEntity, tok markupToken) []markupEntity {
+	switch {
+	case tok.open != nil:
+		return append(stack[:len(stack):len(stack)], *tok.open)
+	case tok.close && len(stack) > 0:
+		return stack[: len(stack)-1 : len(stack)-1]
+	default:
+		return stack
+	}
+}
+
+func closingLength(stack []markupEntity) int {
+	n := 0
+	for _, e := range stack {
+		n += textLength(e.close)
+	}
+	return n
+}
+
+func tokenizePlain(text string) []markupToken {
+	tokens := make([]markupToken, 0, len(text))
+	for _, r := range text {
+		tokens = append(tokens, markupToken{text: string(r)})
+	}
+	return tokens
+}
+
+func tokenizeHTML(text string) []markupToken {
+	var tokens []markupToken
+	for i := 0; i < len(text); {
+		switch text[i] {
+		case '<':
+			end := strings.IndexByte(text[i:], '>')
+			if end < 0 {
+				tokens = append(tokens, markupToken{text: text[i:]})
+				return tokens
+			}
+			tag := text[i : i+end+1]
+			i += end + 1
+
+			if strings.HasPrefix(tag, "</") {
+				tokens = append(tokens, markupToken{text: tag, close: true})
+				continue
+			}
+			fields := strings.Fields(strings.Trim(tag, "<>/"))
+			if len(fields) == 0 {
+				tokens = append(tokens, markupToken{text: tag})
+				continue
+			}
+			name := strings.ToLower(fields[0])
+			tokens = append(tokens, markupToken{text: tag, open: &markupEntity{open: tag, close: "</" + name + ">"}})
+		case '&':
+			end := strings.IndexByte(text[i:], ';')
+			if end < 0 || end > 10 {
+				tokens = append(tokens, markupToken{text: "&"})
+				i++
+				continue
+			}
+			tokens = append(tokens, markupToken{text: text[i : i+end+1]})
+			i += end + 1
+		default:
+			_, size := utf8.DecodeRuneInString(text[i:])
+			tokens = append(tokens, markupToken{text: text[i : i+size]})
+			i += size
+		}
+	}
+	return tokens
+}
+
+func tokenizeMarkdownV2(text string) []markupToken {
+	var tokens []markupToken
+	var open []string
+	inCode := func() bool {
+		return len(open) > 0 && (open[len(open)-1] == "`" || strings.HasPrefix(open[len(open)-1], "```"))
+	}
+
+	toggle := func(marker, opening string) {
+		if top := len(open) - 1; top >= 0 && (open[top] == marker || marker == "```" && strings.HasPrefix(open[top], marker)) {
+			open = open[:len(open)-1]
+			tokens = append(tokens, markupToken{text: marker, close: true})
+			return
+		}
+		open = append(open, opening)
+		tokens = append(tokens, markupToken{text: opening, open: &markupEntity{open: opening, close: marker}})
+	}
+
+	for i := 0; i < len(text); {
+		rest := text[i:]
+		switch {
+		case rest[0] == '\\' && len(rest) > 1:
+			_, size := utf8.DecodeRuneInString(rest[1:])
+			tokens = append(tokens, markupToken{text: rest[:1+size]})
+			i += 1 + size
+		case strings.HasPrefix(rest, "```"):
+			opening := "```"
+			if !inCode() {
+				if nl := strings.IndexByte(rest, '\n'); nl >= 0 && !strings.Contains(rest[3:nl], "```") {
+					opening = rest[:nl+1]
+				}
+			}
+			toggle("```", opening)
+			i += len(opening)
+		case rest[0] == '`':
+			toggle("`", "`")
+			i++
+		case inCode():
+			_, size := utf8.DecodeRuneInString(rest)
+			tokens = append(tokens, markupToken{text: rest[:size]})
+			i += size
+		case strings.HasPrefix(rest, "||"), strings.HasPrefix(rest, "__"):
+			toggle(rest[:2], rest[:2])
+			i += 2
+		case rest[0] == '*', rest[0] == '_', rest[0] == '~':
+			toggle(rest[:1], rest[:1])
+			i++
+		case rest[0] == '[' || strings.HasPrefix(rest, "!["):
+			n := markdownLinkLength(rest)
+			tokens = append(tokens, markupToken{text: rest[:n]})
+			i += n
+		default:
+			_, size := utf8.DecodeRuneInString(rest)
+			tokens = append(tokens, markupToken{text: rest[:size]})
+			i += size
+		}
+	}
+	return tokens
+}
+
+func markdownLinkLength(s string) int {
+	start := strings.IndexByte(s, '[')
+	for i := start + 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case ']':
+			if i+1 >= len(s) || s[i+1] != '(' {
+				return start + 1
+			}
+			for j := i + 2; j < len(s); j++ {
+				switch s[j] {
+				case '\\':
+					j++
+				case ')':
+					return j + 1
+				}
+			}
+			return start + 1
+		}
+	}
+	return start + 1
+}
+
+func trimTrailingBlank(s string) string {
+	for len(s) > 0 && isBlank(s[len(s)-1:]) && !strings.HasSuffix(s[:len(s)-1], "\\") {
+		s = s[:len(s)-1]
+	}
+	return s
+}
+
+func isBlank(s string) bool {
+	return s == " " || s == "\n"
+}
+
+func textLength(s string) int {
+	n := 0
+	for _, r := range s {
+		n += utf16.RuneLen(r)
+	}
+	return n
+}
@@ -0,0 +1,115 @@
+package events
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitMessage(t *testing.T) {
+	tests := []struct {
+		name      string
+		text      string
+		parseMode string
+		limit     int
+		want      []string
+	}{
+		{
+			name:  "short text is untouched",
+			text:  "hello world",
+			limit: 20,
+			want:  []string{"hello world"},
+		},
+		{
+			name:  "prefers paragraph boundaries",
+			text:  "first line\nsecond\n\nthird paragraph",
+			limit: 25,
+			want:  []string{"first line\nsecond", "third paragraph"},
+		},
+		{
+			name:  "falls back to line boundaries",
+			text:  "aaaa bbbb\ncccc dddd\neeee",
+			limit: 20,
+			want:  []string{"aaaa bbbb\ncccc dddd", "eeee"},
+		},
+		{
+			name:  "falls back to word boundaries",
+			text:  "one two three four five",
+			limit: 10,
+			want:  []string{"one two", "three four", "five"},
+		},
+		{
+			name:  "hard cuts words longer than the limit",
+			text:  "abcdefghij",
+			limit: 4,
+			want:  []string{"abcd", "efgh", "ij"},
+		},
+		{
+			name:  "counts UTF-16 code units",
+			text:  "😀😀😀",
+			limit: 4,
+			want:  []string{"😀😀", "😀"},
+		},
+		{
+			name:      "closes and reopens HTML tags",
+			text:      "<b>bold text <i>more words</i></b>",
+			parseMode: "HTML",
+			limit:     24,
+			want:      []string{"<b>bold text</b>", "<b><i>more words</i></b>"},
+		},
+		{
+			name:      "keeps HTML entities and tag attributes intact",
+			text:      `<a href="https://x.io">a &amp; b c</a>`,
+			parseMode: "HTML",
+			limit:     34,
+			want:      []string{`<a href="https://x.io">a &amp;</a>`, `<a href="https://x.io">b c</a>`},
+		},
+		{
+			name:      "closes and reopens MarkdownV2 entities",
+			text:      "*bold _italic words_ end*",
+			parseMode: "MarkdownV2",
+			limit:     16,
+			want:      []string{"*bold _italic_*", "*_words_ end*"},
+		},
+		{
+			name:      "reopens pre blocks with their language",
+			text:      "```go\nline1\nline2\nline3\n```",
+			parseMode: "MarkdownV2",
+			limit:     20,
+			want:      []string{"```go\nline1\nline2```", "```go\nline3\n```"},
+		},
+		{
+			name:      "never cuts inside MarkdownV2 links or escapes",
+			text:      "see [the docs](https://example.com/a) now\\!",
+			parseMode: "MarkdownV2",
+			limit:     40,
+			want:      []string{"see [the docs](https://example.com/a)", "now\\!"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := SplitMessage(tt.text, tt.parseMode, tt.limit)
+			assert.Equal(t, tt.want, got)
+			for _, chunk := range got {
+				assert.LessOrEqual(t, textLength(chunk), tt.limit)
+			}
+		})
+	}
+}
+
+func TestSplitMessageLongText(t *testing.T) {
+	paragraph := strings.Repeat("word ", 150) + "\n\n"
+	text := strings.Repeat(paragraph, 20)
+
+	chunks := SplitMessage(text, "", MaxMessageLength)
+	require.Greater(t, len(chunks), 1)
+
+	for _, chunk := range chunks {
+		assert.LessOrEqual(t, textLength(chunk), MaxMessageLength)
+		assert.True(t, strings.HasSuffix(chunk, "word"), "chunks end on a paragraph boundary")
+	}
+	assert.Equal(t, strings.Count(text, "word"), strings.Count(strings.Join(chunks, ""), "word"))
+}
@@ -0,0 +1,173 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	tbapi "github.com/OvyFlash/telegram-bot-api"
+	"github.com/pkarpovich/tg-relay-bot/app/events"
+)
+
+// alertmanagerPayload is the webhook body of Prometheus Alertmanager, version 4.
+type alertmanagerPayload struct {
+	Version           string            `json:"version"`
+	Status            string            `json:"status"`
+	Receiver          string            `json:"receiver"`
+	GroupLabels       map[string]string `json:"groupLabels"`
+	CommonLabels      map[string]string `json:"commonLabels"`
+	CommonAnnotations map[string]string `json:"commonAnnotations"`
+	ExternalURL       string            `json:"externalURL"`
+	TruncatedAlerts   int               `json:"truncatedAlerts"`
+	Alerts            []struct {
+		Status       string            `json:"status"`
+		Labels       map[string]string `json:"labels"`
+		Annotations  map[string]string `json:"annotations"`
+		StartsAt     time.Time         `json:"startsAt"`
+		EndsAt       time.Time         `json:"endsAt"`
+		GeneratorURL string            `json:"generatorURL"`
+	} `json:"alerts"`
+}
+
+// leadingAnnotations are shown first and in this order; the rest follow sorted by name.
+var leadingAnnotations = []string{"summary", "description"}
+
+// convertAlertmanager renders an Alertmanager notification: a title with the group's
+// status and labels, the annotations shared by all alerts, and then the firing and
+// resolved alerts with what sets each of them apart.
+func convertAlertmanager(_ *http.Request, body []byte) (events.MessagePayload, error) {
+	var p alertmanagerPayload
+	if err := json.Unmarshal(body, &p); err != nil {
+		return events.MessagePayload{}, err
+	}
+	if p.Version != "4" {
+		return events.MessagePayload{}, fmt.Errorf("unsupported alertmanager payload version %q", p.Version)
+	}
+	if len(p.Alerts) == 0 {
+		return events.MessagePayload{}, errors.New("no alerts")
+	}
+
+	firing := 0
+	for _, a := range p.Alerts {
+		if a.Status == "firing" {
+			firing++
+		}
+	}
+
+	var sb strings.Builder
+	title := fmt.Sprintf("[%s", strings.ToUpper(p.Status))
+	if p.Status == "firing" {
+		title += fmt.Sprintf(":%d", firing)
+	}
+	title += "] " + groupName(p.GroupLabels, p.CommonLabels)
+	sb.WriteString("<b>" + events.EscapeHTML(title) + "</b>\n")
+
+	if labels := formatLabels(p.CommonLabels, nil, "alertname"); labels != "" {
+		sb.WriteString("<i>" + events.EscapeHTML(labels) + "</i>\n")
+	}
+	writeAnnotations(&sb, p.CommonAnnotations, nil)
+
+	for _, status := range []string{"firing", "resolved"} {
+		var alerts []string
+		for _, a := range p.Alerts {
+			if a.Status != status {
+				continue
+			}
+
+			var line strings.Builder
+			line.WriteString("• ")
+			labels := formatLabels(a.Labels, p.CommonLabels)
+			if labels == "" {
+				labels = a.Labels["alertname"]
+			}
+			line.WriteString("<b>" + events.EscapeHTML(labels) + "</b>")
+
+			at, prefix := a.StartsAt, " since "
+			if status == "resolved" {
+				at, prefix = a.EndsAt, " at "
+			}
+			if !at.IsZero() {
+				line.WriteString(prefix + at.UTC().Format("2006-01-02 15:04 MST"))
+			}
+			if a.GeneratorURL != "" {
+				line.WriteString(" " + htmlLink(a.GeneratorURL, "source"))
+			}
+			line.WriteString("\n")
+			writeAnnotations(&line, a.Annotations, p.CommonAnnotations)
+			alerts = append(alerts, line.String())
+		}
+		if len(alerts) == 0 {
+			continue
+		}
+
+		sb.WriteString(fmt.Sprintf("\n<b>%s:</b>\n", strings.ToUpper(status[:1])+status[1:]))
+		for _, a := range alerts {
+			sb.WriteString(a)
+		}
+	}
+
+	if p.TruncatedAlerts > 0 {
+		sb.WriteString(fmt.Sprintf("\n<i>%d more alerts were truncated.</i>\n", p.TruncatedAlerts))
+	}
+	if p.ExternalURL != "" {
+		sb.WriteString("\n" + htmlLink(p.ExternalURL, "Alertmanager"))
+	}
+
+	return events.MessagePayload{Text: strings.TrimSpace(sb.String()), ParseMode: tbapi.ModeHTML}, nil
+}
+
+func groupName(groupLabels, commonLabels map[string]string) string {
+	if name := groupLabels["alertname"]; name != "" {
+		return name
+	}
+	if name := commonLabels["alertname"]; name != "" {
+		return name
+	}
+	return formatLabels(groupLabels, nil)
+}
+
+// formatLabels lists labels as sorted key=value pairs, leaving out the keys present in
+// exclude with the same value and the names in skip.
+func formatLabels(labels map[string]string, exclude map[string]string, skip ...string) string {
+	var pairs []string
+	for _, k := range slices.Sorted(maps.Keys(labels)) {
+		if v, ok := exclude[k]; (ok && v == labels[k]) || slices.Contains(skip, k) {
+			continue
+		}
+		pairs = append(pairs, k+"="+labels[k])
+	}
+	return strings.Join(pairs, ", ")
+}
+
+// writeAnnotations writes annotations that aren't already in common, summary and
+// description first.
+func writeAnnotations(sb *strings.Builder, annotations, common map[string]string) {
+	keys := slices.Sorted(maps.Keys(annotations))
+	slices.SortStableFunc(keys, func(a, b string) int {
+		return leadingIndex(a) - leadingIndex(b)
+	})
+
+	for _, k := range keys {
+		v := annotations[k]
+		if v == "" || common[k] == v {
+			continue
+		}
+		if slices.Contains(leadingAnnotations, k) {
+			sb.WriteString(events.EscapeHTML(v) + "\n")
+			continue
+		}
+		sb.WriteString(events.EscapeHTML(k) + ": " + events.EscapeHTML(v) + "\n")
+	}
+}
+
+func leadingIndex(key string) int {
+	if i := slices.Index(leadingAnnotations, key); i >= 0 {
+		return i
+	}
+	return len(leadingAnnotations)
+}
@@ -0,0 +1,142 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pkarpovich/tg-relay-bot/app/config"
+)
+
+const alertmanagerBody = `{
+  "version": "4",
+  "status": "firing",
+  "receiver": "telegram",
+  "groupLabels": {"alertname": "HighCPU"},
+  "commonLabels": {"alertname": "HighCPU", "job": "node", "severity": "critical"},
+  "commonAnnotations": {"runbook_url": "https://wiki/cpu"},
+  "externalURL": "https://alertmanager.local",
+  "truncatedAlerts": 0,
+  "alerts": [
+    {
+      "status": "firing",
+      "labels": {"alertname": "HighCPU", "job": "node", "severity": "critical", "instance": "db-1"},
+      "annotations": {"summary": "CPU at 97% on <db-1>", "runbook_url": "https://wiki/cpu"},
+      "startsAt": "2026-10-17T08:00:00Z",
+      "endsAt": "0001-01-01T00:00:00Z",
+      "generatorURL": "https://prometheus.local/graph?g0.expr=cpu&a=\"1\""
+    },
+    {
+      "status": "firing",
+      "labels": {"alertname": "HighCPU", "job": "node", "severity": "critical", "instance": "db-2"},
+      "annotations": {"summary": "CPU at 91% on db-2", "value": "91"},
+      "startsAt": "2026-10-17T08:05:00Z",
+      "endsAt": "0001-01-01T00:00:00Z",
+      "generatorURL": "javascript:alert(1)"
+    },
+    {
+      "status": "resolved",
+      "labels": {"alertname": "HighCPU", "job": "node", "severity": "critical", "instance": "web-1"},
+      "annotations": {"summary": "CPU at 20% on web-1"},
+      "startsAt": "2026-10-17T07:00:00Z",
+      "endsAt": "2026-10-17T08:10:00Z"
+    }
+  ]
+}`
+
+func TestConvertAlertmanager(t *testing.T) {
+	payload, err := convertAlertmanager(nil, []byte(alertmanagerBody))
+	require.NoError(t, err)
+
+	assert.Equal(t, "HTML", payload.ParseMode)
+	assert.Equal(t, `<b>[FIRING:2] HighCPU</b>
+<i>job=node, severity=critical</i>
+runbook_url: https://wiki/cpu
+
+<b>Firing:</b>
+• <b>instance=db-1</b> since 2026-10-17 08:00 UTC <a href="https://prometheus.local/graph?g0.expr=cpu&amp;a=&quot;1&quot;">source</a>
+CPU at 97% on &lt;db-1&gt;
+• <b>instance=db-2</b> since 2026-10-17 08:05 UTC source
+CPU at 91% on db-2
+value: 91
+
+<b>Resolved:</b>
+• <b>instance=web-1</b> at 2026-10-17 08:10 UTC
+CPU at 20% on web-1
+
+<a href="https://alertmanager.local">Alertmanager</a>`, payload.Text)
+}
+
+func TestConvertAlertmanagerInvalid(t *testing.T) {
+	for name, body := range map[string]string{
+		"not json":      `nope`,
+		"wrong version": `{"version": "3", "alerts": [{"status": "firing"}]}`,
+		"no alerts":     `{"version": "4", "alerts": []}`,
+	} {
+		_, err := convertAlertmanager(nil, []byte(body))
+		assert.Error(t, err, name)
+	}
+}
+
+func TestAlertmanagerReceiver(t *testing.T) {
+	tests := []struct {
+		name       string
+		target     string
+		secret     string
+		webhooks   map[string]config.WebhookConfig
+		body       string
+		wantStatus int
+		wantRoute  string
+	}{
+		{name: "api key", target: "/webhook/alertmanager", secret: "test-secret", body: alertmanagerBody, wantStatus: http.StatusOK},
+		{name: "api key with route", target: "/webhook/alertmanager?route=ops", secret: "test-secret", body: alertmanagerBody, wantStatus: http.StatusOK, wantRoute: "ops"},
+		{name: "unknown route", target: "/webhook/alertmanager?route=nope", secret: "test-secret", body: alertmanagerBody, wantStatus: http.StatusNotFound},
+		{name: "no key", target: "/webhook/alertmanager", body: alertmanagerBody, wantStatus: http.StatusUnauthorized},
+		{
+			name:       "source token in path",
+			target:     "/webhook/alertmanager/tok3n",
+			webhooks:   map[string]config.WebhookConfig{"alertmanager": {Route: "ops", Token: "tok3n"}},
+			body:       alertmanagerBody,
+			wantStatus: http.StatusOK,
+			wantRoute:  "ops",
+		},
+		{
+			name:       "source route can't be overridden",
+			target:     "/webhook/alertmanager/tok3n?route=ci",
+			webhooks:   map[string]config.WebhookConfig{"alertmanager": {Route: "ops", Token: "tok3n"}},
+			body:       alertmanagerBody,
+			wantStatus: http.StatusForbidden,
+		},
+		{name: "invalid payload", target: "/webhook/alertmanager", secret: "test-secret", body: `{"version": "4"}`, wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dispatcher := &mockDispatcher{}
+			srv := CreateServer(&config.Config{
+				Http:     config.HttpConfig{SecretApiKey: "test-secret"},
+				Routes:   map[string]config.RouteConfig{"ops": {ChatID: -1001}, "ci": {ChatID: -1002}},
+				Webhooks: tt.webhooks,
+			}, dispatcher, nil, nil, nil)
+
+			req := httptest.NewRequest(http.MethodPost, tt.target, strings.NewReader(tt.body))
+			req.Header.Set("X-Secret", tt.secret)
+			rec := httptest.NewRecorder()
+
+			srv.server.Handler.ServeHTTP(rec, req)
+
+			require.Equal(t, tt.wantStatus, rec.Code, rec.Body.String())
+			if tt.wantStatus != http.StatusOK {
+				assert.Empty(t, dispatcher.payloads)
+				return
+			}
+			require.Len(t, dispatcher.payloads, 1)
+			assert.Equal(t, tt.wantRoute, dispatcher.payloads[0].Route)
+			assert.Contains(t, dispatcher.payloads[0].Text, "[FIRING:2] HighCPU")
+		})
+	}
+}
@@ -7,28 +7,96 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"text/template"
 	"time"
 
 	"github.com/pkarpovich/tg-relay-bot/app/config"
 	"github.com/pkarpovich/tg-relay-bot/app/events"
 )
 
+type Dispatcher interface {
+	Dispatch(payload events.MessagePayload) (string, error)
+}
+
+type DeadLetterStore interface {
+	List() ([]events.DeadLetter, error)
+	Get(id uint64) (events.DeadLetter, error)
+	Replay(id uint64) error
+	Delete(id uint64) error
+	Purge() (int, error)
+}
+
+type DeliveryStore interface {
+	Get(id string) (events.Delivery, error)
+	Wait(ctx context.Context, id string) (events.Delivery, error)
+}
+
+type Scheduler interface {
+	Schedule(payload events.MessagePayload, at time.Time) (string, error)
+	List() ([]events.ScheduledMessage, error)
+	Get(id string) (events.ScheduledMessage, error)
+	Cancel(id string) error
+}
+
 type Server struct {
-	config          *config.Config
-	server          *http.Server
-	messagesForSend chan events.MessagePayload
+	config      *config.Config
+	server      *http.Server
+	dispatcher  Dispatcher
+	deadLetters DeadLetterStore
+	deliveries  DeliveryStore
+	scheduler   Scheduler
+	idempotency *idempotencyCache
+	keys        *keyRegistry
+	client      *http.Client
+	templates   map[string]*template.Template
 }
 
-func CreateServer(cfg *config.Config, messagesForSend chan events.MessagePayload) *Server {
+func CreateServer(
+	cfg *config.Config,
+	dispatcher Dispatcher,
+	deadLetters DeadLetterStore,
+	deliveries DeliveryStore,
+	scheduler Scheduler,
+) *Server {
 	mux := http.NewServeMux()
 	server := &Server{
-		config:          cfg,
-		messagesForSend: messagesForSend,
+		config:      cfg,
+		dispatcher:  dispatcher,
+		deadLetters: deadLetters,
+		deliveries:  deliveries,
+		scheduler:   scheduler,
+		idempotency: newIdempotencyCache(),
+		keys:        newKeyRegistry(cfg.Http),
+		client:      newImageClient(cfg.Http.FetchPrivateImages),
+		templates:   compileTemplates(cfg.Webhooks),
 	}
 
 	mux.HandleFunc("GET /health", server.healthHandler)
 	mux.HandleFunc("POST /send", server.sendHandler)
+	mux.HandleFunc("POST /send/file", server.sendFileHandler)
 	mux.HandleFunc("POST /webhook", server.webhookHandler)
+	server.handleReceiver(mux, "alertmanager", convertAlertmanager)
+	server.handleReceiver(mux, "grafana", server.convertGrafana)
+	server.handleReceiver(mux, "github", server.convertGitHub)
+	server.handleReceiver(mux, "gitlab", server.convertGitLab)
+	server.handleReceiver(mux, "sentry", convertSentry)
+	server.handleReceiver(mux, "uptime-kuma", convertUptimeKuma)
+	mux.HandleFunc("POST /webhook/{name}", server.webhookHandler)
+	mux.HandleFunc("POST /webhook/{name}/{token}", server.webhookHandler)
+	server.handleCompat(mux, "slack", convertSlack, respondSlack)
+	server.handleCompat(mux, "discord", server.convertDiscord, server.respondDiscord)
+	mux.HandleFunc("POST /message", server.gotifyHandler)
+	mux.HandleFunc("POST /{topic}", server.ntfyHandler)
+	mux.HandleFunc("PUT /{topic}", server.ntfyHandler)
+	mux.HandleFunc("GET /messages/{id}", server.getMessageHandler)
+	mux.HandleFunc("GET /scheduled", server.listScheduledHandler)
+	mux.HandleFunc("GET /scheduled/{id}", server.getScheduledHandler)
+	mux.HandleFunc("DELETE /scheduled/{id}", server.cancelScheduledHandler)
+	mux.HandleFunc("GET /deadletters", server.listDeadLettersHandler)
+	mux.HandleFunc("DELETE /deadletters", server.purgeDeadLettersHandler)
+	mux.HandleFunc("GET /deadletters/{id}", server.getDeadLetterHandler)
+	mux.HandleFunc("DELETE /deadletters/{id}", server.deleteDeadLetterHandler)
+	mux.HandleFunc("POST /deadletters/{id}/replay", server.replayDeadLetterHandler)
 
 	server.server = &http.Server{
 		Addr:              fmt.Sprintf(":%d", cfg.Http.Port),
@@ -76,25 +144,48 @@ func (s *Server) healthHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+type sendRequest struct {
+	Message     string              `json:"message"`
+	ParseMode   string              `json:"parse_mode"`
+	Route       string              `json:"route"`
+	SendAt      *time.Time          `json:"send_at"`
+	Delay       string              `json:"delay"`
+	Attachments []events.Attachment `json:"-"`
+}
+
 func (s *Server) sendHandler(w http.ResponseWriter, r *http.Request) {
+	s.send(w, r, false)
+}
+
+// send handles /send and /send/file. Requests are JSON, or multipart forms carrying
+// files; fileRequired rejects requests without any.
+func (s *Server) send(w http.ResponseWriter, r *http.Request, fileRequired bool) {
 	w.Header().Set("Content-Type", "application/json")
 
-	if r.Header.Get("X-Secret") != s.config.Http.SecretApiKey {
-		s.respondWithError(w, errors.New("unauthorized"), http.StatusUnauthorized)
+	key, ok := s.authorize(w, r, endpointSend)
+	if !ok {
 		return
 	}
 
-	var data struct {
-		Message   string `json:"message"`
-		ParseMode string `json:"parse_mode"`
+	var data sendRequest
+	var err error
+	if isMultipart(r) {
+		data, err = s.parseSendForm(w, r)
+	} else if fileRequired {
+		err = errors.New("multipart/form-data is required")
+	} else {
+		err = json.NewDecoder(r.Body).Decode(&data)
 	}
-	err := json.NewDecoder(r.Body).Decode(&data)
 	if err != nil {
-		s.respondWithError(w, err, http.StatusBadRequest)
+		s.respondWithError(w, err, requestErrorStatus(err))
 		return
 	}
 
-	if data.Message == "" {
+	if fileRequired && len(data.Attachments) == 0 {
+		s.respondWithError(w, errors.New("file is required"), http.StatusBadRequest)
+		return
+	}
+	if data.Message == "" && len(data.Attachments) == 0 {
 		s.respondWithError(w, errors.New("message is required"), http.StatusBadRequest)
 		return
 	}
@@ -106,11 +197,60 @@ func (s *Server) sendHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	log.Printf("[INFO] Sending message: %s", data.Message)
-	s.messagesForSend <- events.MessagePayload{Text: data.Message, ParseMode: data.ParseMode}
+	if !s.hasRoute(data.Route) {
+		s.respondWithError(w, fmt.Errorf("%w %q", events.ErrUnknownRoute, data.Route), http.StatusBadRequest)
+		return
+	}
+	if !key.allowsRoute(data.Route) {
+		s.respondWithError(w, errRouteDenied, http.StatusForbidden)
+		return
+	}
+
+	wait, err := parseWait(r)
+	if err != nil {
+		s.respondWithError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	sendAt, err := parseSchedule(data.SendAt, data.Delay, time.Now())
+	if err != nil {
+		s.respondWithError(w, err, http.StatusBadRequest)
+		return
+	}
+	if wait && !sendAt.IsZero() {
+		s.respondWithError(w, errors.New("wait is not supported for scheduled messages"), http.StatusBadRequest)
+		return
+	}
+
+	if len(data.Attachments) > 0 {
+		log.Printf("[INFO] Sending %d file(s): %s", len(data.Attachments), data.Message)
+	} else {
+		log.Printf("[INFO] Sending message: %s", data.Message)
+	}
+	payload := events.MessagePayload{
+		Text:        data.Message,
+		ParseMode:   data.ParseMode,
+		Route:       data.Route,
+		Attachments: data.Attachments,
+	}
+	id, err := s.dispatchOnce(w, r, "send", keyCaller(key), payload, sendAt)
+	if err != nil {
+		s.respondWithError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if !sendAt.IsZero() {
+		s.respondWithJSON(w, SendResponse{Ok: true, ID: id, Status: StatusScheduled, SendAt: &sendAt})
+		return
+	}
+
+	if wait {
+		s.respondWithDelivery(w, r, id)
+		return
+	}
 
 	w.WriteHeader(http.StatusOK)
-	err = json.NewEncoder(w).Encode(HealthResponse{Ok: true})
+	err = json.NewEncoder(w).Encode(SendResponse{Ok: true, ID: id})
 	if err != nil {
 		log.Printf("[ERROR] Failed to write response: %s", err)
 	}
@@ -119,11 +259,27 @@ func (s *Server) sendHandler(w http.ResponseWriter, r *http.Request) {
 func (s *Server) webhookHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
+	body, ok := s.readBody(w, r)
+	if !ok {
+		return
+	}
+
+	name := r.PathValue("name")
+	route, caller, ok := s.authorizeWebhook(w, r, name, body)
+	if !ok {
+		return
+	}
+
+	if tmpl, ok := s.templates[name]; ok {
+		s.templateWebhook(w, r, name, caller, tmpl, body, route)
+		return
+	}
+
 	var data struct {
 		Content string `json:"content"`
 	}
 
-	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+	if err := json.Unmarshal(body, &data); err != nil {
 		s.respondWithError(w, err, http.StatusBadRequest)
 		return
 	}
@@ -133,12 +289,33 @@ func (s *Server) webhookHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	log.Printf("[INFO] Received webhook notification: %s", data.Content)
-	s.messagesForSend <- events.MessagePayload{Text: data.Content}
+	s.relayContent(w, r, name, caller, data.Content, route)
+}
 
-	w.WriteHeader(http.StatusOK)
-	err := json.NewEncoder(w).Encode(HealthResponse{Ok: true})
+// relayContent sends the content of a generic {"content": "..."} webhook.
+func (s *Server) relayContent(w http.ResponseWriter, r *http.Request, name, caller, content, route string) {
+	log.Printf("[INFO] Received webhook notification from %q: %s", name, content)
+	id, err := s.dispatchOnce(w, r, "webhook", caller, events.MessagePayload{Text: content, Route: route}, time.Time{})
 	if err != nil {
+		s.respondWithError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	s.respondWithJSON(w, SendResponse{Ok: true, ID: id})
+}
+
+func (s *Server) hasRoute(name string) bool {
+	if name == "" {
+		return true
+	}
+	_, ok := s.config.Routes[name]
+	return ok
+}
+
+func (s *Server) respondWithJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
 		log.Printf("[ERROR] Failed to write response: %s", err)
 	}
 }
@@ -3,8 +3,11 @@ package http
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -14,6 +17,19 @@ import (
 	"github.com/pkarpovich/tg-relay-bot/app/events"
 )
 
+type mockDispatcher struct {
+	payloads []events.MessagePayload
+	err      error
+}
+
+func (m *mockDispatcher) Dispatch(payload events.MessagePayload) (string, error) {
+	if m.err != nil {
+		return "", m.err
+	}
+	m.payloads = append(m.payloads, payload)
+	return fmt.Sprintf("delivery-%d", len(m.payloads)), nil
+}
+
 func TestSendHandler(t *testing.T) {
 	tests := []struct {
 		name           string
@@ -73,6 +89,23 @@ func TestSendHandler(t *testing.T) {
 			wantStatus:     http.StatusBadRequest,
 			wantErrMessage: "message is required",
 		},
+		{
+			name:       "message to a named route",
+			secret:     "test-secret",
+			body:       map[string]string{"message": "build passed", "route": "ci"},
+			wantStatus: http.StatusOK,
+			wantPayload: &events.MessagePayload{
+				Text:  "build passed",
+				Route: "ci",
+			},
+		},
+		{
+			name:           "unknown route",
+			secret:         "test-secret",
+			body:           map[string]string{"message": "hello", "route": "billing"},
+			wantStatus:     http.StatusBadRequest,
+			wantErrMessage: "unknown route",
+		},
 		{
 			name:           "unsupported parse_mode",
 			secret:         "test-secret",
@@ -84,13 +117,15 @@ func TestSendHandler(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			ch := make(chan events.MessagePayload, 1)
+			dispatcher := &mockDispatcher{}
 			srv := &Server{
 				config: &config.Config{
-					Http: config.HttpConfig{SecretApiKey: "test-secret"},
+					Http:   config.HttpConfig{SecretApiKey: "test-secret"},
+					Routes: map[string]config.RouteConfig{"ci": {ChatID: -100123}},
 				},
-				messagesForSend: ch,
+				dispatcher: dispatcher,
 			}
+			srv.keys = newKeyRegistry(srv.config.Http)
 
 			var bodyBytes []byte
 			switch v := tt.body.(type) {
@@ -111,9 +146,8 @@ func TestSendHandler(t *testing.T) {
 			assert.Equal(t, tt.wantStatus, rec.Code)
 
 			if tt.wantPayload != nil {
-				require.Len(t, ch, 1)
-				got := <-ch
-				assert.Equal(t, *tt.wantPayload, got)
+				require.Len(t, dispatcher.payloads, 1)
+				assert.Equal(t, *tt.wantPayload, dispatcher.payloads[0])
 			}
 
 			if tt.wantErrMessage != "" {
@@ -124,3 +158,48 @@ func TestSendHandler(t *testing.T) {
 		})
 	}
 }
+
+func TestSendHandlerDispatchError(t *testing.T) {
+	srv := &Server{
+		config: &config.Config{
+			Http: config.HttpConfig{SecretApiKey: "test-secret"},
+		},
+		dispatcher: &mockDispatcher{err: errors.New("store is closed")},
+	}
+	srv.keys = newKeyRegistry(srv.config.Http)
+
+	req := httptest.NewRequest(http.MethodPost, "/send", strings.NewReader(`{"message": "hello"}`))
+	req.Header.Set("X-Secret", "test-secret")
+	rec := httptest.NewRecorder()
+
+	srv.sendHandler(rec, req)
+
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+}
+
+func TestWebhookHandlerRoute(t *testing.T) {
+	for route, wantStatus := range map[string]int{"": http.StatusOK, "ci": http.StatusOK, "billing": http.StatusNotFound} {
+		dispatcher := &mockDispatcher{}
+		srv := &Server{
+			config: &config.Config{
+				Http:   config.HttpConfig{SecretApiKey: "test-secret"},
+				Routes: map[string]config.RouteConfig{"ci": {ChatID: -100123}},
+			},
+			dispatcher: dispatcher,
+		}
+		srv.keys = newKeyRegistry(srv.config.Http)
+
+		req := httptest.NewRequest(http.MethodPost, "/webhook/"+route, strings.NewReader(`{"content": "deployed"}`))
+		req.Header.Set("X-Secret", "test-secret")
+		req.SetPathValue("name", route)
+		rec := httptest.NewRecorder()
+
+		srv.webhookHandler(rec, req)
+
+		require.Equal(t, wantStatus, rec.Code, route)
+		if wantStatus == http.StatusOK {
+			require.Len(t, dispatcher.payloads, 1)
+			assert.Equal(t, route, dispatcher.payloads[0].Route)
+		}
+	}
+}
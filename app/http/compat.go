@@ -0,0 +1,95 @@
+package http
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"log"
+	"maps"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/pkarpovich/tg-relay-bot/app/config"
+)
+
+// compatResponder writes the success response a service's clients expect.
+type compatResponder func(w http.ResponseWriter, r *http.Request, id string)
+
+// handleCompat registers an endpoint that accepts another chat service's incoming
+// webhook format at /compat/<name>/{token}.
+func (s *Server) handleCompat(mux *http.ServeMux, name string, convert converter, respond compatResponder) {
+	mux.HandleFunc("POST /compat/"+name+"/{token}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		body, ok := s.readBody(w, r)
+		if !ok {
+			return
+		}
+		source, route, ok := s.authorizeCompat(w, r, body)
+		if !ok {
+			return
+		}
+
+		payload, err := convert(r, body)
+		if err != nil {
+			s.respondWithError(w, fmt.Errorf("parse %s message: %w", name, err), http.StatusBadRequest)
+			return
+		}
+		payload.Route = route
+
+		log.Printf("[INFO] Received %s message from %q", name, source)
+		id, err := s.dispatchOnce(w, r, name, sourceCaller(source), payload, time.Time{})
+		if err != nil {
+			s.respondWithError(w, err, http.StatusInternalServerError)
+			return
+		}
+		respond(w, r, id)
+	})
+}
+
+// authorizeCompat finds the webhook source whose token is in the path, and checks its
+// signature when it has one.
+func (s *Server) authorizeCompat(w http.ResponseWriter, r *http.Request, body []byte) (string, string, bool) {
+	name, source, ok := s.sourceByToken(r.PathValue("token"))
+	if !ok {
+		s.respondWithError(w, errInvalidToken, http.StatusUnauthorized)
+		return "", "", false
+	}
+	if !s.authorizeSource(w, r, source, body) {
+		return "", "", false
+	}
+	return name, source.Route, true
+}
+
+// sourceByToken finds the webhook source with the token. Every source is compared so
+// the lookup takes the same time whichever one matches.
+func (s *Server) sourceByToken(token string) (string, config.WebhookConfig, bool) {
+	var name string
+	var source config.WebhookConfig
+	for _, n := range slices.Sorted(maps.Keys(s.config.Webhooks)) {
+		candidate := s.config.Webhooks[n]
+		if candidate.Token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(candidate.Token)) == 1 {
+			name, source = n, candidate
+		}
+	}
+	return name, source, name != ""
+}
+
+// respondSlack answers like Slack, with a plain-text ok.
+func respondSlack(w http.ResponseWriter, _ *http.Request, _ string) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write([]byte("ok")); err != nil {
+		log.Printf("[ERROR] Failed to write response: %s", err)
+	}
+}
+
+// respondDiscord answers like Discord: no content, or the message ID when the client
+// asks to wait for the message.
+func (s *Server) respondDiscord(w http.ResponseWriter, r *http.Request, id string) {
+	if r.URL.Query().Get("wait") != "true" {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	s.respondWithJSON(w, SendResponse{Ok: true, ID: id})
+}
@@ -0,0 +1,59 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pkarpovich/tg-relay-bot/app/config"
+)
+
+func TestCompatEndpoints(t *testing.T) {
+	tests := []struct {
+		name       string
+		target     string
+		body       string
+		wantStatus int
+		wantBody   string
+		wantRoute  string
+	}{
+		{name: "slack", target: "/compat/slack/ci-token", body: `{"text": "hi"}`, wantStatus: http.StatusOK, wantBody: "ok", wantRoute: "ci"},
+		{name: "discord", target: "/compat/discord/ops-token", body: `{"content": "hi"}`, wantStatus: http.StatusNoContent, wantRoute: "ops"},
+		{name: "discord wait", target: "/compat/discord/ops-token?wait=true", body: `{"content": "hi"}`, wantStatus: http.StatusOK, wantBody: `"ok":true`, wantRoute: "ops"},
+		{name: "unknown token", target: "/compat/slack/nope", body: `{"text": "hi"}`, wantStatus: http.StatusUnauthorized},
+		{name: "signed source without signature", target: "/compat/slack/signed-token", body: `{"text": "hi"}`, wantStatus: http.StatusUnauthorized},
+		{name: "invalid payload", target: "/compat/slack/ci-token", body: `{}`, wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dispatcher := &mockDispatcher{}
+			srv := CreateServer(&config.Config{
+				Routes: map[string]config.RouteConfig{"ci": {ChatID: -1001}, "ops": {ChatID: -1002}},
+				Webhooks: map[string]config.WebhookConfig{
+					"jenkins": {Route: "ci", Token: "ci-token"},
+					"backups": {Route: "ops", Token: "ops-token"},
+					"signed":  {Token: "signed-token", HMACSecret: "s3cret"},
+				},
+			}, dispatcher, nil, nil, nil)
+
+			req := httptest.NewRequest(http.MethodPost, tt.target, strings.NewReader(tt.body))
+			rec := httptest.NewRecorder()
+			srv.server.Handler.ServeHTTP(rec, req)
+
+			require.Equal(t, tt.wantStatus, rec.Code, rec.Body.String())
+			if tt.wantRoute == "" {
+				assert.Empty(t, dispatcher.payloads)
+				return
+			}
+			assert.Contains(t, rec.Body.String(), tt.wantBody)
+			require.Len(t, dispatcher.payloads, 1)
+			assert.Equal(t, tt.wantRoute, dispatcher.payloads[0].Route)
+			assert.Equal(t, "hi", dispatcher.payloads[0].Text)
+		})
+	}
+}
@@ -0,0 +1,161 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/pkarpovich/tg-relay-bot/app/events"
+)
+
+type DeadLettersResponse struct {
+	DeadLetters []events.DeadLetter `json:"dead_letters"`
+}
+
+type PurgeResponse struct {
+	Ok     bool `json:"ok"`
+	Purged int  `json:"purged"`
+}
+
+func (s *Server) listDeadLettersHandler(w http.ResponseWriter, r *http.Request) {
+	key, ok := s.authorize(w, r, endpointDeadLetters)
+	if !ok {
+		return
+	}
+
+	deadLetters, err := s.deadLetters.List()
+	if err != nil {
+		s.respondWithError(w, err, http.StatusInternalServerError)
+		return
+	}
+	deadLetters = slices.DeleteFunc(deadLetters, func(dl events.DeadLetter) bool {
+		return !key.allowsRoute(dl.Payload.Route)
+	})
+
+	s.respondWithJSON(w, DeadLettersResponse{DeadLetters: deadLetters})
+}
+
+func (s *Server) getDeadLetterHandler(w http.ResponseWriter, r *http.Request) {
+	deadLetter, ok := s.authorizedDeadLetter(w, r)
+	if !ok {
+		return
+	}
+
+	s.respondWithJSON(w, deadLetter)
+}
+
+func (s *Server) replayDeadLetterHandler(w http.ResponseWriter, r *http.Request) {
+	deadLetter, ok := s.authorizedDeadLetter(w, r)
+	if !ok {
+		return
+	}
+
+	if err := s.deadLetters.Replay(deadLetter.ID); err != nil {
+		s.respondWithError(w, err, deadLetterErrorStatus(err))
+		return
+	}
+
+	log.Printf("[INFO] Replaying dead letter %d", deadLetter.ID)
+	s.respondWithJSON(w, HealthResponse{Ok: true})
+}
+
+func (s *Server) deleteDeadLetterHandler(w http.ResponseWriter, r *http.Request) {
+	deadLetter, ok := s.authorizedDeadLetter(w, r)
+	if !ok {
+		return
+	}
+
+	if err := s.deadLetters.Delete(deadLetter.ID); err != nil {
+		s.respondWithError(w, err, deadLetterErrorStatus(err))
+		return
+	}
+
+	s.respondWithJSON(w, HealthResponse{Ok: true})
+}
+
+// purgeDeadLettersHandler purges every dead letter, or only the ones for the routes
+// the API key is limited to.
+func (s *Server) purgeDeadLettersHandler(w http.ResponseWriter, r *http.Request) {
+	key, ok := s.authorize(w, r, endpointDeadLetters)
+	if !ok {
+		return
+	}
+
+	var n int
+	var err error
+	if key.allowsAllRoutes() {
+		n, err = s.deadLetters.Purge()
+	} else {
+		n, err = s.purgeRoutes(key)
+	}
+	if err != nil {
+		s.respondWithError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("[INFO] Purged %d dead letters", n)
+	s.respondWithJSON(w, PurgeResponse{Ok: true, Purged: n})
+}
+
+func (s *Server) purgeRoutes(key *apiKey) (int, error) {
+	deadLetters, err := s.deadLetters.List()
+	if err != nil {
+		return 0, err
+	}
+
+	var n int
+	for _, dl := range deadLetters {
+		if !key.allowsRoute(dl.Payload.Route) {
+			continue
+		}
+		if err := s.deadLetters.Delete(dl.ID); err != nil && !errors.Is(err, events.ErrDeadLetterNotFound) {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// authorizedDeadLetter looks up the dead letter in the path and checks that the API
+// key may use its route.
+func (s *Server) authorizedDeadLetter(w http.ResponseWriter, r *http.Request) (events.DeadLetter, bool) {
+	key, ok := s.authorize(w, r, endpointDeadLetters)
+	if !ok {
+		return events.DeadLetter{}, false
+	}
+
+	id, err := deadLetterID(r)
+	if err != nil {
+		s.respondWithError(w, err, http.StatusBadRequest)
+		return events.DeadLetter{}, false
+	}
+
+	deadLetter, err := s.deadLetters.Get(id)
+	if err != nil {
+		s.respondWithError(w, err, deadLetterErrorStatus(err))
+		return events.DeadLetter{}, false
+	}
+	if !key.allowsRoute(deadLetter.Payload.Route) {
+		s.respondWithError(w, errRouteDenied, http.StatusForbidden)
+		return events.DeadLetter{}, false
+	}
+	return deadLetter, true
+}
+
+func deadLetterID(r *http.Request) (uint64, error) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid dead letter id %q", r.PathValue("id"))
+	}
+	return id, nil
+}
+
+func deadLetterErrorStatus(err error) int {
+	if errors.Is(err, events.ErrDeadLetterNotFound) {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
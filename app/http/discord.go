@@ -0,0 +1,117 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	tbapi "github.com/OvyFlash/telegram-bot-api"
+	"github.com/pkarpovich/tg-relay-bot/app/events"
+)
+
+var (
+	discordEmphasis = []emphasis{
+		{marker: "**", tag: "b"},
+		{marker: "__", tag: "u"},
+		{marker: "~~", tag: "s"},
+		{marker: "||", tag: "tg-spoiler"},
+		{marker: "*", tag: "i"},
+		{marker: "_", tag: "i", boundary: true},
+	}
+	discordDialect = markdownDialect{languages: true, inline: linkedMarkdown(discordEmphasis)}
+)
+
+type discordEmbed struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	URL         string `json:"url"`
+	Author      struct {
+		Name string `json:"name"`
+		URL  string `json:"url"`
+	} `json:"author"`
+	Fields []struct {
+		Name  string `json:"name"`
+		Value string `json:"value"`
+	} `json:"fields"`
+	Footer struct {
+		Text string `json:"text"`
+	} `json:"footer"`
+	Image struct {
+		URL string `json:"url"`
+	} `json:"image"`
+}
+
+// discordMessage is the body Discord webhooks accept as JSON.
+type discordMessage struct {
+	Content  string         `json:"content"`
+	Username string         `json:"username"`
+	Embeds   []discordEmbed `json:"embeds"`
+}
+
+// convertDiscord renders a Discord webhook message: its content followed by its
+// embeds. The first embed image is attached as a photo when it can be downloaded.
+func (s *Server) convertDiscord(r *http.Request, body []byte) (events.MessagePayload, error) {
+	var msg discordMessage
+	if err := json.Unmarshal(body, &msg); err != nil {
+		return events.MessagePayload{}, err
+	}
+
+	var parts []string
+	if msg.Content != "" {
+		parts = append(parts, discordMarkdown(msg.Content))
+	}
+	imageURL := ""
+	for _, e := range msg.Embeds {
+		if text := discordEmbedText(e); text != "" {
+			parts = append(parts, text)
+		}
+		if imageURL == "" {
+			imageURL = e.Image.URL
+		}
+	}
+
+	if len(parts) == 0 {
+		return events.MessagePayload{}, errors.New("content or embeds are required")
+	}
+	if msg.Username != "" {
+		parts = append([]string{"<b>" + events.EscapeHTML(msg.Username) + "</b>"}, parts...)
+	}
+
+	payload := events.MessagePayload{Text: strings.Join(parts, "\n\n"), ParseMode: tbapi.ModeHTML}
+	if imageURL != "" {
+		image, err := s.fetchImage(r.Context(), imageURL)
+		if err != nil {
+			log.Printf("[WARN] Failed to fetch discord embed image %s: %s", imageURL, err)
+		} else {
+			payload.Attachments = []events.Attachment{image}
+		}
+	}
+	return payload, nil
+}
+
+func discordEmbedText(e discordEmbed) string {
+	var lines []string
+	if e.Author.Name != "" {
+		lines = append(lines, "<i>"+htmlLink(e.Author.URL, e.Author.Name)+"</i>")
+	}
+	if e.Title != "" {
+		lines = append(lines, "<b>"+htmlLink(e.URL, e.Title)+"</b>")
+	}
+	if e.Description != "" {
+		lines = append(lines, discordMarkdown(e.Description))
+	}
+	for _, f := range e.Fields {
+		lines = append(lines, "<b>"+events.EscapeHTML(f.Name)+"</b>: "+discordMarkdown(f.Value))
+	}
+	if e.Footer.Text != "" {
+		lines = append(lines, "<i>"+events.EscapeHTML(e.Footer.Text)+"</i>")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// discordMarkdown converts Discord's markdown, including masked links, to Telegram HTML.
+func discordMarkdown(text string) string {
+	return discordDialect.convert(text)
+}
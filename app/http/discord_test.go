@@ -0,0 +1,92 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiscordMarkdown(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{name: "emphasis", text: "**bold** *it* __under__ ~~gone~~ ||secret||", want: "<b>bold</b> <i>it</i> <u>under</u> <s>gone</s> <tg-spoiler>secret</tg-spoiler>"},
+		{name: "masked link", text: "[build #7](https://ci.local/7) & more", want: `<a href="https://ci.local/7">build #7</a> &amp; more`},
+		{name: "unsafe link", text: "[x](javascript:alert(1))", want: "[x](javascript:alert(1))"},
+		{name: "code block", text: "```sh\nrm -rf <dir>\n```", want: "<pre>rm -rf &lt;dir&gt;</pre>"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, discordMarkdown(tt.text))
+		})
+	}
+}
+
+func TestConvertDiscord(t *testing.T) {
+	images := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		_, _ = w.Write([]byte("png"))
+	}))
+	defer images.Close()
+
+	tests := []struct {
+		name      string
+		body      string
+		want      string
+		wantImage bool
+		wantErr   bool
+	}{
+		{
+			name: "content",
+			body: `{"content": "Deploy **done**", "username": "ci"}`,
+			want: "<b>ci</b>\n\nDeploy <b>done</b>",
+		},
+		{
+			name: "embeds with image",
+			body: `{
+				"content": "New release",
+				"embeds": [{
+					"author": {"name": "acme", "url": "https://github.com/acme"},
+					"title": "v2.0.0",
+					"url": "https://github.com/acme/api/releases/v2.0.0",
+					"description": "Adds *retries*",
+					"fields": [{"name": "Changes", "value": "12", "inline": true}],
+					"footer": {"text": "GitHub"},
+					"image": {"url": "` + images.URL + `/banner.png"}
+				}]
+			}`,
+			want: "New release\n\n<i><a href=\"https://github.com/acme\">acme</a></i>\n" +
+				"<b><a href=\"https://github.com/acme/api/releases/v2.0.0\">v2.0.0</a></b>\nAdds <i>retries</i>\n<b>Changes</b>: 12\n<i>GitHub</i>",
+			wantImage: true,
+		},
+		{name: "empty", body: `{"embeds": []}`, wantErr: true},
+		{name: "invalid json", body: `nope`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := &Server{client: images.Client()}
+			req := httptest.NewRequest(http.MethodPost, "/compat/discord/token", nil)
+
+			payload, err := srv.convertDiscord(req, []byte(tt.body))
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, payload.Text)
+			if tt.wantImage {
+				require.Len(t, payload.Attachments, 1)
+				assert.Equal(t, "image/png", payload.Attachments[0].ContentType)
+			} else {
+				assert.Empty(t, payload.Attachments)
+			}
+		})
+	}
+}
@@ -0,0 +1,257 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	tbapi "github.com/OvyFlash/telegram-bot-api"
+	"github.com/pkarpovich/tg-relay-bot/app/events"
+)
+
+const maxListedCommits = 5
+
+type githubCommit struct {
+	ID      string `json:"id"`
+	Message string `json:"message"`
+	URL     string `json:"url"`
+	Author  struct {
+		Name string `json:"name"`
+	} `json:"author"`
+}
+
+// githubPayload holds the fields of the GitHub events relayed by the receiver; the
+// event itself comes from the X-GitHub-Event header.
+type githubPayload struct {
+	Action  string         `json:"action"`
+	Ref     string         `json:"ref"`
+	Created bool           `json:"created"`
+	Deleted bool           `json:"deleted"`
+	Forced  bool           `json:"forced"`
+	Compare string         `json:"compare"`
+	Commits []githubCommit `json:"commits"`
+
+	Repository struct {
+		FullName string `json:"full_name"`
+	} `json:"repository"`
+	Sender struct {
+		Login string `json:"login"`
+	} `json:"sender"`
+
+	PullRequest *struct {
+		Number  int    `json:"number"`
+		Title   string `json:"title"`
+		HTMLURL string `json:"html_url"`
+		Merged  bool   `json:"merged"`
+		Base    struct {
+			Ref string `json:"ref"`
+		} `json:"base"`
+	} `json:"pull_request"`
+	Issue *struct {
+		Number  int    `json:"number"`
+		Title   string `json:"title"`
+		HTMLURL string `json:"html_url"`
+	} `json:"issue"`
+	Release *struct {
+		TagName    string `json:"tag_name"`
+		Name       string `json:"name"`
+		HTMLURL    string `json:"html_url"`
+		Prerelease bool   `json:"prerelease"`
+	} `json:"release"`
+	WorkflowRun *struct {
+		Name       string `json:"name"`
+		RunNumber  int    `json:"run_number"`
+		HeadBranch string `json:"head_branch"`
+		Conclusion string `json:"conclusion"`
+		HTMLURL    string `json:"html_url"`
+	} `json:"workflow_run"`
+}
+
+// pushEvent is a push to GitHub or GitLab. total is the number of pushed commits,
+// which can be more than the payload lists.
+type pushEvent struct {
+	repo, branch, tag, user  string
+	created, deleted, forced bool
+	compareURL               string
+	commits                  []pushCommit
+	total                    int
+}
+
+type pushCommit struct {
+	id, message, url, author string
+}
+
+// convertGitHub renders push, pull_request, workflow_run, release and issues events.
+// Other events, actions nobody needs to hear about and events left out by the source's
+// filters are ignored.
+func (s *Server) convertGitHub(r *http.Request, body []byte) (events.MessagePayload, error) {
+	event := r.Header.Get("X-GitHub-Event")
+	if event == "" {
+		return events.MessagePayload{}, errors.New("missing X-GitHub-Event header")
+	}
+
+	var p githubPayload
+	if err := json.Unmarshal(body, &p); err != nil {
+		return events.MessagePayload{}, err
+	}
+	repo := p.Repository.FullName
+
+	var text, branch string
+	switch event {
+	case "push":
+		push := pushEvent{repo: repo, user: p.Sender.Login, created: p.Created, deleted: p.Deleted, forced: p.Forced, compareURL: p.Compare, total: len(p.Commits)}
+		push.branch, push.tag = splitRef(p.Ref)
+		for _, c := range p.Commits {
+			push.commits = append(push.commits, pushCommit{id: c.ID, message: c.Message, url: c.URL, author: c.Author.Name})
+		}
+		branch, text = push.branch, push.summary()
+	case "pull_request":
+		pr := p.PullRequest
+		if pr == nil {
+			return events.MessagePayload{}, errors.New("missing pull_request")
+		}
+		action := p.Action
+		if action == "closed" && pr.Merged {
+			action = "merged"
+		}
+		if !slices.Contains([]string{"opened", "reopened", "closed", "merged", "ready_for_review"}, action) {
+			return events.MessagePayload{}, fmt.Errorf("%w: %s action %q", errIgnored, event, p.Action)
+		}
+		if action == "ready_for_review" {
+			action = "marked as ready for review"
+		}
+		branch = pr.Base.Ref
+		text = fmt.Sprintf("%s %s %s pull request %s", repoHeader(repo, branch), events.EscapeHTML(p.Sender.Login),
+			action, htmlLink(pr.HTMLURL, fmt.Sprintf("#%d %s", pr.Number, pr.Title)))
+	case "issues":
+		if p.Issue == nil {
+			return events.MessagePayload{}, errors.New("missing issue")
+		}
+		if !slices.Contains([]string{"opened", "reopened", "closed"}, p.Action) {
+			return events.MessagePayload{}, fmt.Errorf("%w: %s action %q", errIgnored, event, p.Action)
+		}
+		text = fmt.Sprintf("%s %s %s issue %s", repoHeader(repo, ""), events.EscapeHTML(p.Sender.Login),
+			p.Action, htmlLink(p.Issue.HTMLURL, fmt.Sprintf("#%d %s", p.Issue.Number, p.Issue.Title)))
+	case "release":
+		release := p.Release
+		if release == nil {
+			return events.MessagePayload{}, errors.New("missing release")
+		}
+		if p.Action != "published" {
+			return events.MessagePayload{}, fmt.Errorf("%w: %s action %q", errIgnored, event, p.Action)
+		}
+		name := release.Name
+		if name == "" {
+			name = release.TagName
+		}
+		kind := "release"
+		if release.Prerelease {
+			kind = "pre-release"
+		}
+		text = fmt.Sprintf("%s %s published %s %s", repoHeader(repo, ""), events.EscapeHTML(p.Sender.Login),
+			kind, htmlLink(release.HTMLURL, name))
+	case "workflow_run":
+		run := p.WorkflowRun
+		if run == nil {
+			return events.MessagePayload{}, errors.New("missing workflow_run")
+		}
+		if p.Action != "completed" {
+			return events.MessagePayload{}, fmt.Errorf("%w: %s action %q", errIgnored, event, p.Action)
+		}
+		branch = run.HeadBranch
+		text = fmt.Sprintf("%s Workflow %s %s", repoHeader(repo, branch),
+			htmlLink(run.HTMLURL, fmt.Sprintf("%s #%d", run.Name, run.RunNumber)), outcome(run.Conclusion))
+	default:
+		return events.MessagePayload{}, fmt.Errorf("%w: github event %q", errIgnored, event)
+	}
+
+	if !s.relays("github", event, branch) {
+		return events.MessagePayload{}, fmt.Errorf("%w: github %s on %q filtered out", errIgnored, event, branch)
+	}
+	return events.MessagePayload{Text: text, ParseMode: tbapi.ModeHTML}, nil
+}
+
+// splitRef returns the branch or the tag a git ref points to.
+func splitRef(ref string) (branch, tag string) {
+	if tag, ok := strings.CutPrefix(ref, "refs/tags/"); ok {
+		return "", tag
+	}
+	return strings.TrimPrefix(ref, "refs/heads/"), ""
+}
+
+// repoHeader renders the repository and, when there is one, the branch an event is about.
+func repoHeader(repo, branch string) string {
+	if branch != "" {
+		repo += ":" + branch
+	}
+	return "<b>[" + events.EscapeHTML(repo) + "]</b>"
+}
+
+// summary renders the push with its first commits.
+func (p pushEvent) summary() string {
+	user := events.EscapeHTML(p.user)
+	if p.tag != "" {
+		verb := "pushed"
+		if p.deleted {
+			verb = "deleted"
+		}
+		return fmt.Sprintf("%s %s %s tag <code>%s</code>", repoHeader(p.repo, ""), user, verb, events.EscapeHTML(p.tag))
+	}
+
+	header := repoHeader(p.repo, p.branch)
+	switch {
+	case p.deleted:
+		return fmt.Sprintf("%s %s deleted the branch", header, user)
+	case p.created && p.total == 0:
+		return fmt.Sprintf("%s %s created the branch", header, user)
+	}
+
+	var sb strings.Builder
+	count := fmt.Sprintf("%d new commits", p.total)
+	if p.total == 1 {
+		count = "1 new commit"
+	}
+	verb := "pushed"
+	if p.forced {
+		verb = "force-pushed"
+	}
+	sb.WriteString(fmt.Sprintf("%s %s %s %s", header, user, verb, htmlLink(p.compareURL, count)))
+
+	for i, c := range p.commits {
+		if i == maxListedCommits {
+			break
+		}
+		id := c.id
+		if len(id) > 7 {
+			id = id[:7]
+		}
+		message, _, _ := strings.Cut(c.message, "\n")
+		sb.WriteString(fmt.Sprintf("\n• %s %s", htmlLink(c.url, id), events.EscapeHTML(message)))
+		if c.author != "" {
+			sb.WriteString(" — " + events.EscapeHTML(c.author))
+		}
+	}
+	if more := p.total - min(len(p.commits), maxListedCommits); more > 0 {
+		sb.WriteString(fmt.Sprintf("\n<i>and %d more</i>", more))
+	}
+	return sb.String()
+}
+
+// outcome describes how a CI run ended.
+func outcome(conclusion string) string {
+	switch conclusion {
+	case "success":
+		return "succeeded"
+	case "failure", "failed":
+		return "failed"
+	case "cancelled", "canceled":
+		return "was cancelled"
+	case "":
+		return "finished"
+	default:
+		return "finished: " + events.EscapeHTML(strings.ReplaceAll(conclusion, "_", " "))
+	}
+}
@@ -0,0 +1,184 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pkarpovich/tg-relay-bot/app/config"
+)
+
+const githubPushBody = `{
+  "ref": "refs/heads/main",
+  "compare": "https://github.com/acme/api/compare/abc...def",
+  "repository": {"full_name": "acme/api"},
+  "sender": {"login": "octocat"},
+  "commits": [
+    {"id": "1234567890abcdef", "message": "Fix <login> redirect\n\nLong description", "url": "https://github.com/acme/api/commit/1234567", "author": {"name": "Mona"}},
+    {"id": "abcdef1234567890", "message": "Bump deps", "url": "https://github.com/acme/api/commit/abcdef1", "author": {"name": "Hubot"}}
+  ]
+}`
+
+func TestConvertGitHub(t *testing.T) {
+	tests := []struct {
+		name     string
+		event    string
+		body     string
+		want     string
+		wantErr  bool
+		ignored  bool
+		webhooks map[string]config.WebhookConfig
+	}{
+		{
+			name:  "push",
+			event: "push",
+			body:  githubPushBody,
+			want: `<b>[acme/api:main]</b> octocat pushed <a href="https://github.com/acme/api/compare/abc...def">2 new commits</a>
+• <a href="https://github.com/acme/api/commit/1234567">1234567</a> Fix &lt;login&gt; redirect — Mona
+• <a href="https://github.com/acme/api/commit/abcdef1">abcdef1</a> Bump deps — Hubot`,
+		},
+		{
+			name:  "tag push",
+			event: "push",
+			body:  `{"ref": "refs/tags/v1.2.0", "created": true, "repository": {"full_name": "acme/api"}, "sender": {"login": "octocat"}}`,
+			want:  `<b>[acme/api]</b> octocat pushed tag <code>v1.2.0</code>`,
+		},
+		{
+			name:  "deleted branch",
+			event: "push",
+			body:  `{"ref": "refs/heads/feature", "deleted": true, "repository": {"full_name": "acme/api"}, "sender": {"login": "octocat"}}`,
+			want:  `<b>[acme/api:feature]</b> octocat deleted the branch`,
+		},
+		{
+			name:  "merged pull request",
+			event: "pull_request",
+			body:  `{"action": "closed", "repository": {"full_name": "acme/api"}, "sender": {"login": "octocat"}, "pull_request": {"number": 42, "title": "Add retries", "html_url": "https://github.com/acme/api/pull/42", "merged": true, "base": {"ref": "main"}}}`,
+			want:  `<b>[acme/api:main]</b> octocat merged pull request <a href="https://github.com/acme/api/pull/42">#42 Add retries</a>`,
+		},
+		{
+			name:    "pull request synchronize",
+			event:   "pull_request",
+			body:    `{"action": "synchronize", "pull_request": {"number": 42}}`,
+			ignored: true,
+		},
+		{
+			name:  "failed workflow run",
+			event: "workflow_run",
+			body:  `{"action": "completed", "repository": {"full_name": "acme/api"}, "workflow_run": {"name": "CI", "run_number": 7, "head_branch": "main", "conclusion": "failure", "html_url": "https://github.com/acme/api/actions/runs/1"}}`,
+			want:  `<b>[acme/api:main]</b> Workflow <a href="https://github.com/acme/api/actions/runs/1">CI #7</a> failed`,
+		},
+		{
+			name:  "published pre-release",
+			event: "release",
+			body:  `{"action": "published", "repository": {"full_name": "acme/api"}, "sender": {"login": "octocat"}, "release": {"tag_name": "v2.0.0-rc1", "html_url": "https://github.com/acme/api/releases/v2.0.0-rc1", "prerelease": true}}`,
+			want:  `<b>[acme/api]</b> octocat published pre-release <a href="https://github.com/acme/api/releases/v2.0.0-rc1">v2.0.0-rc1</a>`,
+		},
+		{
+			name:  "opened issue",
+			event: "issues",
+			body:  `{"action": "opened", "repository": {"full_name": "acme/api"}, "sender": {"login": "octocat"}, "issue": {"number": 5, "title": "Crash on start", "html_url": "https://github.com/acme/api/issues/5"}}`,
+			want:  `<b>[acme/api]</b> octocat opened issue <a href="https://github.com/acme/api/issues/5">#5 Crash on start</a>`,
+		},
+		{name: "ping", event: "ping", body: `{"zen": "Keep it logically awesome."}`, ignored: true},
+		{name: "missing event header", body: githubPushBody, wantErr: true},
+		{name: "invalid json", event: "push", body: `nope`, wantErr: true},
+		{
+			name:     "event filtered out",
+			event:    "push",
+			body:     githubPushBody,
+			webhooks: map[string]config.WebhookConfig{"github": {Events: []string{"release"}}},
+			ignored:  true,
+		},
+		{
+			name:     "branch filtered out",
+			event:    "push",
+			body:     githubPushBody,
+			webhooks: map[string]config.WebhookConfig{"github": {Branches: []string{"release/*"}}},
+			ignored:  true,
+		},
+		{
+			name:     "branch filter doesn't apply to issues",
+			event:    "issues",
+			body:     `{"action": "closed", "repository": {"full_name": "acme/api"}, "sender": {"login": "octocat"}, "issue": {"number": 5, "title": "Crash", "html_url": "https://github.com/acme/api/issues/5"}}`,
+			webhooks: map[string]config.WebhookConfig{"github": {Branches: []string{"main"}}},
+			want:     `<b>[acme/api]</b> octocat closed issue <a href="https://github.com/acme/api/issues/5">#5 Crash</a>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := &Server{config: &config.Config{Webhooks: tt.webhooks}}
+			req := httptest.NewRequest(http.MethodPost, "/webhook/github", nil)
+			if tt.event != "" {
+				req.Header.Set("X-GitHub-Event", tt.event)
+			}
+
+			payload, err := srv.convertGitHub(req, []byte(tt.body))
+			switch {
+			case tt.ignored:
+				assert.ErrorIs(t, err, errIgnored)
+			case tt.wantErr:
+				require.Error(t, err)
+				assert.NotErrorIs(t, err, errIgnored)
+			default:
+				require.NoError(t, err)
+				assert.Equal(t, tt.want, payload.Text)
+				assert.Equal(t, "HTML", payload.ParseMode)
+			}
+		})
+	}
+}
+
+func TestPushSummaryTruncatesCommits(t *testing.T) {
+	push := pushEvent{repo: "acme/api", branch: "main", user: "octocat", total: 9}
+	for range 7 {
+		push.commits = append(push.commits, pushCommit{id: "1234567890", message: "change"})
+	}
+
+	summary := push.summary()
+	assert.Equal(t, maxListedCommits, strings.Count(summary, "• "))
+	assert.True(t, strings.HasSuffix(summary, "<i>and 4 more</i>"), summary)
+}
+
+func TestGitHubReceiver(t *testing.T) {
+	tests := []struct {
+		name       string
+		event      string
+		signature  string
+		wantStatus int
+		wantSent   bool
+	}{
+		{name: "signed push", event: "push", signature: sign("s3cret", githubPushBody), wantStatus: http.StatusOK, wantSent: true},
+		{name: "bad signature", event: "push", signature: sign("wrong", githubPushBody), wantStatus: http.StatusUnauthorized},
+		{name: "ping is acknowledged", event: "ping", signature: sign("s3cret", githubPushBody), wantStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dispatcher := &mockDispatcher{}
+			srv := CreateServer(&config.Config{
+				Routes:   map[string]config.RouteConfig{"dev": {ChatID: -1001}},
+				Webhooks: map[string]config.WebhookConfig{"github": {Route: "dev", HMACSecret: "s3cret"}},
+			}, dispatcher, nil, nil, nil)
+
+			req := httptest.NewRequest(http.MethodPost, "/webhook/github", strings.NewReader(githubPushBody))
+			req.Header.Set("X-GitHub-Event", tt.event)
+			req.Header.Set("X-Hub-Signature-256", tt.signature)
+			rec := httptest.NewRecorder()
+			srv.server.Handler.ServeHTTP(rec, req)
+
+			require.Equal(t, tt.wantStatus, rec.Code, rec.Body.String())
+			if !tt.wantSent {
+				assert.Empty(t, dispatcher.payloads)
+				return
+			}
+			require.Len(t, dispatcher.payloads, 1)
+			assert.Equal(t, "dev", dispatcher.payloads[0].Route)
+			assert.Contains(t, dispatcher.payloads[0].Text, "octocat pushed")
+		})
+	}
+}
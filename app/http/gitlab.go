@@ -0,0 +1,141 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	tbapi "github.com/OvyFlash/telegram-bot-api"
+	"github.com/pkarpovich/tg-relay-bot/app/events"
+)
+
+const gitlabBlankSHA = "0000000000000000000000000000000000000000"
+
+// gitlabActions maps the merge request and issue actions that are relayed to how
+// they read in a message.
+var gitlabActions = map[string]string{"open": "opened", "reopen": "reopened", "close": "closed", "merge": "merged"}
+
+// gitlabPayload holds the fields of the GitLab events relayed by the receiver, which
+// are told apart by object_kind.
+type gitlabPayload struct {
+	ObjectKind        string `json:"object_kind"`
+	Ref               string `json:"ref"`
+	Before            string `json:"before"`
+	After             string `json:"after"`
+	UserUsername      string `json:"user_username"`
+	TotalCommitsCount int    `json:"total_commits_count"`
+	Commits           []struct {
+		ID      string `json:"id"`
+		Message string `json:"message"`
+		URL     string `json:"url"`
+		Author  struct {
+			Name string `json:"name"`
+		} `json:"author"`
+	} `json:"commits"`
+
+	User struct {
+		Username string `json:"username"`
+	} `json:"user"`
+	Project struct {
+		PathWithNamespace string `json:"path_with_namespace"`
+		WebURL            string `json:"web_url"`
+	} `json:"project"`
+	ObjectAttributes struct {
+		ID           int    `json:"id"`
+		IID          int    `json:"iid"`
+		Title        string `json:"title"`
+		URL          string `json:"url"`
+		Action       string `json:"action"`
+		TargetBranch string `json:"target_branch"`
+		Ref          string `json:"ref"`
+		Tag          bool   `json:"tag"`
+		Status       string `json:"status"`
+	} `json:"object_attributes"`
+
+	// Release events carry their fields at the top level.
+	Tag    string `json:"tag"`
+	Name   string `json:"name"`
+	URL    string `json:"url"`
+	Action string `json:"action"`
+}
+
+// convertGitLab renders push, tag_push, merge_request, pipeline, release and issue
+// events. Other events, actions nobody needs to hear about and events left out by the
+// source's filters are ignored.
+func (s *Server) convertGitLab(_ *http.Request, body []byte) (events.MessagePayload, error) {
+	var p gitlabPayload
+	if err := json.Unmarshal(body, &p); err != nil {
+		return events.MessagePayload{}, err
+	}
+	if p.ObjectKind == "" {
+		return events.MessagePayload{}, errors.New("missing object_kind")
+	}
+	repo := p.Project.PathWithNamespace
+	attrs := p.ObjectAttributes
+
+	var text, branch string
+	switch p.ObjectKind {
+	case "push", "tag_push":
+		push := pushEvent{
+			repo:    repo,
+			user:    p.UserUsername,
+			created: p.Before == gitlabBlankSHA,
+			deleted: p.After == gitlabBlankSHA,
+			total:   p.TotalCommitsCount,
+		}
+		push.branch, push.tag = splitRef(p.Ref)
+		if !push.created && !push.deleted && p.Project.WebURL != "" {
+			push.compareURL = fmt.Sprintf("%s/-/compare/%s...%s", p.Project.WebURL, p.Before, p.After)
+		}
+		for _, c := range p.Commits {
+			push.commits = append(push.commits, pushCommit{id: c.ID, message: c.Message, url: c.URL, author: c.Author.Name})
+		}
+		branch, text = push.branch, push.summary()
+	case "merge_request":
+		action, ok := gitlabActions[attrs.Action]
+		if !ok {
+			return events.MessagePayload{}, fmt.Errorf("%w: %s action %q", errIgnored, p.ObjectKind, attrs.Action)
+		}
+		branch = attrs.TargetBranch
+		text = fmt.Sprintf("%s %s %s merge request %s", repoHeader(repo, branch), events.EscapeHTML(p.User.Username),
+			action, htmlLink(attrs.URL, fmt.Sprintf("!%d %s", attrs.IID, attrs.Title)))
+	case "issue":
+		action, ok := gitlabActions[attrs.Action]
+		if !ok || attrs.Action == "merge" {
+			return events.MessagePayload{}, fmt.Errorf("%w: %s action %q", errIgnored, p.ObjectKind, attrs.Action)
+		}
+		text = fmt.Sprintf("%s %s %s issue %s", repoHeader(repo, ""), events.EscapeHTML(p.User.Username),
+			action, htmlLink(attrs.URL, fmt.Sprintf("#%d %s", attrs.IID, attrs.Title)))
+	case "pipeline":
+		if attrs.Status != "success" && attrs.Status != "failed" && attrs.Status != "canceled" {
+			return events.MessagePayload{}, fmt.Errorf("%w: %s status %q", errIgnored, p.ObjectKind, attrs.Status)
+		}
+		if !attrs.Tag {
+			branch = attrs.Ref
+		}
+		pipelineURL := attrs.URL
+		if pipelineURL == "" && p.Project.WebURL != "" {
+			pipelineURL = fmt.Sprintf("%s/-/pipelines/%d", p.Project.WebURL, attrs.ID)
+		}
+		text = fmt.Sprintf("%s Pipeline %s %s", repoHeader(repo, branch),
+			htmlLink(pipelineURL, fmt.Sprintf("#%d", attrs.ID)), outcome(attrs.Status))
+	case "release":
+		if p.Action != "create" {
+			return events.MessagePayload{}, fmt.Errorf("%w: %s action %q", errIgnored, p.ObjectKind, p.Action)
+		}
+		name := p.Name
+		if strings.TrimSpace(name) == "" {
+			name = p.Tag
+		}
+		text = fmt.Sprintf("%s Release %s published", repoHeader(repo, ""), htmlLink(p.URL, name))
+	default:
+		return events.MessagePayload{}, fmt.Errorf("%w: gitlab event %q", errIgnored, p.ObjectKind)
+	}
+
+	if !s.relays("gitlab", p.ObjectKind, branch) {
+		return events.MessagePayload{}, fmt.Errorf("%w: gitlab %s on %q filtered out", errIgnored, p.ObjectKind, branch)
+	}
+	return events.MessagePayload{Text: text, ParseMode: tbapi.ModeHTML}, nil
+}
@@ -0,0 +1,151 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pkarpovich/tg-relay-bot/app/config"
+)
+
+const gitlabPushBody = `{
+  "object_kind": "push",
+  "ref": "refs/heads/main",
+  "before": "95790bf891e76fee5e1747ab589903a6a1f80f22",
+  "after": "da1560886d4f094c3e6c9ef40349f7d38b5d27d7",
+  "user_username": "jsmith",
+  "total_commits_count": 1,
+  "project": {"path_with_namespace": "acme/web", "web_url": "https://gitlab.com/acme/web"},
+  "commits": [
+    {"id": "da1560886d4f094c3e6c9ef40349f7d38b5d27d7", "message": "Update README\n", "url": "https://gitlab.com/acme/web/-/commit/da15608", "author": {"name": "John Smith"}}
+  ]
+}`
+
+func TestConvertGitLab(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		want     string
+		wantErr  bool
+		ignored  bool
+		webhooks map[string]config.WebhookConfig
+	}{
+		{
+			name: "push",
+			body: gitlabPushBody,
+			want: `<b>[acme/web:main]</b> jsmith pushed <a href="https://gitlab.com/acme/web/-/compare/95790bf891e76fee5e1747ab589903a6a1f80f22...da1560886d4f094c3e6c9ef40349f7d38b5d27d7">1 new commit</a>
+• <a href="https://gitlab.com/acme/web/-/commit/da15608">da15608</a> Update README — John Smith`,
+		},
+		{
+			name: "new tag",
+			body: `{"object_kind": "tag_push", "ref": "refs/tags/v1.0.0", "before": "0000000000000000000000000000000000000000", "after": "82b3d5ae", "user_username": "jsmith", "project": {"path_with_namespace": "acme/web"}}`,
+			want: `<b>[acme/web]</b> jsmith pushed tag <code>v1.0.0</code>`,
+		},
+		{
+			name: "merged merge request",
+			body: `{"object_kind": "merge_request", "user": {"username": "jsmith"}, "project": {"path_with_namespace": "acme/web"}, "object_attributes": {"iid": 12, "title": "Add dark mode", "url": "https://gitlab.com/acme/web/-/merge_requests/12", "action": "merge", "target_branch": "main"}}`,
+			want: `<b>[acme/web:main]</b> jsmith merged merge request <a href="https://gitlab.com/acme/web/-/merge_requests/12">!12 Add dark mode</a>`,
+		},
+		{
+			name:    "merge request update",
+			body:    `{"object_kind": "merge_request", "object_attributes": {"action": "update"}}`,
+			ignored: true,
+		},
+		{
+			name: "failed pipeline",
+			body: `{"object_kind": "pipeline", "project": {"path_with_namespace": "acme/web", "web_url": "https://gitlab.com/acme/web"}, "object_attributes": {"id": 31, "ref": "main", "status": "failed"}}`,
+			want: `<b>[acme/web:main]</b> Pipeline <a href="https://gitlab.com/acme/web/-/pipelines/31">#31</a> failed`,
+		},
+		{
+			name:    "running pipeline",
+			body:    `{"object_kind": "pipeline", "object_attributes": {"id": 31, "ref": "main", "status": "running"}}`,
+			ignored: true,
+		},
+		{
+			name: "created release",
+			body: `{"object_kind": "release", "action": "create", "tag": "v1.0.0", "name": "First release", "url": "https://gitlab.com/acme/web/-/releases/v1.0.0", "project": {"path_with_namespace": "acme/web"}}`,
+			want: `<b>[acme/web]</b> Release <a href="https://gitlab.com/acme/web/-/releases/v1.0.0">First release</a> published`,
+		},
+		{
+			name: "reopened issue",
+			body: `{"object_kind": "issue", "user": {"username": "jsmith"}, "project": {"path_with_namespace": "acme/web"}, "object_attributes": {"iid": 3, "title": "Broken <nav>", "url": "https://gitlab.com/acme/web/-/issues/3", "action": "reopen"}}`,
+			want: `<b>[acme/web]</b> jsmith reopened issue <a href="https://gitlab.com/acme/web/-/issues/3">#3 Broken &lt;nav&gt;</a>`,
+		},
+		{name: "note", body: `{"object_kind": "note"}`, ignored: true},
+		{name: "missing object kind", body: `{}`, wantErr: true},
+		{
+			name:     "branch filter",
+			body:     gitlabPushBody,
+			webhooks: map[string]config.WebhookConfig{"gitlab": {Branches: []string{"release-*"}}},
+			ignored:  true,
+		},
+		{
+			name:     "event filter",
+			body:     gitlabPushBody,
+			webhooks: map[string]config.WebhookConfig{"gitlab": {Events: []string{"push"}, Branches: []string{"main"}}},
+			want: `<b>[acme/web:main]</b> jsmith pushed <a href="https://gitlab.com/acme/web/-/compare/95790bf891e76fee5e1747ab589903a6a1f80f22...da1560886d4f094c3e6c9ef40349f7d38b5d27d7">1 new commit</a>
+• <a href="https://gitlab.com/acme/web/-/commit/da15608">da15608</a> Update README — John Smith`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := &Server{config: &config.Config{Webhooks: tt.webhooks}}
+
+			payload, err := srv.convertGitLab(nil, []byte(tt.body))
+			switch {
+			case tt.ignored:
+				assert.ErrorIs(t, err, errIgnored)
+			case tt.wantErr:
+				require.Error(t, err)
+				assert.NotErrorIs(t, err, errIgnored)
+			default:
+				require.NoError(t, err)
+				assert.Equal(t, tt.want, payload.Text)
+			}
+		})
+	}
+}
+
+func TestGitLabReceiver(t *testing.T) {
+	tests := []struct {
+		name       string
+		target     string
+		token      string
+		wantStatus int
+	}{
+		{name: "token header", target: "/webhook/gitlab", token: "tok3n", wantStatus: http.StatusOK},
+		{name: "token in path", target: "/webhook/gitlab/tok3n", wantStatus: http.StatusOK},
+		{name: "wrong token", target: "/webhook/gitlab", token: "nope", wantStatus: http.StatusUnauthorized},
+		{name: "no token", target: "/webhook/gitlab", wantStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dispatcher := &mockDispatcher{}
+			srv := CreateServer(&config.Config{
+				Routes:   map[string]config.RouteConfig{"dev": {ChatID: -1001}},
+				Webhooks: map[string]config.WebhookConfig{"gitlab": {Route: "dev", Token: "tok3n"}},
+			}, dispatcher, nil, nil, nil)
+
+			req := httptest.NewRequest(http.MethodPost, tt.target, strings.NewReader(gitlabPushBody))
+			if tt.token != "" {
+				req.Header.Set("X-Gitlab-Token", tt.token)
+			}
+			rec := httptest.NewRecorder()
+			srv.server.Handler.ServeHTTP(rec, req)
+
+			require.Equal(t, tt.wantStatus, rec.Code, rec.Body.String())
+			if tt.wantStatus != http.StatusOK {
+				assert.Empty(t, dispatcher.payloads)
+				return
+			}
+			require.Len(t, dispatcher.payloads, 1)
+			assert.Equal(t, "dev", dispatcher.payloads[0].Route)
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	tbapi "github.com/OvyFlash/telegram-bot-api"
+	"github.com/pkarpovich/tg-relay-bot/app/events"
+)
+
+// gotifyQuietPriority is the lowest Gotify priority that notifies; Gotify clients
+// only show messages below it in the app. Messages without a priority get Gotify's
+// default application priority, gotifyDefaultPriority, and so don't notify either.
+const (
+	gotifyQuietPriority   = 4
+	gotifyDefaultPriority = 0
+)
+
+// gotifyMessage is a message as Gotify's API takes it, and answers it.
+type gotifyMessage struct {
+	ID       string         `json:"id"`
+	Title    string         `json:"title,omitempty"`
+	Message  string         `json:"message"`
+	Priority *int           `json:"priority,omitempty"`
+	Extras   map[string]any `json:"extras,omitempty"`
+	Date     time.Time      `json:"date"`
+}
+
+// gotifyHandler accepts messages for Gotify's POST /message, as JSON or as a form. The
+// application token names the webhook source that picks the route.
+func (s *Server) gotifyHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	body, ok := s.readBody(w, r)
+	if !ok {
+		return
+	}
+	name, source, ok := s.sourceByToken(gotifyToken(r))
+	if !ok {
+		s.respondWithError(w, errInvalidToken, http.StatusUnauthorized)
+		return
+	}
+	if source.HMACSecret != "" && !validSignature(r, source, body) {
+		s.respondWithError(w, errInvalidSignature, http.StatusUnauthorized)
+		return
+	}
+
+	msg, err := parseGotifyMessage(r, body)
+	if err != nil {
+		s.respondWithError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	log.Printf("[INFO] Received gotify message from %q", name)
+	payload := gotifyPayload(msg)
+	payload.Route = source.Route
+	id, err := s.dispatchOnce(w, r, "gotify", sourceCaller(name), payload, time.Time{})
+	if err != nil {
+		s.respondWithError(w, err, http.StatusInternalServerError)
+		return
+	}
+	msg.ID, msg.Date = id, time.Now().UTC()
+	s.respondWithJSON(w, msg)
+}
+
+// gotifyToken reads the application token from the token query parameter, the
+// X-Gotify-Key header or a bearer token, like Gotify does.
+func gotifyToken(r *http.Request) string {
+	if token := r.URL.Query().Get("token"); token != "" {
+		return token
+	}
+	if token := r.Header.Get("X-Gotify-Key"); token != "" {
+		return token
+	}
+	token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return token
+}
+
+func parseGotifyMessage(r *http.Request, body []byte) (gotifyMessage, error) {
+	var msg gotifyMessage
+	contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if contentType == "application/json" {
+		if err := json.Unmarshal(body, &msg); err != nil {
+			return gotifyMessage{}, err
+		}
+	} else {
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		if err := r.ParseMultipartForm(maxWebhookBody); err != nil && !errors.Is(err, http.ErrNotMultipart) {
+			return gotifyMessage{}, err
+		}
+		msg.Title, msg.Message = r.PostFormValue("title"), r.PostFormValue("message")
+		if p := r.PostFormValue("priority"); p != "" {
+			priority, err := strconv.Atoi(p)
+			if err != nil {
+				return gotifyMessage{}, errors.New("priority must be a number")
+			}
+			msg.Priority = &priority
+		}
+	}
+
+	if msg.Message == "" {
+		return gotifyMessage{}, errors.New("message is required")
+	}
+	return msg, nil
+}
+
+// gotifyPayload renders a Gotify message, converting markdown when the message asks
+// for it in its client::display extra. Priorities below 4 are sent silently.
+func gotifyPayload(msg gotifyMessage) events.MessagePayload {
+	var sb strings.Builder
+	if msg.Title != "" {
+		sb.WriteString("<b>" + events.EscapeHTML(msg.Title) + "</b>\n")
+	}
+	if gotifyExtra(msg.Extras, "client::display", "contentType") == "text/markdown" {
+		sb.WriteString(ntfyDialect.convert(msg.Message) + "\n")
+	} else {
+		sb.WriteString(events.EscapeHTML(msg.Message) + "\n")
+	}
+	if click, ok := gotifyExtra(msg.Extras, "client::notification", "click").(map[string]any); ok {
+		if url, ok := click["url"].(string); ok {
+			writeLinks(&sb, "Open", url)
+		}
+	}
+
+	priority := gotifyDefaultPriority
+	if msg.Priority != nil {
+		priority = *msg.Priority
+	}
+	return events.MessagePayload{
+		Text:      strings.TrimSpace(sb.String()),
+		ParseMode: tbapi.ModeHTML,
+		Silent:    priority < gotifyQuietPriority,
+	}
+}
+
+func gotifyExtra(extras map[string]any, namespace, key string) any {
+	values, ok := extras[namespace].(map[string]any)
+	if !ok {
+		return nil
+	}
+	return values[key]
+}
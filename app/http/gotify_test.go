@@ -0,0 +1,101 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pkarpovich/tg-relay-bot/app/config"
+)
+
+func TestGotifyHandler(t *testing.T) {
+	tests := []struct {
+		name        string
+		target      string
+		contentType string
+		headers     map[string]string
+		body        string
+		wantStatus  int
+		wantText    string
+		wantSilent  bool
+	}{
+		{
+			name: "json", target: "/message?token=app-token", contentType: "application/json",
+			body:       `{"title": "Backup", "message": "done <ok>", "priority": 5}`,
+			wantStatus: http.StatusOK, wantText: "<b>Backup</b>\ndone &lt;ok&gt;",
+		},
+		{
+			name: "low priority", target: "/message", contentType: "application/json",
+			headers:    map[string]string{"X-Gotify-Key": "app-token"},
+			body:       `{"message": "nightly", "priority": 2}`,
+			wantStatus: http.StatusOK, wantText: "nightly", wantSilent: true,
+		},
+		{
+			name: "markdown with click", target: "/message", contentType: "application/json",
+			headers: map[string]string{"Authorization": "Bearer app-token"},
+			body: `{"message": "**up** again", "extras": {
+				"client::display": {"contentType": "text/markdown"},
+				"client::notification": {"click": {"url": "https://status.local"}}
+			}}`,
+			wantStatus: http.StatusOK, wantText: "<b>up</b> again\n<a href=\"https://status.local\">Open</a>", wantSilent: true,
+		},
+		{
+			name: "no priority", target: "/message?token=app-token", contentType: "application/x-www-form-urlencoded",
+			body:       "message=quiet",
+			wantStatus: http.StatusOK, wantText: "quiet", wantSilent: true,
+		},
+		{
+			name: "form", target: "/message?token=app-token", contentType: "application/x-www-form-urlencoded",
+			body:       "title=Cron&message=finished&priority=1",
+			wantStatus: http.StatusOK, wantText: "<b>Cron</b>\nfinished", wantSilent: true,
+		},
+		{
+			name: "missing message", target: "/message?token=app-token", contentType: "application/json",
+			body:       `{"title": "empty"}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name: "invalid priority", target: "/message?token=app-token", contentType: "application/x-www-form-urlencoded",
+			body:       "message=hi&priority=high",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name: "unknown token", target: "/message?token=nope", contentType: "application/json",
+			body:       `{"message": "hi"}`,
+			wantStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dispatcher := &mockDispatcher{}
+			srv := CreateServer(&config.Config{
+				Routes:   map[string]config.RouteConfig{"ops": {ChatID: -1002}},
+				Webhooks: map[string]config.WebhookConfig{"backups": {Route: "ops", Token: "app-token"}},
+			}, dispatcher, nil, nil, nil)
+
+			req := httptest.NewRequest(http.MethodPost, tt.target, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+			srv.server.Handler.ServeHTTP(rec, req)
+
+			require.Equal(t, tt.wantStatus, rec.Code, rec.Body.String())
+			if tt.wantStatus != http.StatusOK {
+				assert.Empty(t, dispatcher.payloads)
+				return
+			}
+			assert.Contains(t, rec.Body.String(), `"id":"delivery-1"`)
+			require.Len(t, dispatcher.payloads, 1)
+			assert.Equal(t, "ops", dispatcher.payloads[0].Route)
+			assert.Equal(t, tt.wantText, dispatcher.payloads[0].Text)
+			assert.Equal(t, tt.wantSilent, dispatcher.payloads[0].Silent)
+		})
+	}
+}
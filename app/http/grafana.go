@@ -0,0 +1,204 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	tbapi "github.com/OvyFlash/telegram-bot-api"
+	"github.com/pkarpovich/tg-relay-bot/app/events"
+)
+
+const imageFetchTimeout = 10 * time.Second
+
+var (
+	errPrivateAddress = errors.New("refusing to fetch from a private address")
+	// sharedAddressSpace is the carrier-grade NAT range, which netip doesn't count as private.
+	sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+)
+
+var imageExtensions = map[string]string{"image/png": ".png", "image/jpeg": ".jpg", "image/gif": ".gif", "image/webp": ".webp"}
+
+// grafanaPayload covers both Grafana webhook schemas: unified alerting with its
+// alerts list, and legacy dashboard alerts with evalMatches.
+type grafanaPayload struct {
+	Title    string `json:"title"`
+	State    string `json:"state"`
+	Message  string `json:"message"`
+	RuleName string `json:"ruleName"`
+	RuleURL  string `json:"ruleUrl"`
+	ImageURL string `json:"imageUrl"`
+
+	EvalMatches []struct {
+		Metric string            `json:"metric"`
+		Value  float64           `json:"value"`
+		Tags   map[string]string `json:"tags"`
+	} `json:"evalMatches"`
+
+	Alerts []struct {
+		Status       string            `json:"status"`
+		Labels       map[string]string `json:"labels"`
+		Annotations  map[string]string `json:"annotations"`
+		ValueString  string            `json:"valueString"`
+		DashboardURL string            `json:"dashboardURL"`
+		PanelURL     string            `json:"panelURL"`
+		SilenceURL   string            `json:"silenceURL"`
+		ImageURL     string            `json:"imageURL"`
+	} `json:"alerts"`
+}
+
+// convertGrafana renders a Grafana alert notification and attaches the first alert
+// image as a photo when Grafana sent one and it could be downloaded.
+func (s *Server) convertGrafana(r *http.Request, body []byte) (events.MessagePayload, error) {
+	var p grafanaPayload
+	if err := json.Unmarshal(body, &p); err != nil {
+		return events.MessagePayload{}, err
+	}
+	if p.Title == "" && p.RuleName == "" && len(p.Alerts) == 0 {
+		return events.MessagePayload{}, errors.New("not a grafana alert")
+	}
+
+	var sb strings.Builder
+	title := p.Title
+	if title == "" {
+		title = fmt.Sprintf("[%s] %s", strings.ToUpper(p.State), p.RuleName)
+	}
+	sb.WriteString("<b>" + events.EscapeHTML(title) + "</b>\n")
+
+	imageURL := p.ImageURL
+	if len(p.Alerts) > 0 {
+		for _, a := range p.Alerts {
+			sb.WriteString("\n• <b>" + events.EscapeHTML(strings.ToUpper(a.Status)) + "</b> ")
+			sb.WriteString(events.EscapeHTML(formatLabels(a.Labels, nil, "__alert_rule_uid__")) + "\n")
+			if a.ValueString != "" {
+				sb.WriteString("<code>" + events.EscapeHTML(a.ValueString) + "</code>\n")
+			}
+			writeAnnotations(&sb, a.Annotations, nil)
+			writeLinks(&sb, "Dashboard", a.DashboardURL, "Panel", a.PanelURL, "Silence", a.SilenceURL)
+			if imageURL == "" {
+				imageURL = a.ImageURL
+			}
+		}
+	} else {
+		if p.Message != "" {
+			sb.WriteString(events.EscapeHTML(p.Message) + "\n")
+		}
+		for _, m := range p.EvalMatches {
+			line := fmt.Sprintf("• %s: %g", m.Metric, m.Value)
+			if tags := formatLabels(m.Tags, nil); tags != "" {
+				line += " (" + tags + ")"
+			}
+			sb.WriteString(events.EscapeHTML(line) + "\n")
+		}
+		writeLinks(&sb, "Rule", p.RuleURL)
+	}
+
+	payload := events.MessagePayload{Text: strings.TrimSpace(sb.String()), ParseMode: tbapi.ModeHTML}
+	if imageURL != "" {
+		image, err := s.fetchImage(r.Context(), imageURL)
+		if err != nil {
+			log.Printf("[WARN] Failed to fetch grafana image %s: %s", imageURL, err)
+		} else {
+			payload.Attachments = []events.Attachment{image}
+		}
+	}
+	return payload, nil
+}
+
+// writeLinks writes label and URL pairs as one line of links, skipping empty URLs.
+func writeLinks(sb *strings.Builder, pairs ...string) {
+	var links []string
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if pairs[i+1] != "" {
+			links = append(links, htmlLink(pairs[i+1], pairs[i]))
+		}
+	}
+	if len(links) > 0 {
+		sb.WriteString(strings.Join(links, " | ") + "\n")
+	}
+}
+
+// newImageClient creates the client for fetchImage. Unless allowPrivate is set, it
+// refuses to connect to loopback, private and link-local addresses, which covers
+// redirects too since every connection goes through the same dialer.
+func newImageClient(allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: imageFetchTimeout}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if !allowPrivate {
+		dialer.Control = refusePrivateAddress
+		// a proxy would make the checked address the proxy's, not the image host's
+		transport.Proxy = nil
+	}
+	transport.DialContext = dialer.DialContext
+	return &http.Client{Timeout: imageFetchTimeout, Transport: transport}
+}
+
+// refusePrivateAddress is a net.Dialer Control hook that runs after name resolution,
+// so it sees the address actually dialed.
+func refusePrivateAddress(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+
+	addr = addr.Unmap()
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() || sharedAddressSpace.Contains(addr) {
+		return fmt.Errorf("%w %s", errPrivateAddress, addr)
+	}
+	return nil
+}
+
+// fetchImage downloads an image to attach to a message, up to the size Telegram
+// accepts for photos.
+func (s *Server) fetchImage(ctx context.Context, rawURL string) (events.Attachment, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return events.Attachment{}, fmt.Errorf("unsupported image url %q", rawURL)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, imageFetchTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return events.Attachment{}, fmt.Errorf("create image request: %w", err)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return events.Attachment{}, fmt.Errorf("download image: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return events.Attachment{}, fmt.Errorf("download image: status %d", resp.StatusCode)
+	}
+	contentType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if !strings.HasPrefix(contentType, "image/") {
+		return events.Attachment{}, fmt.Errorf("unexpected content type %q", contentType)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, events.MaxPhotoSize+1))
+	if err != nil {
+		return events.Attachment{}, fmt.Errorf("read image: %w", err)
+	}
+	if len(data) > events.MaxPhotoSize {
+		return events.Attachment{}, errors.New("image is too large")
+	}
+
+	return events.Attachment{Name: "image" + imageExtensions[contentType], ContentType: contentType, Data: data}, nil
+}
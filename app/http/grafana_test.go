@@ -0,0 +1,138 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pkarpovich/tg-relay-bot/app/config"
+)
+
+func TestConvertGrafana(t *testing.T) {
+	images := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/panel.png" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		_, _ = w.Write([]byte("png"))
+	}))
+	defer images.Close()
+
+	tests := []struct {
+		name      string
+		body      string
+		wantText  string
+		wantImage bool
+	}{
+		{
+			name: "unified alerting with image",
+			body: `{
+				"title": "[FIRING:1] DiskFull (prod)",
+				"state": "alerting",
+				"message": "ignored in favour of the alerts",
+				"alerts": [{
+					"status": "firing",
+					"labels": {"alertname": "DiskFull", "instance": "db-1", "__alert_rule_uid__": "x"},
+					"annotations": {"summary": "Disk /data at 95%"},
+					"valueString": "[ var='A' value=95 ]",
+					"dashboardURL": "https://grafana.local/d/abc",
+					"panelURL": "https://grafana.local/d/abc?viewPanel=2",
+					"silenceURL": "https://grafana.local/alerting/silence/new",
+					"imageURL": "` + images.URL + `/panel.png"
+				}]
+			}`,
+			wantText: `<b>[FIRING:1] DiskFull (prod)</b>
+
+• <b>FIRING</b> alertname=DiskFull, instance=db-1
+<code>[ var='A' value=95 ]</code>
+Disk /data at 95%
+<a href="https://grafana.local/d/abc">Dashboard</a> | <a href="https://grafana.local/d/abc?viewPanel=2">Panel</a> | <a href="https://grafana.local/alerting/silence/new">Silence</a>`,
+			wantImage: true,
+		},
+		{
+			name: "legacy alert with eval matches and a missing image",
+			body: `{
+				"ruleName": "Latency",
+				"ruleUrl": "https://grafana.local/d/xyz",
+				"state": "alerting",
+				"message": "p99 > 500ms",
+				"evalMatches": [{"metric": "p99", "value": 812.5, "tags": {"service": "api"}}],
+				"imageUrl": "` + images.URL + `/missing.png"
+			}`,
+			wantText: `<b>[ALERTING] Latency</b>
+p99 &gt; 500ms
+• p99: 812.5 (service=api)
+<a href="https://grafana.local/d/xyz">Rule</a>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := &Server{client: images.Client()}
+			req := httptest.NewRequest(http.MethodPost, "/webhook/grafana", nil)
+
+			payload, err := srv.convertGrafana(req, []byte(tt.body))
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.wantText, payload.Text)
+			assert.Equal(t, "HTML", payload.ParseMode)
+			if !tt.wantImage {
+				assert.Empty(t, payload.Attachments)
+				return
+			}
+			require.Len(t, payload.Attachments, 1)
+			assert.Equal(t, "image.png", payload.Attachments[0].Name)
+			assert.Equal(t, "image/png", payload.Attachments[0].ContentType)
+			assert.Equal(t, []byte("png"), payload.Attachments[0].Data)
+		})
+	}
+}
+
+func TestGrafanaReceiver(t *testing.T) {
+	dispatcher := &mockDispatcher{}
+	srv := CreateServer(&config.Config{
+		Routes:   map[string]config.RouteConfig{"ops": {ChatID: -1001}},
+		Webhooks: map[string]config.WebhookConfig{"grafana": {Route: "ops", Token: "tok3n"}},
+	}, dispatcher, nil, nil, nil)
+
+	req := httptest.NewRequest(http.MethodPost, "/webhook/grafana?token=tok3n", strings.NewReader(`{"title": "[RESOLVED] DiskFull", "alerts": [{"status": "resolved"}]}`))
+	rec := httptest.NewRecorder()
+	srv.server.Handler.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	require.Len(t, dispatcher.payloads, 1)
+	assert.Equal(t, "ops", dispatcher.payloads[0].Route)
+	assert.Contains(t, dispatcher.payloads[0].Text, "[RESOLVED] DiskFull")
+
+	req = httptest.NewRequest(http.MethodPost, "/webhook/grafana?token=tok3n", strings.NewReader(`{}`))
+	rec = httptest.NewRecorder()
+	srv.server.Handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestFetchImageRefusesPrivateAddresses(t *testing.T) {
+	images := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		_, _ = w.Write([]byte("png"))
+	}))
+	defer images.Close()
+
+	srv := &Server{client: newImageClient(false)}
+	_, err := srv.fetchImage(t.Context(), images.URL+"/panel.png")
+	require.ErrorIs(t, err, errPrivateAddress)
+
+	srv = &Server{client: newImageClient(true)}
+	image, err := srv.fetchImage(t.Context(), images.URL+"/panel.png")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("png"), image.Data)
+
+	for _, address := range []string{"127.0.0.1:80", "10.0.0.5:80", "169.254.169.254:80", "[::1]:80", "[::ffff:192.168.1.1]:80", "100.64.0.1:80"} {
+		assert.ErrorIs(t, refusePrivateAddress("tcp", address, nil), errPrivateAddress, address)
+	}
+	assert.NoError(t, refusePrivateAddress("tcp", "93.184.216.34:443", nil))
+}
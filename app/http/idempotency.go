@@ -0,0 +1,147 @@
+package http
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkarpovich/tg-relay-bot/app/events"
+)
+
+const (
+	IdempotencyKeyHeader     = "Idempotency-Key"
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+
+	idempotencySweepInterval = time.Minute
+)
+
+type idempotencyEntry struct {
+	done    chan struct{}
+	id      string
+	err     error
+	expires time.Time
+}
+
+type idempotencyCache struct {
+	mu        sync.Mutex
+	entries   map[string]*idempotencyEntry
+	lastSweep time.Time
+}
+
+func newIdempotencyCache() *idempotencyCache {
+	return &idempotencyCache{entries: make(map[string]*idempotencyEntry)}
+}
+
+// Do runs fn once per key within ttl. Concurrent and later calls with the same key
+// wait for the first one and get its delivery ID back with replayed set to true.
+// Failed attempts are forgotten so the client can retry them.
+func (c *idempotencyCache) Do(key string, ttl time.Duration, fn func() (string, error)) (id string, replayed bool, err error) {
+	if c == nil || key == "" || ttl <= 0 {
+		id, err = fn()
+		return id, false, err
+	}
+
+	now := time.Now()
+	c.mu.Lock()
+	c.sweep(now)
+	if e, ok := c.entries[key]; ok && now.Before(e.expires) {
+		c.mu.Unlock()
+		<-e.done
+		if e.err != nil {
+			return "", false, e.err
+		}
+		return e.id, true, nil
+	}
+
+	e := &idempotencyEntry{done: make(chan struct{}), expires: now.Add(ttl)}
+	c.entries[key] = e
+	c.mu.Unlock()
+
+	e.id, e.err = fn()
+	if e.err != nil {
+		c.mu.Lock()
+		delete(c.entries, key)
+		c.mu.Unlock()
+	}
+	close(e.done)
+
+	return e.id, false, e.err
+}
+
+func (c *idempotencyCache) sweep(now time.Time) {
+	if now.Sub(c.lastSweep) < idempotencySweepInterval {
+		return
+	}
+	c.lastSweep = now
+
+	for key, e := range c.entries {
+		if !now.Before(e.expires) {
+			delete(c.entries, key)
+		}
+	}
+}
+
+// dispatchOnce dispatches or schedules the payload unless the same caller already
+// sent it. caller identifies the API key or webhook source, so different clients
+// never share idempotency keys or each other's delivery IDs.
+func (s *Server) dispatchOnce(
+	w http.ResponseWriter,
+	r *http.Request,
+	scope string,
+	caller string,
+	payload events.MessagePayload,
+	sendAt time.Time,
+) (string, error) {
+	key, ttl := s.idempotencyKey(r, scope, caller, payload, sendAt)
+
+	id, replayed, err := s.idempotency.Do(key, ttl, func() (string, error) {
+		if !sendAt.IsZero() {
+			return s.scheduler.Schedule(payload, sendAt)
+		}
+		return s.dispatcher.Dispatch(payload)
+	})
+	if replayed {
+		log.Printf("[INFO] Duplicate %s request, returning delivery %s", scope, id)
+		w.Header().Set(IdempotentReplayedHeader, "true")
+	}
+	return id, err
+}
+
+func (s *Server) idempotencyKey(
+	r *http.Request,
+	scope string,
+	caller string,
+	payload events.MessagePayload,
+	sendAt time.Time,
+) (string, time.Duration) {
+	if key := r.Header.Get(IdempotencyKeyHeader); key != "" {
+		return "key:" + scope + ":" + caller + ":" + key, s.config.Http.IdempotencyTTL
+	}
+
+	if s.config.Http.DedupWindow <= 0 {
+		return "", 0
+	}
+
+	data, err := json.Marshal(struct {
+		Payload events.MessagePayload `json:"payload"`
+		SendAt  time.Time             `json:"send_at"`
+	}{payload, sendAt})
+	if err != nil {
+		return "", 0
+	}
+	sum := sha256.Sum256(data)
+	return "content:" + scope + ":" + caller + ":" + hex.EncodeToString(sum[:]), s.config.Http.DedupWindow
+}
+
+// keyCaller and sourceCaller name the caller of a request for dispatchOnce.
+func keyCaller(key *apiKey) string {
+	return "api_key/" + key.name
+}
+
+func sourceCaller(name string) string {
+	return "source/" + name
+}
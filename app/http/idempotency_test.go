@@ -0,0 +1,182 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pkarpovich/tg-relay-bot/app/config"
+)
+
+func TestSendHandlerIdempotency(t *testing.T) {
+	type request struct {
+		secret string
+		key    string
+		body   string
+	}
+
+	tests := []struct {
+		name           string
+		dedupWindow    time.Duration
+		requests       []request
+		wantIDs        []string
+		wantReplayed   []bool
+		wantDispatches int
+	}{
+		{
+			name:           "same idempotency key is sent once",
+			requests:       []request{{key: "abc", body: `{"message": "hi"}`}, {key: "abc", body: `{"message": "hi"}`}},
+			wantIDs:        []string{"delivery-1", "delivery-1"},
+			wantReplayed:   []bool{false, true},
+			wantDispatches: 1,
+		},
+		{
+			name:           "different idempotency keys are sent separately",
+			requests:       []request{{key: "abc", body: `{"message": "hi"}`}, {key: "def", body: `{"message": "hi"}`}},
+			wantIDs:        []string{"delivery-1", "delivery-2"},
+			wantReplayed:   []bool{false, false},
+			wantDispatches: 2,
+		},
+		{
+			name:           "identical content is sent twice without dedup window",
+			requests:       []request{{body: `{"message": "hi"}`}, {body: `{"message": "hi"}`}},
+			wantIDs:        []string{"delivery-1", "delivery-2"},
+			wantReplayed:   []bool{false, false},
+			wantDispatches: 2,
+		},
+		{
+			name:           "identical content is deduplicated within the window",
+			dedupWindow:    time.Minute,
+			requests:       []request{{body: `{"message": "hi"}`}, {body: `{ "message":"hi" }`}, {body: `{"message": "bye"}`}},
+			wantIDs:        []string{"delivery-1", "delivery-1", "delivery-2"},
+			wantReplayed:   []bool{false, true, false},
+			wantDispatches: 2,
+		},
+		{
+			name: "same idempotency key from different api keys is sent separately",
+			requests: []request{
+				{key: "abc", body: `{"message": "hi"}`},
+				{secret: "other-secret", key: "abc", body: `{"message": "hi"}`},
+			},
+			wantIDs:        []string{"delivery-1", "delivery-2"},
+			wantReplayed:   []bool{false, false},
+			wantDispatches: 2,
+		},
+		{
+			name:        "identical content from different api keys is sent separately",
+			dedupWindow: time.Minute,
+			requests: []request{
+				{body: `{"message": "hi"}`},
+				{secret: "other-secret", body: `{"message": "hi"}`},
+			},
+			wantIDs:        []string{"delivery-1", "delivery-2"},
+			wantReplayed:   []bool{false, false},
+			wantDispatches: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dispatcher := &mockDispatcher{}
+			srv := &Server{
+				config: &config.Config{
+					Http: config.HttpConfig{
+						SecretApiKey:   "test-secret",
+						APIKeys:        []config.APIKeyConfig{{Name: "other", Key: "other-secret"}},
+						IdempotencyTTL: time.Hour,
+						DedupWindow:    tt.dedupWindow,
+					},
+				},
+				dispatcher:  dispatcher,
+				idempotency: newIdempotencyCache(),
+			}
+			srv.keys = newKeyRegistry(srv.config.Http)
+
+			for i, r := range tt.requests {
+				req := httptest.NewRequest(http.MethodPost, "/send", strings.NewReader(r.body))
+				secret := r.secret
+				if secret == "" {
+					secret = "test-secret"
+				}
+				req.Header.Set("X-Secret", secret)
+				if r.key != "" {
+					req.Header.Set(IdempotencyKeyHeader, r.key)
+				}
+				rec := httptest.NewRecorder()
+
+				srv.sendHandler(rec, req)
+
+				require.Equal(t, http.StatusOK, rec.Code)
+				var resp SendResponse
+				require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+				assert.Equal(t, tt.wantIDs[i], resp.ID)
+				assert.Equal(t, tt.wantReplayed[i], rec.Header().Get(IdempotentReplayedHeader) == "true")
+			}
+
+			assert.Len(t, dispatcher.payloads, tt.wantDispatches)
+		})
+	}
+}
+
+func TestIdempotencyCacheDo(t *testing.T) {
+	t.Run("concurrent calls share one result", func(t *testing.T) {
+		cache := newIdempotencyCache()
+		release := make(chan struct{})
+		var calls int
+
+		var wg sync.WaitGroup
+		ids := make([]string, 5)
+		for i := range ids {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				ids[i], _, _ = cache.Do("k", time.Minute, func() (string, error) {
+					calls++
+					<-release
+					return "first", nil
+				})
+			}()
+		}
+		time.Sleep(20 * time.Millisecond)
+		close(release)
+		wg.Wait()
+
+		assert.Equal(t, 1, calls)
+		for _, id := range ids {
+			assert.Equal(t, "first", id)
+		}
+	})
+
+	t.Run("failures are not remembered", func(t *testing.T) {
+		cache := newIdempotencyCache()
+
+		_, _, err := cache.Do("k", time.Minute, func() (string, error) { return "", errors.New("boom") })
+		require.Error(t, err)
+
+		id, replayed, err := cache.Do("k", time.Minute, func() (string, error) { return "second", nil })
+		require.NoError(t, err)
+		assert.Equal(t, "second", id)
+		assert.False(t, replayed)
+	})
+
+	t.Run("entries expire", func(t *testing.T) {
+		cache := newIdempotencyCache()
+
+		_, _, err := cache.Do("k", time.Millisecond, func() (string, error) { return "first", nil })
+		require.NoError(t, err)
+		time.Sleep(5 * time.Millisecond)
+
+		id, replayed, err := cache.Do("k", time.Millisecond, func() (string, error) { return "second", nil })
+		require.NoError(t, err)
+		assert.Equal(t, "second", id)
+		assert.False(t, replayed)
+	})
+}
@@ -0,0 +1,179 @@
+package http
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkarpovich/tg-relay-bot/app/config"
+)
+
+const (
+	endpointSend        = "send"
+	endpointWebhook     = "webhook"
+	endpointMessages    = "messages"
+	endpointScheduled   = "scheduled"
+	endpointDeadLetters = "deadletters"
+
+	rateLimitWindow = time.Minute
+)
+
+var (
+	errUnauthorized   = errors.New("unauthorized")
+	errKeyExpired     = errors.New("api key expired")
+	errEndpointDenied = errors.New("api key is not allowed to use this endpoint")
+	errRouteDenied    = errors.New("api key is not allowed to send to this route")
+	errKeyRateLimited = errors.New("api key rate limit exceeded")
+)
+
+type apiKey struct {
+	name      string
+	hash      [sha256.Size]byte
+	endpoints map[string]bool
+	routes    map[string]bool
+	expiresAt time.Time
+	limit     int
+
+	mu          sync.Mutex
+	windowStart time.Time
+	requests    int
+}
+
+type keyRegistry struct {
+	keys []*apiKey
+	now  func() time.Time
+}
+
+// newKeyRegistry builds the registry from HTTP_SECRET, which becomes an unrestricted
+// key named "default", and the api_keys list.
+func newKeyRegistry(cfg config.HttpConfig) *keyRegistry {
+	registry := &keyRegistry{now: time.Now}
+	if cfg.SecretApiKey != "" {
+		legacy := config.APIKeyConfig{Name: config.LegacyKeyName, Key: cfg.SecretApiKey}
+		registry.keys = append(registry.keys, newAPIKey(legacy))
+	}
+	for _, key := range cfg.APIKeys {
+		registry.keys = append(registry.keys, newAPIKey(key))
+	}
+	return registry
+}
+
+func newAPIKey(cfg config.APIKeyConfig) *apiKey {
+	return &apiKey{
+		name:      cfg.Name,
+		hash:      sha256.Sum256([]byte(cfg.Key)),
+		endpoints: toSet(cfg.Endpoints),
+		routes:    toSet(cfg.Routes),
+		expiresAt: cfg.ExpiresAt,
+		limit:     cfg.RateLimit,
+	}
+}
+
+// lookup compares the secret with every key in constant time. Hashing first makes the
+// comparison independent of the key lengths as well.
+func (k *keyRegistry) lookup(secret string) *apiKey {
+	if secret == "" {
+		return nil
+	}
+
+	hash := sha256.Sum256([]byte(secret))
+	var found *apiKey
+	for _, key := range k.keys {
+		if subtle.ConstantTimeCompare(hash[:], key.hash[:]) == 1 {
+			found = key
+		}
+	}
+	return found
+}
+
+func (a *apiKey) allowsEndpoint(endpoint string) bool {
+	return a.endpoints == nil || a.endpoints[endpoint]
+}
+
+func (a *apiKey) allowsRoute(route string) bool {
+	if route == "" {
+		route = config.SuperUsersRoute
+	}
+	return a.routes == nil || a.routes[route]
+}
+
+func (a *apiKey) allowsAllRoutes() bool {
+	return a.routes == nil
+}
+
+// take counts a request against the key's limit and returns how long to wait when
+// the limit is exhausted.
+func (a *apiKey) take(now time.Time) time.Duration {
+	if a.limit <= 0 {
+		return 0
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if now.Sub(a.windowStart) >= rateLimitWindow {
+		a.windowStart = now
+		a.requests = 0
+	}
+	if a.requests >= a.limit {
+		return a.windowStart.Add(rateLimitWindow).Sub(now)
+	}
+	a.requests++
+	return 0
+}
+
+// authorize checks the X-Secret header against the key registry and writes the error
+// response when the request may not use endpoint.
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request, endpoint string) (*apiKey, bool) {
+	return s.authorizeSecret(w, r, endpoint, r.Header.Get("X-Secret"))
+}
+
+// authorizeSecret is authorize for endpoints that take the API key from somewhere
+// other than the X-Secret header.
+func (s *Server) authorizeSecret(w http.ResponseWriter, r *http.Request, endpoint, secret string) (*apiKey, bool) {
+	key := s.keys.lookup(secret)
+	if key == nil {
+		s.respondWithError(w, errUnauthorized, http.StatusUnauthorized)
+		return nil, false
+	}
+
+	now := s.keys.now()
+	var status int
+	var err error
+	switch {
+	case !key.expiresAt.IsZero() && !now.Before(key.expiresAt):
+		status, err = http.StatusUnauthorized, errKeyExpired
+	case !key.allowsEndpoint(endpoint):
+		status, err = http.StatusForbidden, errEndpointDenied
+	default:
+		if wait := key.take(now); wait > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			status, err = http.StatusTooManyRequests, errKeyRateLimited
+		}
+	}
+	if err != nil {
+		log.Printf("[WARN] %s %s rejected for key %q", r.Method, r.URL.Path, key.name)
+		s.respondWithError(w, err, status)
+		return nil, false
+	}
+
+	log.Printf("[INFO] %s %s authorized with key %q", r.Method, r.URL.Path, key.name)
+	return key, true
+}
+
+func toSet(values []string) map[string]bool {
+	if len(values) == 0 {
+		return nil
+	}
+	set := make(map[string]bool, len(values))
+	for _, v := range values {
+		set[v] = true
+	}
+	return set
+}
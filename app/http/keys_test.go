@@ -0,0 +1,216 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pkarpovich/tg-relay-bot/app/config"
+	"github.com/pkarpovich/tg-relay-bot/app/events"
+)
+
+func TestAPIKeys(t *testing.T) {
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	httpCfg := config.HttpConfig{
+		SecretApiKey: "legacy-secret",
+		APIKeys: []config.APIKeyConfig{
+			{Name: "ci", Key: "ci-key", Endpoints: []string{"send"}, Routes: []string{"ci"}},
+			{Name: "alerts", Key: "alerts-key", Routes: []string{"ci", config.SuperUsersRoute}},
+			{Name: "old", Key: "old-key", ExpiresAt: now.Add(-time.Hour)},
+		},
+	}
+
+	tests := []struct {
+		name       string
+		httpCfg    config.HttpConfig
+		method     string
+		target     string
+		secret     string
+		body       string
+		wantStatus int
+	}{
+		{name: "legacy secret", httpCfg: httpCfg, method: http.MethodPost, target: "/send", secret: "legacy-secret", body: `{"message": "hi"}`, wantStatus: http.StatusOK},
+		{name: "unknown key", httpCfg: httpCfg, method: http.MethodPost, target: "/send", secret: "nope", body: `{"message": "hi"}`, wantStatus: http.StatusUnauthorized},
+		{name: "no keys configured", method: http.MethodPost, target: "/send", body: `{"message": "hi"}`, wantStatus: http.StatusUnauthorized},
+		{name: "scoped key on its route", httpCfg: httpCfg, method: http.MethodPost, target: "/send", secret: "ci-key", body: `{"message": "hi", "route": "ci"}`, wantStatus: http.StatusOK},
+		{name: "scoped key to super users", httpCfg: httpCfg, method: http.MethodPost, target: "/send", secret: "ci-key", body: `{"message": "hi"}`, wantStatus: http.StatusForbidden},
+		{name: "super users allowed explicitly", httpCfg: httpCfg, method: http.MethodPost, target: "/send", secret: "alerts-key", body: `{"message": "hi"}`, wantStatus: http.StatusOK},
+		{name: "scoped key on another endpoint", httpCfg: httpCfg, method: http.MethodGet, target: "/deadletters", secret: "ci-key", wantStatus: http.StatusForbidden},
+		{name: "webhook route not allowed", httpCfg: httpCfg, method: http.MethodPost, target: "/webhook", secret: "ci-key", body: `{"content": "hi"}`, wantStatus: http.StatusForbidden},
+		{name: "webhook route allowed", httpCfg: httpCfg, method: http.MethodPost, target: "/webhook/ci", secret: "alerts-key", body: `{"content": "hi"}`, wantStatus: http.StatusOK},
+		{name: "expired key", httpCfg: httpCfg, method: http.MethodPost, target: "/send", secret: "old-key", body: `{"message": "hi"}`, wantStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dispatcher := &mockDispatcher{}
+			srv := CreateServer(&config.Config{
+				Http:   tt.httpCfg,
+				Routes: map[string]config.RouteConfig{"ci": {ChatID: -100123}},
+			}, dispatcher, nil, nil, nil)
+			srv.keys.now = func() time.Time { return now }
+
+			req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			req.Header.Set("X-Secret", tt.secret)
+			rec := httptest.NewRecorder()
+
+			srv.server.Handler.ServeHTTP(rec, req)
+
+			require.Equal(t, tt.wantStatus, rec.Code, rec.Body.String())
+			if tt.wantStatus != http.StatusOK {
+				assert.Empty(t, dispatcher.payloads)
+			}
+		})
+	}
+}
+
+func TestAPIKeyRateLimit(t *testing.T) {
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	dispatcher := &mockDispatcher{}
+	srv := CreateServer(&config.Config{
+		Http: config.HttpConfig{APIKeys: []config.APIKeyConfig{{Name: "cron", Key: "cron-key", RateLimit: 2}}},
+	}, dispatcher, nil, nil, nil)
+	srv.keys.now = func() time.Time { return now }
+
+	send := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/send", strings.NewReader(`{"message": "hi"}`))
+		req.Header.Set("X-Secret", "cron-key")
+		rec := httptest.NewRecorder()
+		srv.server.Handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	assert.Equal(t, http.StatusOK, send().Code)
+	now = now.Add(30 * time.Second)
+	assert.Equal(t, http.StatusOK, send().Code)
+
+	rec := send()
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "30", rec.Header().Get("Retry-After"))
+
+	now = now.Add(30 * time.Second)
+	assert.Equal(t, http.StatusOK, send().Code)
+	assert.Len(t, dispatcher.payloads, 3)
+}
+
+type mockDeadLetters struct {
+	deadLetters []events.DeadLetter
+	replayed    []uint64
+}
+
+func (m *mockDeadLetters) List() ([]events.DeadLetter, error) {
+	return slices.Clone(m.deadLetters), nil
+}
+
+func (m *mockDeadLetters) Get(id uint64) (events.DeadLetter, error) {
+	for _, dl := range m.deadLetters {
+		if dl.ID == id {
+			return dl, nil
+		}
+	}
+	return events.DeadLetter{}, events.ErrDeadLetterNotFound
+}
+
+func (m *mockDeadLetters) Replay(id uint64) error {
+	m.replayed = append(m.replayed, id)
+	return m.Delete(id)
+}
+
+func (m *mockDeadLetters) Delete(id uint64) error {
+	for i, dl := range m.deadLetters {
+		if dl.ID == id {
+			m.deadLetters = slices.Delete(m.deadLetters, i, i+1)
+			return nil
+		}
+	}
+	return events.ErrDeadLetterNotFound
+}
+
+func (m *mockDeadLetters) Purge() (int, error) {
+	n := len(m.deadLetters)
+	m.deadLetters = nil
+	return n, nil
+}
+
+func TestAPIKeyRouteScope(t *testing.T) {
+	tests := []struct {
+		name            string
+		method          string
+		target          string
+		wantStatus      int
+		wantBody        string
+		wantDeadLetters []uint64
+		wantScheduled   int
+	}{
+		{name: "delivery on its route", method: http.MethodGet, target: "/messages/ci-delivery", wantStatus: http.StatusOK},
+		{name: "delivery on another route", method: http.MethodGet, target: "/messages/other-delivery", wantStatus: http.StatusForbidden},
+		{name: "scheduled message on another route", method: http.MethodGet, target: "/messages/other-scheduled", wantStatus: http.StatusForbidden},
+		{name: "dead letters are filtered", method: http.MethodGet, target: "/deadletters", wantStatus: http.StatusOK, wantBody: `"id":1`},
+		{name: "dead letter on another route", method: http.MethodGet, target: "/deadletters/2", wantStatus: http.StatusForbidden},
+		{name: "replay on its route", method: http.MethodPost, target: "/deadletters/1/replay", wantStatus: http.StatusOK, wantDeadLetters: []uint64{2}},
+		{name: "replay on another route", method: http.MethodPost, target: "/deadletters/2/replay", wantStatus: http.StatusForbidden},
+		{name: "delete on another route", method: http.MethodDelete, target: "/deadletters/2", wantStatus: http.StatusForbidden},
+		{name: "purge keeps other routes", method: http.MethodDelete, target: "/deadletters", wantStatus: http.StatusOK, wantBody: `"purged":1`, wantDeadLetters: []uint64{2}},
+		{name: "scheduled messages are filtered", method: http.MethodGet, target: "/scheduled", wantStatus: http.StatusOK, wantBody: `"id":"ci-scheduled"`},
+		{name: "cancel on its route", method: http.MethodDelete, target: "/scheduled/ci-scheduled", wantStatus: http.StatusOK, wantScheduled: 1},
+		{name: "cancel on another route", method: http.MethodDelete, target: "/scheduled/other-scheduled", wantStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			deadLetters := &mockDeadLetters{deadLetters: []events.DeadLetter{
+				{ID: 1, Payload: events.MessagePayload{Text: "ci", Route: "ci"}},
+				{ID: 2, Payload: events.MessagePayload{Text: "other"}},
+			}}
+			scheduler := &mockScheduler{scheduled: []events.ScheduledMessage{
+				{ID: "ci-scheduled", Payload: events.MessagePayload{Route: "ci"}},
+				{ID: "other-scheduled", Payload: events.MessagePayload{Route: "ops"}},
+			}}
+			deliveries := &mockDeliveries{delivery: events.Delivery{ID: "ci-delivery", Route: "ci", Status: events.StatusDelivered}}
+			if strings.Contains(tt.target, "other-delivery") {
+				deliveries.delivery = events.Delivery{ID: "other-delivery", Status: events.StatusDelivered}
+			}
+
+			srv := CreateServer(&config.Config{
+				Http: config.HttpConfig{APIKeys: []config.APIKeyConfig{{Name: "ci", Key: "ci-key", Routes: []string{"ci"}}}},
+				Routes: map[string]config.RouteConfig{
+					"ci":  {ChatID: -100123},
+					"ops": {ChatID: -100456},
+				},
+			}, &mockDispatcher{}, deadLetters, deliveries, scheduler)
+
+			req := httptest.NewRequest(tt.method, tt.target, nil)
+			req.Header.Set("X-Secret", "ci-key")
+			rec := httptest.NewRecorder()
+
+			srv.server.Handler.ServeHTTP(rec, req)
+
+			require.Equal(t, tt.wantStatus, rec.Code, rec.Body.String())
+			if tt.wantBody != "" {
+				assert.Contains(t, rec.Body.String(), tt.wantBody)
+				assert.NotContains(t, rec.Body.String(), "other", "entries of other routes are hidden")
+			}
+			if tt.wantDeadLetters != nil {
+				var ids []uint64
+				for _, dl := range deadLetters.deadLetters {
+					ids = append(ids, dl.ID)
+				}
+				assert.Equal(t, tt.wantDeadLetters, ids)
+			}
+			if tt.wantScheduled > 0 {
+				assert.Len(t, scheduler.scheduled, tt.wantScheduled)
+			}
+			if tt.wantStatus == http.StatusForbidden {
+				assert.Len(t, deadLetters.deadLetters, 2)
+				assert.Len(t, scheduler.scheduled, 2)
+				assert.Empty(t, deadLetters.replayed)
+			}
+		})
+	}
+}
@@ -0,0 +1,179 @@
+package http
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/pkarpovich/tg-relay-bot/app/events"
+)
+
+// emphasis turns a pair of markdown markers into an HTML tag. Markers that need a word
+// boundary don't match inside words, so snake_case stays as it is.
+type emphasis struct {
+	marker   string
+	tag      string
+	boundary bool
+}
+
+var (
+	codeBlockPattern    = regexp.MustCompile("(?s)```([a-zA-Z0-9_+-]+\n)?\n?(.*?)```|`([^`\n]+)`")
+	markdownLinkPattern = regexp.MustCompile(`\[([^\[\]\n]+)\]\(<?(https?://[^\s()<>]+)>?\)`)
+)
+
+// markdownDialect describes how a chat service's markdown differs. decode, when set,
+// turns code into plain text; languages strips the language after the opening fence
+// of a code block; inline renders everything outside code as HTML.
+type markdownDialect struct {
+	decode    func(string) string
+	languages bool
+	inline    func(string) string
+}
+
+// convert renders code blocks and inline code as <pre> and <code>, and the text
+// between them with the dialect's inline rules.
+func (d markdownDialect) convert(text string) string {
+	var sb strings.Builder
+	last := 0
+	for _, m := range codeBlockPattern.FindAllStringSubmatchIndex(text, -1) {
+		sb.WriteString(d.inline(text[last:m[0]]))
+		tag, code := "code", ""
+		if m[4] >= 0 {
+			tag, code = "pre", strings.TrimSuffix(text[m[4]:m[5]], "\n")
+			if m[2] >= 0 && !d.languages {
+				code = text[m[2]:m[3]] + code
+			}
+		} else {
+			code = text[m[6]:m[7]]
+		}
+		if d.decode != nil {
+			code = d.decode(code)
+		}
+		sb.WriteString("<" + tag + ">" + events.EscapeHTML(code) + "</" + tag + ">")
+		last = m[1]
+	}
+	sb.WriteString(d.inline(text[last:]))
+	return sb.String()
+}
+
+// linkedMarkdown renders [text](url) links and the emphasis rules of a markdown
+// dialect that has them.
+func linkedMarkdown(rules []emphasis) func(string) string {
+	plain := func(s string) string {
+		return applyEmphasis(events.EscapeHTML(s), rules...)
+	}
+	return func(s string) string {
+		var sb strings.Builder
+		last := 0
+		for _, m := range markdownLinkPattern.FindAllStringSubmatchIndex(s, -1) {
+			sb.WriteString(plain(s[last:m[0]]))
+			sb.WriteString(htmlLink(s[m[4]:m[5]], s[m[2]:m[3]]))
+			last = m[1]
+		}
+		sb.WriteString(plain(s[last:]))
+		return sb.String()
+	}
+}
+
+// applyEmphasis wraps text between matching markers on the same line in HTML tags.
+// The text must already be escaped. Markers are matched in one pass against a stack
+// of open ones, so tags always nest: a marker that would close an emphasis opened
+// before the innermost one leaves the markers in between as plain text.
+func applyEmphasis(text string, rules ...emphasis) string {
+	var (
+		pieces []string
+		stack  []openMarker
+	)
+
+	for i := 0; i < len(text); {
+		if text[i] == '\n' {
+			stack = stack[:0]
+			pieces = append(pieces, "\n")
+			i++
+			continue
+		}
+
+		if k := closable(text, i, stack); k >= 0 {
+			o := stack[k]
+			pieces[o.piece] = "<" + o.rule.tag + ">"
+			pieces = append(pieces, "</"+o.rule.tag+">")
+			stack = stack[:k]
+			i += len(o.rule.marker)
+			continue
+		}
+
+		if rule, ok := opener(text, i, rules); ok {
+			stack = append(stack, openMarker{rule: rule, piece: len(pieces), after: i + len(rule.marker)})
+			pieces = append(pieces, rule.marker)
+			i += len(rule.marker)
+			continue
+		}
+
+		_, size := utf8.DecodeRuneInString(text[i:])
+		pieces = append(pieces, text[i:i+size])
+		i += size
+	}
+	return strings.Join(pieces, "")
+}
+
+// openMarker is an emphasis waiting for its closing marker.
+type openMarker struct {
+	rule  emphasis
+	piece int // index of the marker in the output, replaced by the tag once closed
+	after int // where the emphasized text starts
+}
+
+// closable returns the index in stack of the innermost open emphasis whose marker
+// closes at i, or -1.
+func closable(text string, i int, stack []openMarker) int {
+	for k := len(stack) - 1; k >= 0; k-- {
+		o := stack[k]
+		if i > o.after && strings.HasPrefix(text[i:], o.rule.marker) && closes(text, i, o.rule) {
+			return k
+		}
+	}
+	return -1
+}
+
+// opener returns the first rule whose marker can start an emphasis at i.
+func opener(text string, i int, rules []emphasis) (emphasis, bool) {
+	for _, rule := range rules {
+		if strings.HasPrefix(text[i:], rule.marker) && opens(text, i, rule) {
+			return rule, true
+		}
+	}
+	return emphasis{}, false
+}
+
+// opens reports whether the marker at i can start an emphasis: it's followed by a
+// non-space and, for boundary markers, not preceded by a letter or digit.
+func opens(text string, i int, rule emphasis) bool {
+	next, _ := utf8.DecodeRuneInString(text[i+len(rule.marker):])
+	if next == utf8.RuneError || unicode.IsSpace(next) {
+		return false
+	}
+	if !rule.boundary || i == 0 {
+		return true
+	}
+	prev, _ := utf8.DecodeLastRuneInString(text[:i])
+	return !isWordRune(prev)
+}
+
+// closes reports whether the marker at i can end an emphasis: it follows a non-space
+// and, for boundary markers, isn't followed by a letter or digit.
+func closes(text string, i int, rule emphasis) bool {
+	prev, _ := utf8.DecodeLastRuneInString(text[:i])
+	if unicode.IsSpace(prev) {
+		return false
+	}
+	if !rule.boundary {
+		return true
+	}
+	next, _ := utf8.DecodeRuneInString(text[i+len(rule.marker):])
+	return !isWordRune(next)
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
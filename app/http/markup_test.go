@@ -0,0 +1,83 @@
+package http
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyEmphasis(t *testing.T) {
+	rules := []emphasis{
+		{marker: "**", tag: "b"},
+		{marker: "*", tag: "i"},
+		{marker: "_", tag: "i", boundary: true},
+	}
+
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{name: "bold and italic", text: "**bold** and *italic*", want: "<b>bold</b> and <i>italic</i>"},
+		{name: "boundary marker", text: "_whole_ words, not snake_case_names", want: "<i>whole</i> words, not snake_case_names"},
+		{name: "adjacent pairs", text: "_a_ _b_", want: "<i>a</i> <i>b</i>"},
+		{name: "unclosed marker", text: "2 * 3 = 6", want: "2 * 3 = 6"},
+		{name: "no spaces inside markers", text: "* not * italic", want: "* not * italic"},
+		{name: "not across lines", text: "*one\ntwo*", want: "*one\ntwo*"},
+		{name: "unicode", text: "*привет* мир", want: "<i>привет</i> мир"},
+		{name: "bold italic", text: "***x***", want: "<b><i>x</i></b>"},
+		{name: "italic inside bold", text: "**a *b* c**", want: "<b>a <i>b</i> c</b>"},
+		{name: "crossed bold and italic", text: "**a *b** c*", want: "**a <i>b</i>* c*"},
+		{name: "crossed italic and bold", text: "*a **b* c**", want: "<i>a **b</i> c**"},
+		{name: "crossed boundary markers", text: "_a *b_ c*", want: "<i>a *b</i> c*"},
+		{name: "empty pair", text: "****", want: "****"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, applyEmphasis(tt.text, rules...))
+		})
+	}
+}
+
+func TestMarkdownDialectCode(t *testing.T) {
+	plain := func(s string) string { return "[" + s + "]" }
+
+	tests := []struct {
+		name    string
+		dialect markdownDialect
+		text    string
+		want    string
+	}{
+		{
+			name:    "inline code",
+			dialect: markdownDialect{inline: plain},
+			text:    "run `make <all>` now",
+			want:    "[run ]<code>make &lt;all&gt;</code>[ now]",
+		},
+		{
+			name:    "code block with language",
+			dialect: markdownDialect{languages: true, inline: plain},
+			text:    "```go\nfmt.Println(1)\n```",
+			want:    "[]<pre>fmt.Println(1)</pre>[]",
+		},
+		{
+			name:    "first line kept without language support",
+			dialect: markdownDialect{inline: plain},
+			text:    "```ls\n-la```",
+			want:    "[]<pre>ls\n-la</pre>[]",
+		},
+		{
+			name:    "decoded code",
+			dialect: markdownDialect{decode: func(s string) string { return s + "!" }, inline: plain},
+			text:    "`x`",
+			want:    "[]<code>x!</code>[]",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.dialect.convert(tt.text))
+		})
+	}
+}
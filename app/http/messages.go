@@ -0,0 +1,102 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pkarpovich/tg-relay-bot/app/events"
+)
+
+const StatusScheduled events.DeliveryStatus = "scheduled"
+
+type SendResponse struct {
+	Ok         bool                     `json:"ok"`
+	ID         string                   `json:"id"`
+	Status     events.DeliveryStatus    `json:"status,omitempty"`
+	SendAt     *time.Time               `json:"send_at,omitempty"`
+	Recipients []events.RecipientStatus `json:"recipients,omitempty"`
+}
+
+func (s *Server) getMessageHandler(w http.ResponseWriter, r *http.Request) {
+	key, ok := s.authorize(w, r, endpointMessages)
+	if !ok {
+		return
+	}
+
+	delivery, err := s.deliveries.Get(r.PathValue("id"))
+	if errors.Is(err, events.ErrDeliveryNotFound) {
+		scheduled, schedErr := s.scheduler.Get(r.PathValue("id"))
+		if schedErr != nil {
+			s.respondWithError(w, err, http.StatusNotFound)
+			return
+		}
+		if !key.allowsRoute(scheduled.Payload.Route) {
+			s.respondWithError(w, errRouteDenied, http.StatusForbidden)
+			return
+		}
+		s.respondWithJSON(w, SendResponse{Ok: true, ID: scheduled.ID, Status: StatusScheduled, SendAt: &scheduled.SendAt})
+		return
+	}
+	if err != nil {
+		s.respondWithError(w, err, http.StatusInternalServerError)
+		return
+	}
+	if !key.allowsRoute(delivery.Route) {
+		s.respondWithError(w, errRouteDenied, http.StatusForbidden)
+		return
+	}
+
+	s.respondWithJSON(w, delivery)
+}
+
+func (s *Server) respondWithDelivery(w http.ResponseWriter, r *http.Request, id string) {
+	ctx, cancel := context.WithTimeout(r.Context(), s.config.Http.WaitTimeout)
+	defer cancel()
+
+	delivery, err := s.deliveries.Wait(ctx, id)
+	if err != nil && !errors.Is(err, context.DeadlineExceeded) {
+		s.respondWithError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	code := http.StatusOK
+	switch delivery.Status {
+	case events.StatusPending:
+		log.Printf("[WARN] Delivery %s is still pending after %s", id, s.config.Http.WaitTimeout)
+		code = http.StatusAccepted
+	case events.StatusPartial, events.StatusFailed:
+		code = http.StatusBadGateway
+	case events.StatusDelivered:
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	resp := SendResponse{
+		Ok:         delivery.Status == events.StatusDelivered,
+		ID:         id,
+		Status:     delivery.Status,
+		Recipients: delivery.Recipients,
+	}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("[ERROR] Failed to write response: %s", err)
+	}
+}
+
+func parseWait(r *http.Request) (bool, error) {
+	raw := r.URL.Query().Get("wait")
+	if raw == "" {
+		return false, nil
+	}
+
+	wait, err := strconv.ParseBool(raw)
+	if err != nil {
+		return false, fmt.Errorf("invalid wait parameter %q", raw)
+	}
+	return wait, nil
+}
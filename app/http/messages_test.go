@@ -0,0 +1,137 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pkarpovich/tg-relay-bot/app/config"
+	"github.com/pkarpovich/tg-relay-bot/app/events"
+)
+
+type mockDeliveries struct {
+	delivery events.Delivery
+}
+
+func (m *mockDeliveries) Get(id string) (events.Delivery, error) {
+	if id != m.delivery.ID {
+		return events.Delivery{}, events.ErrDeliveryNotFound
+	}
+	return m.delivery, nil
+}
+
+func (m *mockDeliveries) Wait(ctx context.Context, id string) (events.Delivery, error) {
+	if m.delivery.Status == events.StatusPending {
+		<-ctx.Done()
+		return m.delivery, ctx.Err()
+	}
+	return m.Get(id)
+}
+
+func TestSendHandlerWait(t *testing.T) {
+	tests := []struct {
+		name       string
+		query      string
+		delivery   events.Delivery
+		wantStatus int
+		wantResp   SendResponse
+	}{
+		{
+			name:       "async mode returns the delivery id",
+			delivery:   events.Delivery{ID: "delivery-1", Status: events.StatusPending},
+			wantStatus: http.StatusOK,
+			wantResp:   SendResponse{Ok: true, ID: "delivery-1"},
+		},
+		{
+			name:  "sync mode returns message ids",
+			query: "?wait=true",
+			delivery: events.Delivery{
+				ID:         "delivery-1",
+				Status:     events.StatusDelivered,
+				Recipients: []events.RecipientStatus{{ChatID: 111, Status: events.StatusDelivered, Parts: 1, MessageIDs: []int{42}}},
+			},
+			wantStatus: http.StatusOK,
+			wantResp: SendResponse{
+				Ok:         true,
+				ID:         "delivery-1",
+				Status:     events.StatusDelivered,
+				Recipients: []events.RecipientStatus{{ChatID: 111, Status: events.StatusDelivered, Parts: 1, MessageIDs: []int{42}}},
+			},
+		},
+		{
+			name:  "sync mode reports failed recipients",
+			query: "?wait=1",
+			delivery: events.Delivery{
+				ID:         "delivery-1",
+				Status:     events.StatusFailed,
+				Recipients: []events.RecipientStatus{{ChatID: 111, Status: events.StatusFailed, Parts: 1, Error: "chat not found"}},
+			},
+			wantStatus: http.StatusBadGateway,
+			wantResp: SendResponse{
+				ID:         "delivery-1",
+				Status:     events.StatusFailed,
+				Recipients: []events.RecipientStatus{{ChatID: 111, Status: events.StatusFailed, Parts: 1, Error: "chat not found"}},
+			},
+		},
+		{
+			name:       "sync mode times out while pending",
+			query:      "?wait=true",
+			delivery:   events.Delivery{ID: "delivery-1", Status: events.StatusPending},
+			wantStatus: http.StatusAccepted,
+			wantResp:   SendResponse{ID: "delivery-1", Status: events.StatusPending},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := &Server{
+				config: &config.Config{
+					Http: config.HttpConfig{SecretApiKey: "test-secret", WaitTimeout: 20 * time.Millisecond},
+				},
+				dispatcher: &mockDispatcher{},
+				deliveries: &mockDeliveries{delivery: tt.delivery},
+			}
+			srv.keys = newKeyRegistry(srv.config.Http)
+
+			req := httptest.NewRequest(http.MethodPost, "/send"+tt.query, strings.NewReader(`{"message": "hello"}`))
+			req.Header.Set("X-Secret", "test-secret")
+			rec := httptest.NewRecorder()
+
+			srv.sendHandler(rec, req)
+
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			var resp SendResponse
+			require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+			assert.Equal(t, tt.wantResp, resp)
+		})
+	}
+}
+
+func TestGetMessageHandler(t *testing.T) {
+	srv := &Server{
+		config: &config.Config{
+			Http: config.HttpConfig{SecretApiKey: "test-secret"},
+		},
+		deliveries: &mockDeliveries{delivery: events.Delivery{ID: "known", Status: events.StatusDelivered}},
+		scheduler:  &mockScheduler{},
+	}
+	srv.keys = newKeyRegistry(srv.config.Http)
+
+	for id, wantStatus := range map[string]int{"known": http.StatusOK, "unknown": http.StatusNotFound} {
+		req := httptest.NewRequest(http.MethodGet, "/messages/"+id, http.NoBody)
+		req.SetPathValue("id", id)
+		req.Header.Set("X-Secret", "test-secret")
+		rec := httptest.NewRecorder()
+
+		srv.getMessageHandler(rec, req)
+
+		assert.Equal(t, wantStatus, rec.Code, id)
+	}
+}
@@ -0,0 +1,225 @@
+package http
+
+import (
+	"encoding/base64"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	tbapi "github.com/OvyFlash/telegram-bot-api"
+	"github.com/pkarpovich/tg-relay-bot/app/events"
+)
+
+// maxPublishBody matches ntfy's default attachment size limit.
+const maxPublishBody = 15 << 20
+
+var (
+	ntfyPriorities = map[string]int{
+		"1": 1, "min": 1, "2": 2, "low": 2, "3": 3, "default": 3,
+		"4": 4, "high": 4, "5": 5, "max": 5, "urgent": 5,
+	}
+	// ntfyEmojis are the tags ntfy shows as emojis in front of the title.
+	ntfyEmojis = map[string]string{
+		"+1": "👍", "-1": "👎", "warning": "⚠️", "rotating_light": "🚨", "white_check_mark": "✅",
+		"heavy_check_mark": "✔️", "x": "❌", "no_entry": "⛔", "tada": "🎉", "partying_face": "🥳",
+		"skull": "💀", "fire": "🔥", "loudspeaker": "📢", "computer": "💻", "bell": "🔔",
+		"hourglass": "⌛", "floppy_disk": "💾", "lock": "🔒", "bug": "🐛", "rocket": "🚀",
+	}
+	ntfyDialect = markdownDialect{languages: true, inline: linkedMarkdown([]emphasis{
+		{marker: "**", tag: "b"},
+		{marker: "__", tag: "b", boundary: true},
+		{marker: "~~", tag: "s"},
+		{marker: "*", tag: "i"},
+		{marker: "_", tag: "i", boundary: true},
+	})}
+)
+
+// ntfyMessage is what ntfy answers a publish with, trimmed to the fields scripts read.
+type ntfyMessage struct {
+	ID      string `json:"id"`
+	Time    int64  `json:"time"`
+	Event   string `json:"event"`
+	Topic   string `json:"topic"`
+	Title   string `json:"title,omitempty"`
+	Message string `json:"message"`
+}
+
+// ntfyHandler publishes to the route named by the topic, the way ntfy does: the body
+// is the message, or an attachment when it's binary or comes with a filename, and the
+// options come from headers or query parameters.
+func (s *Server) ntfyHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	key, ok := s.authorizeSecret(w, r, endpointSend, ntfySecret(r))
+	if !ok {
+		return
+	}
+	topic := r.PathValue("topic")
+	if _, ok := s.config.Routes[topic]; !ok {
+		s.respondWithError(w, fmt.Errorf("%w %q", events.ErrUnknownRoute, topic), http.StatusNotFound)
+		return
+	}
+	if !key.allowsRoute(topic) {
+		s.respondWithError(w, errRouteDenied, http.StatusForbidden)
+		return
+	}
+
+	body, ok := s.readBodyLimit(w, r, maxPublishBody)
+	if !ok {
+		return
+	}
+
+	payload, msg, err := s.ntfyPayload(r, body)
+	if err != nil {
+		s.respondWithError(w, err, http.StatusBadRequest)
+		return
+	}
+	payload.Route = topic
+
+	log.Printf("[INFO] Received ntfy message for topic %q", topic)
+	id, err := s.dispatchOnce(w, r, "ntfy", keyCaller(key), payload, time.Time{})
+	if err != nil {
+		s.respondWithError(w, err, http.StatusInternalServerError)
+		return
+	}
+	msg.ID, msg.Time, msg.Event, msg.Topic = id, time.Now().Unix(), "message", topic
+	s.respondWithJSON(w, msg)
+}
+
+func (s *Server) ntfyPayload(r *http.Request, body []byte) (events.MessagePayload, ntfyMessage, error) {
+	priority := 3
+	if p := ntfyParam(r, "Priority", "Prio", "P"); p != "" {
+		var ok bool
+		if priority, ok = ntfyPriorities[strings.ToLower(p)]; !ok {
+			return events.MessagePayload{}, ntfyMessage{}, fmt.Errorf("invalid priority %q", p)
+		}
+	}
+
+	var attachment *events.Attachment
+	message := ntfyParam(r, "Message", "M")
+	filename := ntfyParam(r, "Filename", "File", "F")
+	if filename != "" || !utf8.Valid(body) {
+		name := ntfyFilename(filename, body)
+		attachment = &events.Attachment{Name: name, ContentType: attachmentContentType(name, body), Data: body}
+	} else if message == "" {
+		message = strings.TrimSpace(string(body))
+	}
+	if message == "" {
+		message = "triggered"
+	}
+	title := ntfyParam(r, "Title", "Ti", "T")
+
+	var emojis, tags []string
+	for _, tag := range strings.Split(ntfyParam(r, "Tags", "Tag", "Ta"), ",") {
+		tag = strings.TrimSpace(tag)
+		if emoji, ok := ntfyEmojis[tag]; ok {
+			emojis = append(emojis, emoji)
+		} else if tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+
+	var sb strings.Builder
+	heading := strings.TrimSpace(strings.Join(emojis, "") + " " + title)
+	if title != "" {
+		sb.WriteString("<b>" + events.EscapeHTML(heading) + "</b>\n")
+	} else if heading != "" {
+		sb.WriteString(heading + " ")
+	}
+	if ntfyMarkdown(r) {
+		sb.WriteString(ntfyDialect.convert(message) + "\n")
+	} else {
+		sb.WriteString(events.EscapeHTML(message) + "\n")
+	}
+	if len(tags) > 0 {
+		sb.WriteString("<i>Tags: " + events.EscapeHTML(strings.Join(tags, ", ")) + "</i>\n")
+	}
+
+	payload := events.MessagePayload{ParseMode: tbapi.ModeHTML, Silent: priority <= 2}
+	if attach := ntfyParam(r, "Attach", "A"); attach != "" {
+		image, err := s.fetchImage(r.Context(), attach)
+		if err != nil {
+			log.Printf("[WARN] Failed to fetch ntfy attachment %s, linking it instead: %s", attach, err)
+			sb.WriteString(htmlLink(attach, ntfyFilename(filename, nil)) + "\n")
+		} else {
+			payload.Attachments = append(payload.Attachments, image)
+		}
+	}
+	writeLinks(&sb, "Open", ntfyParam(r, "Click"))
+	if attachment != nil {
+		payload.Attachments = append(payload.Attachments, *attachment)
+	}
+
+	payload.Text = strings.TrimSpace(sb.String())
+	return payload, ntfyMessage{Title: title, Message: message}, nil
+}
+
+// ntfyParam reads an option from its X- header, its plain header or its lowercase
+// query parameter, trying each of the option's aliases in turn.
+func ntfyParam(r *http.Request, names ...string) string {
+	for _, name := range names {
+		for _, v := range []string{r.Header.Get("X-" + name), r.Header.Get(name), r.URL.Query().Get(strings.ToLower(name))} {
+			if v != "" {
+				return v
+			}
+		}
+	}
+	return ""
+}
+
+func ntfyMarkdown(r *http.Request) bool {
+	if contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); contentType == "text/markdown" {
+		return true
+	}
+	switch strings.ToLower(ntfyParam(r, "Markdown", "Md")) {
+	case "1", "yes", "true":
+		return true
+	default:
+		return false
+	}
+}
+
+func ntfyFilename(name string, data []byte) string {
+	if name != "" {
+		return path.Base(name)
+	}
+	if data == nil {
+		return "attachment"
+	}
+	contentType := http.DetectContentType(data)
+	if ext, ok := imageExtensions[contentType]; ok {
+		return "attachment" + ext
+	}
+	if exts, _ := mime.ExtensionsByType(contentType); len(exts) > 0 {
+		return "attachment" + exts[0]
+	}
+	return "attachment.bin"
+}
+
+// ntfySecret takes the API key from X-Secret, or from an Authorization header or auth
+// query parameter the way ntfy clients send their access tokens: as a bearer token,
+// as the basic auth password, or as the base64-encoded header value.
+func ntfySecret(r *http.Request) string {
+	if secret := r.Header.Get("X-Secret"); secret != "" {
+		return secret
+	}
+	auth := r.Header.Get("Authorization")
+	if encoded := r.URL.Query().Get("auth"); auth == "" && encoded != "" {
+		if decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(encoded, "=")); err == nil {
+			auth = string(decoded)
+		}
+	}
+	if token, ok := strings.CutPrefix(auth, "Bearer "); ok {
+		return token
+	}
+	req := http.Request{Header: http.Header{"Authorization": {auth}}}
+	if _, password, ok := req.BasicAuth(); ok {
+		return password
+	}
+	return ""
+}
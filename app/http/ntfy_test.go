@@ -0,0 +1,129 @@
+package http
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pkarpovich/tg-relay-bot/app/config"
+)
+
+func TestNtfyHandler(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		headers    map[string]string
+		body       string
+		wantStatus int
+		wantText   string
+		wantSilent bool
+		wantFile   string
+	}{
+		{
+			name: "plain message", method: http.MethodPut, target: "/ci",
+			headers:    map[string]string{"X-Secret": "ci-key"},
+			body:       "Backup done",
+			wantStatus: http.StatusOK, wantText: "Backup done",
+		},
+		{
+			name: "title, tags and click", method: http.MethodPost, target: "/ci",
+			headers: map[string]string{
+				"Authorization": "Bearer ci-key", "Title": "Disk <full>", "Tags": "warning,prod",
+				"Click": "https://grafana.local/d/1",
+			},
+			body:       "95% used",
+			wantStatus: http.StatusOK,
+			wantText:   "<b>⚠️ Disk &lt;full&gt;</b>\n95% used\n<i>Tags: prod</i>\n<a href=\"https://grafana.local/d/1\">Open</a>",
+		},
+		{
+			name: "low priority from query", method: http.MethodPost,
+			target:     "/ci?auth=" + base64.RawURLEncoding.EncodeToString([]byte("Basic "+base64.StdEncoding.EncodeToString([]byte(":ci-key")))) + "&priority=low&title=Nightly",
+			body:       "ok",
+			wantStatus: http.StatusOK, wantText: "<b>Nightly</b>\nok", wantSilent: true,
+		},
+		{
+			name: "markdown", method: http.MethodPost, target: "/ci",
+			headers:    map[string]string{"X-Secret": "ci-key", "Markdown": "yes"},
+			body:       "**bold** and _it_",
+			wantStatus: http.StatusOK, wantText: "<b>bold</b> and <i>it</i>",
+		},
+		{
+			name: "file body", method: http.MethodPut, target: "/ci",
+			headers:    map[string]string{"X-Secret": "ci-key", "Filename": "report.csv"},
+			body:       "a,b\n1,2\n",
+			wantStatus: http.StatusOK, wantText: "triggered", wantFile: "report.csv",
+		},
+		{
+			name: "invalid priority", method: http.MethodPost, target: "/ci",
+			headers:    map[string]string{"X-Secret": "ci-key", "Priority": "loud"},
+			body:       "hi",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name: "route outside key scope", method: http.MethodPost, target: "/ops",
+			headers:    map[string]string{"X-Secret": "ci-key"},
+			body:       "hi",
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name: "unknown topic", method: http.MethodPost, target: "/nope",
+			headers:    map[string]string{"X-Secret": "ci-key"},
+			body:       "hi",
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name: "unknown topic without a key", method: http.MethodPost, target: "/nope",
+			body:       "hi",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "missing key", method: http.MethodPost, target: "/ci",
+			body:       "hi",
+			wantStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dispatcher := &mockDispatcher{}
+			srv := CreateServer(&config.Config{
+				Http: config.HttpConfig{APIKeys: []config.APIKeyConfig{
+					{Name: "ci", Key: "ci-key", Endpoints: []string{"send"}, Routes: []string{"ci"}},
+				}},
+				Routes: map[string]config.RouteConfig{"ci": {ChatID: -1001}, "ops": {ChatID: -1002}},
+			}, dispatcher, nil, nil, nil)
+
+			req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+			srv.server.Handler.ServeHTTP(rec, req)
+
+			require.Equal(t, tt.wantStatus, rec.Code, rec.Body.String())
+			if tt.wantStatus != http.StatusOK {
+				assert.Empty(t, dispatcher.payloads)
+				return
+			}
+			assert.Contains(t, rec.Body.String(), `"topic":"ci"`)
+			require.Len(t, dispatcher.payloads, 1)
+			payload := dispatcher.payloads[0]
+			assert.Equal(t, "ci", payload.Route)
+			assert.Equal(t, tt.wantText, payload.Text)
+			assert.Equal(t, tt.wantSilent, payload.Silent)
+			if tt.wantFile != "" {
+				require.Len(t, payload.Attachments, 1)
+				assert.Equal(t, tt.wantFile, payload.Attachments[0].Name)
+				assert.Equal(t, tt.body, string(payload.Attachments[0].Data))
+			} else {
+				assert.Empty(t, payload.Attachments)
+			}
+		})
+	}
+}
@@ -0,0 +1,185 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pkarpovich/tg-relay-bot/app/events"
+)
+
+// receiverTokenHeaders are the headers services send their webhook token in.
+var receiverTokenHeaders = map[string]string{"gitlab": "X-Gitlab-Token"}
+
+// errIgnored is returned by a converter for events that are valid but not relayed.
+var errIgnored = errors.New("event ignored")
+
+// converter turns the body of a third-party webhook into a message.
+type converter func(r *http.Request, body []byte) (events.MessagePayload, error)
+
+// handleReceiver registers a webhook receiver for a third-party service at
+// /webhook/{name}, with an optional token as the next path segment.
+func (s *Server) handleReceiver(mux *http.ServeMux, name string, convert converter) {
+	handler := s.receiverHandler(name, convert)
+	mux.HandleFunc("POST /webhook/"+name, handler)
+	mux.HandleFunc("POST /webhook/"+name+"/{token}", handler)
+}
+
+func (s *Server) receiverHandler(name string, convert converter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		body, ok := s.readBody(w, r)
+		if !ok {
+			return
+		}
+		route, caller, ok := s.authorizeReceiver(w, r, name, body)
+		if !ok {
+			return
+		}
+
+		// sources and routes named like a receiver predate it, so their templates and
+		// generic {"content": "..."} bodies keep working
+		if tmpl, ok := s.templates[name]; ok {
+			s.templateWebhook(w, r, name, caller, tmpl, body, route)
+			return
+		}
+		if content, ok := genericContent(body); ok {
+			s.relayContent(w, r, name, caller, content, route)
+			return
+		}
+
+		payload, err := convert(r, body)
+		if errors.Is(err, errIgnored) {
+			log.Printf("[INFO] Ignored %s webhook: %s", name, err)
+			s.respondWithJSON(w, SendResponse{Ok: true})
+			return
+		}
+		if err != nil {
+			s.respondWithError(w, fmt.Errorf("parse %s webhook: %w", name, err), http.StatusBadRequest)
+			return
+		}
+		payload.Route = route
+
+		log.Printf("[INFO] Received %s webhook", name)
+		id, err := s.dispatchOnce(w, r, name, caller, payload, time.Time{})
+		if err != nil {
+			s.respondWithError(w, err, http.StatusInternalServerError)
+			return
+		}
+		s.respondWithJSON(w, SendResponse{Ok: true, ID: id})
+	}
+}
+
+// authorizeReceiver checks a receiver request like a webhook source when one is
+// configured under the receiver's name, and with an API key otherwise. The route
+// comes from the route query parameter unless the source has its own; API key
+// requests without one go to a route named like the receiver when there is one. It returns the
+// route and the caller the request came from.
+func (s *Server) authorizeReceiver(w http.ResponseWriter, r *http.Request, name string, body []byte) (string, string, bool) {
+	route := r.URL.Query().Get("route")
+	if !s.hasRoute(route) {
+		s.respondWithError(w, fmt.Errorf("%w %q", events.ErrUnknownRoute, route), http.StatusNotFound)
+		return "", "", false
+	}
+
+	if source, ok := s.config.Webhooks[name]; ok {
+		if source.TokenHeader == "" {
+			source.TokenHeader = receiverTokenHeaders[name]
+		}
+		if !s.authorizeSource(w, r, source, body) {
+			return "", "", false
+		}
+		if source.Route == "" {
+			return route, sourceCaller(name), true
+		}
+		if route != "" && route != source.Route {
+			s.respondWithError(w, errRouteDenied, http.StatusForbidden)
+			return "", "", false
+		}
+		return source.Route, sourceCaller(name), true
+	}
+
+	key, ok := s.authorize(w, r, endpointWebhook)
+	if !ok {
+		return "", "", false
+	}
+	if _, ok := s.config.Routes[name]; ok && route == "" {
+		route = name
+	}
+	if !key.allowsRoute(route) {
+		s.respondWithError(w, errRouteDenied, http.StatusForbidden)
+		return "", "", false
+	}
+	return route, keyCaller(key), true
+}
+
+// genericContent returns the content of a generic webhook body, which no receiver's
+// own payload has at its top level.
+func genericContent(body []byte) (string, bool) {
+	var data struct {
+		Content string `json:"content"`
+	}
+	if err := json.Unmarshal(body, &data); err != nil || data.Content == "" {
+		return "", false
+	}
+	return data.Content, true
+}
+
+// relays reports whether the source configured under name lets an event through.
+// Events without a branch, like releases and issues, only go through the event filter.
+func (s *Server) relays(name, event, branch string) bool {
+	source := s.config.Webhooks[name]
+	if len(source.Events) > 0 && !slices.Contains(source.Events, event) {
+		return false
+	}
+	if branch == "" || len(source.Branches) == 0 {
+		return true
+	}
+	for _, pattern := range source.Branches {
+		if ok, _ := path.Match(pattern, branch); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) readBody(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	return s.readBodyLimit(w, r, maxWebhookBody)
+}
+
+func (s *Server) readBodyLimit(w http.ResponseWriter, r *http.Request, limit int64) ([]byte, bool) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, limit))
+	if err != nil {
+		s.respondWithError(w, err, requestErrorStatus(err))
+		return nil, false
+	}
+	return body, true
+}
+
+// requestErrorStatus is 413 for bodies over their limit and 400 for other bad requests.
+func requestErrorStatus(err error) int {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusBadRequest
+}
+
+// htmlLink renders an HTML link for http(s) URLs and the escaped text otherwise.
+func htmlLink(href, text string) string {
+	u, err := url.Parse(href)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return events.EscapeHTML(text)
+	}
+	escaped := strings.ReplaceAll(events.EscapeHTML(u.String()), `"`, "&quot;")
+	return `<a href="` + escaped + `">` + events.EscapeHTML(text) + `</a>`
+}
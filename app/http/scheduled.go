@@ -0,0 +1,112 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/pkarpovich/tg-relay-bot/app/events"
+)
+
+type ScheduledResponse struct {
+	Scheduled []events.ScheduledMessage `json:"scheduled"`
+}
+
+func (s *Server) listScheduledHandler(w http.ResponseWriter, r *http.Request) {
+	key, ok := s.authorize(w, r, endpointScheduled)
+	if !ok {
+		return
+	}
+
+	scheduled, err := s.scheduler.List()
+	if err != nil {
+		s.respondWithError(w, err, http.StatusInternalServerError)
+		return
+	}
+	scheduled = slices.DeleteFunc(scheduled, func(msg events.ScheduledMessage) bool {
+		return !key.allowsRoute(msg.Payload.Route)
+	})
+
+	s.respondWithJSON(w, ScheduledResponse{Scheduled: scheduled})
+}
+
+func (s *Server) getScheduledHandler(w http.ResponseWriter, r *http.Request) {
+	scheduled, ok := s.authorizedScheduled(w, r)
+	if !ok {
+		return
+	}
+
+	s.respondWithJSON(w, scheduled)
+}
+
+func (s *Server) cancelScheduledHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := s.authorizedScheduled(w, r); !ok {
+		return
+	}
+
+	if err := s.scheduler.Cancel(r.PathValue("id")); err != nil {
+		s.respondWithError(w, err, scheduledErrorStatus(err))
+		return
+	}
+
+	log.Printf("[INFO] Canceled scheduled message %s", r.PathValue("id"))
+	s.respondWithJSON(w, HealthResponse{Ok: true})
+}
+
+// authorizedScheduled looks up the scheduled message in the path and checks that the
+// API key may use its route.
+func (s *Server) authorizedScheduled(w http.ResponseWriter, r *http.Request) (events.ScheduledMessage, bool) {
+	key, ok := s.authorize(w, r, endpointScheduled)
+	if !ok {
+		return events.ScheduledMessage{}, false
+	}
+
+	scheduled, err := s.scheduler.Get(r.PathValue("id"))
+	if err != nil {
+		s.respondWithError(w, err, scheduledErrorStatus(err))
+		return events.ScheduledMessage{}, false
+	}
+	if !key.allowsRoute(scheduled.Payload.Route) {
+		s.respondWithError(w, errRouteDenied, http.StatusForbidden)
+		return events.ScheduledMessage{}, false
+	}
+	return scheduled, true
+}
+
+// parseSchedule turns the send_at and delay request fields into a delivery time.
+// It returns the zero time when the message should be sent right away.
+func parseSchedule(sendAt *time.Time, delay string, now time.Time) (time.Time, error) {
+	if sendAt != nil && delay != "" {
+		return time.Time{}, errors.New("send_at and delay are mutually exclusive")
+	}
+
+	var at time.Time
+	switch {
+	case sendAt != nil:
+		at = *sendAt
+	case delay != "":
+		d, err := time.ParseDuration(delay)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid delay %q: %w", delay, err)
+		}
+		if d < 0 {
+			return time.Time{}, fmt.Errorf("invalid delay %q: must not be negative", delay)
+		}
+		at = now.Add(d)
+	}
+
+	if !at.After(now) {
+		return time.Time{}, nil
+	}
+	return at, nil
+}
+
+func scheduledErrorStatus(err error) int {
+	if errors.Is(err, events.ErrScheduledMessageNotFound) {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,173 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pkarpovich/tg-relay-bot/app/config"
+	"github.com/pkarpovich/tg-relay-bot/app/events"
+)
+
+type mockScheduler struct {
+	scheduled []events.ScheduledMessage
+}
+
+func (m *mockScheduler) Schedule(payload events.MessagePayload, at time.Time) (string, error) {
+	msg := events.ScheduledMessage{ID: "scheduled-1", Payload: payload, SendAt: at}
+	m.scheduled = append(m.scheduled, msg)
+	return msg.ID, nil
+}
+
+func (m *mockScheduler) List() ([]events.ScheduledMessage, error) {
+	return m.scheduled, nil
+}
+
+func (m *mockScheduler) Get(id string) (events.ScheduledMessage, error) {
+	for _, msg := range m.scheduled {
+		if msg.ID == id {
+			return msg, nil
+		}
+	}
+	return events.ScheduledMessage{}, events.ErrScheduledMessageNotFound
+}
+
+func (m *mockScheduler) Cancel(id string) error {
+	for i, msg := range m.scheduled {
+		if msg.ID == id {
+			m.scheduled = append(m.scheduled[:i], m.scheduled[i+1:]...)
+			return nil
+		}
+	}
+	return events.ErrScheduledMessageNotFound
+}
+
+func TestSendHandlerSchedule(t *testing.T) {
+	future := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+
+	tests := []struct {
+		name          string
+		query         string
+		body          map[string]any
+		wantStatus    int
+		wantScheduled bool
+	}{
+		{
+			name:          "send_at in the future is scheduled",
+			body:          map[string]any{"message": "hello", "send_at": future},
+			wantStatus:    http.StatusOK,
+			wantScheduled: true,
+		},
+		{
+			name:          "delay is scheduled",
+			body:          map[string]any{"message": "hello", "delay": "90m"},
+			wantStatus:    http.StatusOK,
+			wantScheduled: true,
+		},
+		{
+			name:       "send_at in the past is sent right away",
+			body:       map[string]any{"message": "hello", "send_at": time.Now().Add(-time.Hour)},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "send_at and delay together",
+			body:       map[string]any{"message": "hello", "send_at": future, "delay": "1h"},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "invalid delay",
+			body:       map[string]any{"message": "hello", "delay": "soon"},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "wait with schedule",
+			query:      "?wait=true",
+			body:       map[string]any{"message": "hello", "delay": "1h"},
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dispatcher := &mockDispatcher{}
+			scheduler := &mockScheduler{}
+			srv := &Server{
+				config: &config.Config{
+					Http: config.HttpConfig{SecretApiKey: "test-secret"},
+				},
+				dispatcher: dispatcher,
+				scheduler:  scheduler,
+			}
+			srv.keys = newKeyRegistry(srv.config.Http)
+
+			body, err := json.Marshal(tt.body)
+			require.NoError(t, err)
+			req := httptest.NewRequest(http.MethodPost, "/send"+tt.query, bytes.NewReader(body))
+			req.Header.Set("X-Secret", "test-secret")
+			rec := httptest.NewRecorder()
+
+			srv.sendHandler(rec, req)
+
+			require.Equal(t, tt.wantStatus, rec.Code)
+			if tt.wantStatus != http.StatusOK {
+				assert.Empty(t, dispatcher.payloads)
+				assert.Empty(t, scheduler.scheduled)
+				return
+			}
+
+			var resp SendResponse
+			require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+			if !tt.wantScheduled {
+				assert.Len(t, dispatcher.payloads, 1)
+				assert.Empty(t, scheduler.scheduled)
+				return
+			}
+
+			assert.Empty(t, dispatcher.payloads)
+			require.Len(t, scheduler.scheduled, 1)
+			assert.Equal(t, StatusScheduled, resp.Status)
+			assert.Equal(t, "scheduled-1", resp.ID)
+			require.NotNil(t, resp.SendAt)
+			assert.True(t, resp.SendAt.After(time.Now()))
+		})
+	}
+}
+
+func TestScheduledHandlers(t *testing.T) {
+	scheduler := &mockScheduler{scheduled: []events.ScheduledMessage{{ID: "s1", SendAt: time.Now().Add(time.Hour)}}}
+	srv := &Server{
+		config: &config.Config{
+			Http: config.HttpConfig{SecretApiKey: "test-secret"},
+		},
+		deliveries: &mockDeliveries{},
+		scheduler:  scheduler,
+	}
+	srv.keys = newKeyRegistry(srv.config.Http)
+
+	req := httptest.NewRequest(http.MethodGet, "/messages/s1", http.NoBody)
+	req.SetPathValue("id", "s1")
+	req.Header.Set("X-Secret", "test-secret")
+	rec := httptest.NewRecorder()
+	srv.getMessageHandler(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	var resp SendResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+	assert.Equal(t, StatusScheduled, resp.Status)
+
+	req = httptest.NewRequest(http.MethodDelete, "/scheduled/s1", http.NoBody)
+	req.SetPathValue("id", "s1")
+	req.Header.Set("X-Secret", "test-secret")
+	rec = httptest.NewRecorder()
+	srv.cancelScheduledHandler(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec = httptest.NewRecorder()
+	srv.cancelScheduledHandler(rec, req)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
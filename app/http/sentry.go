@@ -0,0 +1,128 @@
+package http
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	tbapi "github.com/OvyFlash/telegram-bot-api"
+	"github.com/pkarpovich/tg-relay-bot/app/events"
+)
+
+// quietSentryLevels are the event levels and metric alert actions sent without a
+// notification.
+var quietSentryLevels = map[string]bool{"debug": true, "info": true, "warning": true, "resolved": true}
+
+type sentryEvent struct {
+	Title   string `json:"title"`
+	Message string `json:"message"`
+	Culprit string `json:"culprit"`
+	Level   string `json:"level"`
+	WebURL  string `json:"web_url"`
+}
+
+// sentryPayload covers issue alerts, both from the legacy webhooks plugin with their
+// fields at the top level and from integrations with the event under data, and metric
+// alerts from integrations.
+type sentryPayload struct {
+	ProjectName string      `json:"project_name"`
+	ProjectSlug string      `json:"project_slug"`
+	Culprit     string      `json:"culprit"`
+	Level       string      `json:"level"`
+	Message     string      `json:"message"`
+	URL         string      `json:"url"`
+	Event       sentryEvent `json:"event"`
+
+	Action string `json:"action"`
+	Data   struct {
+		Event         *sentryEvent `json:"event"`
+		TriggeredRule string       `json:"triggered_rule"`
+
+		MetricAlert *struct {
+			Title     string `json:"title"`
+			AlertRule struct {
+				Name     string   `json:"name"`
+				Projects []string `json:"projects"`
+			} `json:"alert_rule"`
+		} `json:"metric_alert"`
+		DescriptionTitle string `json:"description_title"`
+		DescriptionText  string `json:"description_text"`
+		WebURL           string `json:"web_url"`
+	} `json:"data"`
+}
+
+// convertSentry renders Sentry issue and metric alerts. Issues at warning level and
+// below, warning metric alerts and resolved metric alerts are sent silently.
+func convertSentry(r *http.Request, body []byte) (events.MessagePayload, error) {
+	var p sentryPayload
+	if err := json.Unmarshal(body, &p); err != nil {
+		return events.MessagePayload{}, err
+	}
+
+	resource := r.Header.Get("Sentry-Hook-Resource")
+	switch {
+	case resource != "" && resource != "event_alert" && resource != "metric_alert":
+		return events.MessagePayload{}, fmt.Errorf("%w: sentry resource %q", errIgnored, resource)
+	case p.Data.MetricAlert != nil:
+		return sentryMetricAlert(p), nil
+	case p.Data.Event != nil:
+		return sentryIssueAlert(p.ProjectSlug, *p.Data.Event, p.Data.Event.WebURL, p.Data.TriggeredRule), nil
+	case p.URL != "" || p.ProjectName != "":
+		event := p.Event
+		event.Culprit = cmp.Or(p.Culprit, event.Culprit)
+		event.Level = cmp.Or(p.Level, event.Level)
+		event.Message = cmp.Or(p.Message, event.Message)
+		return sentryIssueAlert(cmp.Or(p.ProjectName, p.ProjectSlug), event, p.URL, ""), nil
+	default:
+		return events.MessagePayload{}, errors.New("not a sentry alert")
+	}
+}
+
+func sentryIssueAlert(project string, e sentryEvent, link, rule string) events.MessagePayload {
+	level := cmp.Or(e.Level, "error")
+	header := "[" + strings.ToUpper(level) + "]"
+	if project != "" {
+		header += " " + project
+	}
+
+	var sb strings.Builder
+	sb.WriteString("<b>" + events.EscapeHTML(header) + "</b>\n")
+	sb.WriteString(htmlLink(link, cmp.Or(e.Title, e.Message, "Sentry issue")) + "\n")
+	if e.Culprit != "" {
+		sb.WriteString("<code>" + events.EscapeHTML(e.Culprit) + "</code>\n")
+	}
+	if rule != "" {
+		sb.WriteString("<i>Rule: " + events.EscapeHTML(rule) + "</i>\n")
+	}
+
+	return events.MessagePayload{
+		Text:      strings.TrimSpace(sb.String()),
+		ParseMode: tbapi.ModeHTML,
+		Silent:    quietSentryLevels[level],
+	}
+}
+
+func sentryMetricAlert(p sentryPayload) events.MessagePayload {
+	alert := p.Data.MetricAlert
+	title := cmp.Or(p.Data.DescriptionTitle, alert.Title, alert.AlertRule.Name)
+	action := cmp.Or(p.Action, "triggered")
+
+	var sb strings.Builder
+	sb.WriteString("<b>" + events.EscapeHTML("["+strings.ToUpper(action)+"] "+title) + "</b>\n")
+	if p.Data.DescriptionText != "" {
+		sb.WriteString(events.EscapeHTML(p.Data.DescriptionText) + "\n")
+	}
+	if len(alert.AlertRule.Projects) > 0 {
+		sb.WriteString("<i>" + events.EscapeHTML(strings.Join(alert.AlertRule.Projects, ", ")) + "</i>\n")
+	}
+	writeLinks(&sb, "Open in Sentry", p.Data.WebURL)
+
+	return events.MessagePayload{
+		Text:      strings.TrimSpace(sb.String()),
+		ParseMode: tbapi.ModeHTML,
+		Silent:    quietSentryLevels[action],
+	}
+}
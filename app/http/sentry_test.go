@@ -0,0 +1,129 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pkarpovich/tg-relay-bot/app/config"
+)
+
+func TestConvertSentry(t *testing.T) {
+	tests := []struct {
+		name       string
+		resource   string
+		body       string
+		want       string
+		wantSilent bool
+		wantErr    bool
+		ignored    bool
+	}{
+		{
+			name: "legacy issue alert",
+			body: `{
+				"project_name": "backend",
+				"project_slug": "backend",
+				"culprit": "app.handlers in process_order",
+				"level": "error",
+				"message": "KeyError: 'sku'",
+				"url": "https://sentry.io/organizations/acme/issues/42/",
+				"event": {"title": "KeyError: 'sku' <order>"}
+			}`,
+			want: `<b>[ERROR] backend</b>
+<a href="https://sentry.io/organizations/acme/issues/42/">KeyError: 'sku' &lt;order&gt;</a>
+<code>app.handlers in process_order</code>`,
+		},
+		{
+			name:     "integration issue alert at warning level",
+			resource: "event_alert",
+			body: `{
+				"action": "triggered",
+				"data": {
+					"event": {"title": "Slow query", "culprit": "db.query", "level": "warning", "web_url": "https://sentry.io/organizations/acme/issues/7/events/abc/"},
+					"triggered_rule": "Slow queries"
+				}
+			}`,
+			want: `<b>[WARNING]</b>
+<a href="https://sentry.io/organizations/acme/issues/7/events/abc/">Slow query</a>
+<code>db.query</code>
+<i>Rule: Slow queries</i>`,
+			wantSilent: true,
+		},
+		{
+			name:     "critical metric alert",
+			resource: "metric_alert",
+			body: `{
+				"action": "critical",
+				"data": {
+					"metric_alert": {"title": "Error rate", "alert_rule": {"name": "Error rate", "projects": ["backend", "web"]}},
+					"description_title": "Critical: Error rate",
+					"description_text": "1204 events in the last 10 minutes",
+					"web_url": "https://sentry.io/organizations/acme/alerts/rules/details/9/"
+				}
+			}`,
+			want: `<b>[CRITICAL] Critical: Error rate</b>
+1204 events in the last 10 minutes
+<i>backend, web</i>
+<a href="https://sentry.io/organizations/acme/alerts/rules/details/9/">Open in Sentry</a>`,
+		},
+		{
+			name:       "resolved metric alert",
+			resource:   "metric_alert",
+			body:       `{"action": "resolved", "data": {"metric_alert": {"alert_rule": {"name": "Error rate"}}}}`,
+			want:       `<b>[RESOLVED] Error rate</b>`,
+			wantSilent: true,
+		},
+		{name: "installation event", resource: "installation", body: `{"action": "created"}`, ignored: true},
+		{name: "unknown payload", body: `{"foo": "bar"}`, wantErr: true},
+		{name: "invalid json", body: `nope`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/webhook/sentry", nil)
+			if tt.resource != "" {
+				req.Header.Set("Sentry-Hook-Resource", tt.resource)
+			}
+
+			payload, err := convertSentry(req, []byte(tt.body))
+			switch {
+			case tt.ignored:
+				assert.ErrorIs(t, err, errIgnored)
+			case tt.wantErr:
+				require.Error(t, err)
+				assert.NotErrorIs(t, err, errIgnored)
+			default:
+				require.NoError(t, err)
+				assert.Equal(t, tt.want, payload.Text)
+				assert.Equal(t, tt.wantSilent, payload.Silent)
+			}
+		})
+	}
+}
+
+func TestSentryReceiver(t *testing.T) {
+	const body = `{"action": "critical", "data": {"metric_alert": {"alert_rule": {"name": "Error rate"}}}}`
+
+	dispatcher := &mockDispatcher{}
+	srv := CreateServer(&config.Config{
+		Routes: map[string]config.RouteConfig{"ops": {ChatID: -1001}},
+		Webhooks: map[string]config.WebhookConfig{
+			"sentry": {Route: "ops", HMACSecret: "client-secret", HMACHeader: "Sentry-Hook-Signature"},
+		},
+	}, dispatcher, nil, nil, nil)
+
+	req := httptest.NewRequest(http.MethodPost, "/webhook/sentry", strings.NewReader(body))
+	req.Header.Set("Sentry-Hook-Resource", "metric_alert")
+	req.Header.Set("Sentry-Hook-Signature", strings.TrimPrefix(sign("client-secret", body), "sha256="))
+	rec := httptest.NewRecorder()
+	srv.server.Handler.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	require.Len(t, dispatcher.payloads, 1)
+	assert.Equal(t, "ops", dispatcher.payloads[0].Route)
+	assert.False(t, dispatcher.payloads[0].Silent)
+}
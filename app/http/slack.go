@@ -0,0 +1,236 @@
+package http
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"html"
+	"net/http"
+	"regexp"
+	"strings"
+
+	tbapi "github.com/OvyFlash/telegram-bot-api"
+	"github.com/pkarpovich/tg-relay-bot/app/events"
+)
+
+var (
+	slackEmphasis = []emphasis{
+		{marker: "*", tag: "b", boundary: true},
+		{marker: "_", tag: "i", boundary: true},
+		{marker: "~", tag: "s", boundary: true},
+	}
+	slackLinkPattern = regexp.MustCompile(`<([^<>\n]+)>`)
+	slackDialect     = markdownDialect{decode: html.UnescapeString, inline: slackInline}
+)
+
+type slackText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// slackElement is an element of a context or actions block: a text object, an image
+// or a button, whose text is an object rather than a string.
+type slackElement struct {
+	Type     string          `json:"type"`
+	Text     json.RawMessage `json:"text"`
+	URL      string          `json:"url"`
+	ImageURL string          `json:"image_url"`
+	AltText  string          `json:"alt_text"`
+}
+
+type slackBlock struct {
+	Type     string         `json:"type"`
+	Text     *slackText     `json:"text"`
+	Fields   []slackText    `json:"fields"`
+	Elements []slackElement `json:"elements"`
+	ImageURL string         `json:"image_url"`
+	AltText  string         `json:"alt_text"`
+}
+
+type slackAttachment struct {
+	Fallback   string `json:"fallback"`
+	Pretext    string `json:"pretext"`
+	AuthorName string `json:"author_name"`
+	Title      string `json:"title"`
+	TitleLink  string `json:"title_link"`
+	Text       string `json:"text"`
+	Fields     []struct {
+		Title string `json:"title"`
+		Value string `json:"value"`
+	} `json:"fields"`
+	Footer   string       `json:"footer"`
+	ImageURL string       `json:"image_url"`
+	Blocks   []slackBlock `json:"blocks"`
+}
+
+// slackMessage is the body Slack incoming webhooks accept.
+type slackMessage struct {
+	Text        string            `json:"text"`
+	Username    string            `json:"username"`
+	Blocks      []slackBlock      `json:"blocks"`
+	Attachments []slackAttachment `json:"attachments"`
+}
+
+// convertSlack renders a Slack incoming webhook message. Blocks replace the text, as
+// they do in Slack, and attachments follow them.
+func convertSlack(_ *http.Request, body []byte) (events.MessagePayload, error) {
+	var msg slackMessage
+	if err := json.Unmarshal(body, &msg); err != nil {
+		return events.MessagePayload{}, err
+	}
+
+	var parts []string
+	if len(msg.Blocks) > 0 {
+		parts = append(parts, slackBlocks(msg.Blocks)...)
+	} else if msg.Text != "" {
+		parts = append(parts, slackMrkdwn(msg.Text))
+	}
+	for _, a := range msg.Attachments {
+		if text := slackAttachmentText(a); text != "" {
+			parts = append(parts, text)
+		}
+	}
+
+	if len(parts) == 0 {
+		return events.MessagePayload{}, errors.New("text, blocks or attachments are required")
+	}
+	if msg.Username != "" {
+		parts = append([]string{"<b>" + events.EscapeHTML(msg.Username) + "</b>"}, parts...)
+	}
+	return events.MessagePayload{Text: strings.Join(parts, "\n\n"), ParseMode: tbapi.ModeHTML}, nil
+}
+
+func slackBlocks(blocks []slackBlock) []string {
+	var parts []string
+	for _, b := range blocks {
+		var lines []string
+		switch b.Type {
+		case "header":
+			if b.Text != nil {
+				lines = append(lines, "<b>"+events.EscapeHTML(b.Text.Text)+"</b>")
+			}
+		case "section":
+			if b.Text != nil {
+				lines = append(lines, slackTextObject(*b.Text))
+			}
+			for _, f := range b.Fields {
+				lines = append(lines, slackTextObject(f))
+			}
+		case "context", "actions":
+			var items []string
+			for _, e := range b.Elements {
+				if item := slackElementText(e); item != "" {
+					items = append(items, item)
+				}
+			}
+			if len(items) == 0 {
+				continue
+			}
+			if b.Type == "context" {
+				lines = append(lines, "<i>"+strings.Join(items, " · ")+"</i>")
+			} else {
+				lines = append(lines, strings.Join(items, " | "))
+			}
+		case "image":
+			lines = append(lines, htmlLink(b.ImageURL, cmp.Or(b.AltText, "Image")))
+		}
+		if len(lines) > 0 {
+			parts = append(parts, strings.Join(lines, "\n"))
+		}
+	}
+	return parts
+}
+
+func slackElementText(e slackElement) string {
+	switch e.Type {
+	case "mrkdwn", "plain_text":
+		var text string
+		if err := json.Unmarshal(e.Text, &text); err != nil {
+			return ""
+		}
+		return slackTextObject(slackText{Type: e.Type, Text: text})
+	case "button":
+		var text slackText
+		if err := json.Unmarshal(e.Text, &text); err != nil || e.URL == "" {
+			return ""
+		}
+		return htmlLink(e.URL, text.Text)
+	default:
+		return ""
+	}
+}
+
+func slackAttachmentText(a slackAttachment) string {
+	var lines []string
+	if a.Pretext != "" {
+		lines = append(lines, slackMrkdwn(a.Pretext))
+	}
+	if a.AuthorName != "" {
+		lines = append(lines, "<i>"+events.EscapeHTML(a.AuthorName)+"</i>")
+	}
+	if a.Title != "" {
+		lines = append(lines, "<b>"+htmlLink(a.TitleLink, a.Title)+"</b>")
+	}
+	if a.Text != "" {
+		lines = append(lines, slackMrkdwn(a.Text))
+	}
+	for _, f := range a.Fields {
+		lines = append(lines, "<b>"+events.EscapeHTML(f.Title)+"</b>: "+slackMrkdwn(f.Value))
+	}
+	lines = append(lines, slackBlocks(a.Blocks)...)
+	if a.ImageURL != "" {
+		lines = append(lines, htmlLink(a.ImageURL, "Image"))
+	}
+	if a.Footer != "" {
+		lines = append(lines, "<i>"+events.EscapeHTML(a.Footer)+"</i>")
+	}
+	if len(lines) == 0 && a.Fallback != "" {
+		lines = append(lines, slackMrkdwn(a.Fallback))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func slackTextObject(t slackText) string {
+	if t.Type == "plain_text" {
+		return events.EscapeHTML(t.Text)
+	}
+	return slackMrkdwn(t.Text)
+}
+
+// slackMrkdwn converts Slack's mrkdwn to Telegram HTML. Slack escapes &, < and > in
+// message text and marks links, mentions and channels with angle brackets.
+func slackMrkdwn(text string) string {
+	return slackDialect.convert(text)
+}
+
+func slackInline(s string) string {
+	var sb strings.Builder
+	last := 0
+	for _, m := range slackLinkPattern.FindAllStringSubmatchIndex(s, -1) {
+		sb.WriteString(slackPlain(s[last:m[0]]))
+		sb.WriteString(slackReference(s[m[2]:m[3]]))
+		last = m[1]
+	}
+	sb.WriteString(slackPlain(s[last:]))
+	return sb.String()
+}
+
+func slackPlain(s string) string {
+	return applyEmphasis(events.EscapeHTML(html.UnescapeString(s)), slackEmphasis...)
+}
+
+// slackReference renders the inside of <...>: a link with an optional label, a user or
+// channel mention, or a special mention like !here.
+func slackReference(ref string) string {
+	target, label, _ := strings.Cut(ref, "|")
+	switch {
+	case strings.HasPrefix(target, "@"), strings.HasPrefix(target, "!"):
+		return events.EscapeHTML("@" + cmp.Or(strings.TrimPrefix(label, "@"), strings.TrimLeft(target, "@!")))
+	case strings.HasPrefix(target, "#"):
+		return events.EscapeHTML("#" + cmp.Or(label, strings.TrimPrefix(target, "#")))
+	case strings.HasPrefix(target, "mailto:"):
+		return events.EscapeHTML(cmp.Or(label, strings.TrimPrefix(target, "mailto:")))
+	default:
+		return htmlLink(html.UnescapeString(target), html.UnescapeString(cmp.Or(label, target)))
+	}
+}
@@ -0,0 +1,92 @@
+package http
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSlackMrkdwn(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{name: "emphasis", text: "*Deploy* _finished_ ~late~", want: "<b>Deploy</b> <i>finished</i> <s>late</s>"},
+		{name: "escaped entities", text: "a &lt;b&gt; &amp; c", want: "a &lt;b&gt; &amp; c"},
+		{name: "labelled link", text: "See <https://ci.local/1?a=1&amp;b=2|build *1*>", want: `See <a href="https://ci.local/1?a=1&amp;b=2">build *1*</a>`},
+		{name: "bare link", text: "<https://ci.local>", want: `<a href="https://ci.local">https://ci.local</a>`},
+		{name: "mentions", text: "<!here> <@U123> <#C42|ops> <!subteam^S1|@oncall>", want: "@here @U123 #ops @oncall"},
+		{name: "mailto", text: "<mailto:ops@acme.io|ops>", want: "ops"},
+		{name: "code is left alone", text: "`a &amp;&amp; *b*`", want: "<code>a &amp;&amp; *b*</code>"},
+		{name: "snake case", text: "job db_backup_nightly failed", want: "job db_backup_nightly failed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, slackMrkdwn(tt.text))
+		})
+	}
+}
+
+func TestConvertSlack(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "text",
+			body: `{"text": "Backup *done*", "username": "cron"}`,
+			want: "<b>cron</b>\n\nBackup <b>done</b>",
+		},
+		{
+			name: "blocks replace text",
+			body: `{
+				"text": "fallback",
+				"blocks": [
+					{"type": "header", "text": {"type": "plain_text", "text": "Deploy <prod>"}},
+					{"type": "section", "text": {"type": "mrkdwn", "text": "Version *1.4.2*"}, "fields": [{"type": "mrkdwn", "text": "*Env:* prod"}]},
+					{"type": "divider"},
+					{"type": "context", "elements": [{"type": "mrkdwn", "text": "by ada"}, {"type": "image", "image_url": "https://x/a.png", "alt_text": "ada"}]},
+					{"type": "actions", "elements": [{"type": "button", "text": {"type": "plain_text", "text": "Open"}, "url": "https://ci.local/42"}]}
+				]
+			}`,
+			want: "<b>Deploy &lt;prod&gt;</b>\n\nVersion <b>1.4.2</b>\n<b>Env:</b> prod\n\n<i>by ada</i>\n\n" +
+				`<a href="https://ci.local/42">Open</a>`,
+		},
+		{
+			name: "attachments",
+			body: `{
+				"text": "Alert",
+				"attachments": [{
+					"color": "danger",
+					"author_name": "monitor",
+					"title": "CPU high",
+					"title_link": "https://grafana.local/d/1",
+					"text": "load is _97%_",
+					"fields": [{"title": "Host", "value": "db-1", "short": true}],
+					"footer": "Grafana"
+				}, {"fallback": "only fallback"}]
+			}`,
+			want: "Alert\n\n<i>monitor</i>\n<b><a href=\"https://grafana.local/d/1\">CPU high</a></b>\nload is <i>97%</i>\n<b>Host</b>: db-1\n<i>Grafana</i>\n\nonly fallback",
+		},
+		{name: "empty", body: `{"username": "cron"}`, wantErr: true},
+		{name: "invalid json", body: `nope`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload, err := convertSlack(nil, []byte(tt.body))
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, payload.Text)
+			assert.Equal(t, "HTML", payload.ParseMode)
+		})
+	}
+}
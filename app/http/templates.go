@@ -0,0 +1,79 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/pkarpovich/tg-relay-bot/app/config"
+	"github.com/pkarpovich/tg-relay-bot/app/events"
+	"github.com/pkarpovich/tg-relay-bot/app/templates"
+)
+
+// compileTemplates parses the templates of the webhook sources that have one. The
+// config has already been validated, so they are known to parse.
+func compileTemplates(webhooks map[string]config.WebhookConfig) map[string]*template.Template {
+	compiled := map[string]*template.Template{}
+	for name, webhook := range webhooks {
+		if webhook.Template == "" {
+			continue
+		}
+		compiled[name] = template.Must(templates.Parse(name, webhook.Template))
+	}
+	return compiled
+}
+
+// templateWebhook renders a webhook body with the source's template. A template that
+// renders nothing drops the event, which lets it filter what it relays.
+func (s *Server) templateWebhook(
+	w http.ResponseWriter,
+	r *http.Request,
+	name string,
+	caller string,
+	tmpl *template.Template,
+	body []byte,
+	route string,
+) {
+	text, err := renderTemplate(tmpl, body)
+	if err != nil {
+		s.respondWithError(w, fmt.Errorf("webhook %q: %w", name, err), http.StatusBadRequest)
+		return
+	}
+	if text == "" {
+		log.Printf("[INFO] Webhook %q rendered an empty message, dropping it", name)
+		s.respondWithJSON(w, SendResponse{Ok: true})
+		return
+	}
+
+	log.Printf("[INFO] Received webhook notification from %q", name)
+	payload := events.MessagePayload{Text: text, ParseMode: s.config.Webhooks[name].ParseMode, Route: route}
+	id, err := s.dispatchOnce(w, r, "webhook", caller, payload, time.Time{})
+	if err != nil {
+		s.respondWithError(w, err, http.StatusInternalServerError)
+		return
+	}
+	s.respondWithJSON(w, SendResponse{Ok: true, ID: id})
+}
+
+// renderTemplate decodes any JSON body and executes the template against it. Numbers
+// keep their original form, so IDs don't turn into floats.
+func renderTemplate(tmpl *template.Template, body []byte) (string, error) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+
+	var data any
+	if err := decoder.Decode(&data); err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("render template: %w", err)
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
@@ -0,0 +1,129 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pkarpovich/tg-relay-bot/app/config"
+)
+
+func TestRenderTemplate(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		body     string
+		want     string
+		wantErr  bool
+	}{
+		{
+			name:     "fields and numbers",
+			template: `Order {{.order.id}} from {{.customer}}: {{.total}} EUR`,
+			body:     `{"order": {"id": 12345678901234567890}, "customer": "Ada", "total": 19.90}`,
+			want:     `Order 12345678901234567890 from Ada: 19.90 EUR`,
+		},
+		{
+			name:     "range over a list",
+			template: `{{range .items}}- {{.}}{{"\n"}}{{end}}`,
+			body:     `{"items": ["a", "b"]}`,
+			want:     "- a\n- b",
+		},
+		{
+			name:     "default",
+			template: `{{.name | default "unknown"}} / {{.env | default "prod"}} / {{.count | default 1}}`,
+			body:     `{"name": "", "count": 0}`,
+			want:     `unknown / prod / 0`,
+		},
+		{
+			name:     "truncate",
+			template: `{{.text | truncate 6}}|{{.short | truncate 6}}`,
+			body:     `{"text": "héllo world", "short": "hi"}`,
+			want:     `héllo…|hi`,
+		},
+		{
+			name:     "json",
+			template: `{{json .labels}}`,
+			body:     `{"labels": {"b": 2, "a": "x"}}`,
+			want:     `{"a":"x","b":2}`,
+		},
+		{
+			name:     "escaping",
+			template: `{{escapeHTML .a}} {{escapeMarkdown .b}}`,
+			body:     `{"a": "<b>", "b": "1.5*2"}`,
+			want:     `&lt;b&gt; 1\.5\*2`,
+		},
+		{
+			name:     "conditional can render nothing",
+			template: `{{if eq .status "failed"}}Build failed{{end}}`,
+			body:     `{"status": "passed"}`,
+			want:     ``,
+		},
+		{name: "invalid json", template: `{{.a}}`, body: `nope`, wantErr: true},
+		{name: "execution error", template: `{{index .a 5}}`, body: `{"a": [1]}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			templates := compileTemplates(map[string]config.WebhookConfig{"test": {Template: tt.template}})
+
+			got, err := renderTemplate(templates["test"], []byte(tt.body))
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestTemplateWebhook(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantText   string
+	}{
+		{
+			name:       "rendered",
+			body:       `{"event": "invoice.paid", "data": {"amount": 4200, "customer": "<Ada>"}}`,
+			wantStatus: http.StatusOK,
+			wantText:   "<b>invoice.paid</b>: 4200 from &lt;Ada&gt;",
+		},
+		{name: "filtered out", body: `{"event": "invoice.created"}`, wantStatus: http.StatusOK},
+		{name: "not json", body: `nope`, wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dispatcher := &mockDispatcher{}
+			srv := CreateServer(&config.Config{
+				Routes: map[string]config.RouteConfig{"billing": {ChatID: -1001}},
+				Webhooks: map[string]config.WebhookConfig{"stripe": {
+					Route:     "billing",
+					Token:     "tok3n",
+					ParseMode: "HTML",
+					Template:  `{{if eq .event "invoice.paid"}}<b>{{.event}}</b>: {{.data.amount}} from {{escapeHTML .data.customer}}{{end}}`,
+				}},
+			}, dispatcher, nil, nil, nil)
+
+			req := httptest.NewRequest(http.MethodPost, "/webhook/stripe/tok3n", strings.NewReader(tt.body))
+			rec := httptest.NewRecorder()
+			srv.server.Handler.ServeHTTP(rec, req)
+
+			require.Equal(t, tt.wantStatus, rec.Code, rec.Body.String())
+			if tt.wantText == "" {
+				assert.Empty(t, dispatcher.payloads)
+				return
+			}
+			require.Len(t, dispatcher.payloads, 1)
+			assert.Equal(t, tt.wantText, dispatcher.payloads[0].Text)
+			assert.Equal(t, "HTML", dispatcher.payloads[0].ParseMode)
+			assert.Equal(t, "billing", dispatcher.payloads[0].Route)
+		})
+	}
+}
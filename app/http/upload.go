@@ -0,0 +1,97 @@
+package http
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/pkarpovich/tg-relay-bot/app/events"
+)
+
+// defaultMaxUploadSize is Telegram's upload limit for bots, used when no
+// HTTP_MAX_UPLOAD_SIZE is configured.
+const defaultMaxUploadSize = 50 << 20
+
+// sendFileHandler is /send for multipart uploads that carry at least one file.
+func (s *Server) sendFileHandler(w http.ResponseWriter, r *http.Request) {
+	s.send(w, r, true)
+}
+
+func isMultipart(r *http.Request) bool {
+	contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return contentType == "multipart/form-data"
+}
+
+// parseSendForm reads a multipart /send request. Fields carry the same options as
+// the JSON body, with caption as an alias for message, and every file part, whatever
+// its field name, becomes an attachment in the order it was sent.
+func (s *Server) parseSendForm(w http.ResponseWriter, r *http.Request) (sendRequest, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, cmp.Or(s.config.Http.MaxUploadSize, defaultMaxUploadSize))
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return sendRequest{}, err
+	}
+
+	var data sendRequest
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return sendRequest{}, err
+		}
+
+		value, err := io.ReadAll(part)
+		if err != nil {
+			return sendRequest{}, err
+		}
+		if part.FileName() != "" {
+			data.Attachments = append(data.Attachments, uploadedAttachment(part.FileName(), part.Header.Get("Content-Type"), value))
+			continue
+		}
+
+		switch part.FormName() {
+		case "message", "caption":
+			data.Message = string(value)
+		case "parse_mode":
+			data.ParseMode = string(value)
+		case "route":
+			data.Route = string(value)
+		case "delay":
+			data.Delay = string(value)
+		case "send_at":
+			sendAt, err := time.Parse(time.RFC3339, string(value))
+			if err != nil {
+				return sendRequest{}, fmt.Errorf("invalid send_at: %w", err)
+			}
+			data.SendAt = &sendAt
+		}
+	}
+	return data, nil
+}
+
+func uploadedAttachment(filename, contentType string, data []byte) events.Attachment {
+	name := path.Base(strings.ReplaceAll(filename, `\`, "/"))
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil && mediaType != "application/octet-stream" {
+		return events.Attachment{Name: name, ContentType: mediaType, Data: data}
+	}
+	return events.Attachment{Name: name, ContentType: attachmentContentType(name, data), Data: data}
+}
+
+// attachmentContentType guesses the MIME type from the file extension, falling back
+// to sniffing the content.
+func attachmentContentType(name string, data []byte) string {
+	if contentType := mime.TypeByExtension(path.Ext(name)); contentType != "" {
+		contentType, _, _ = mime.ParseMediaType(contentType)
+		return contentType
+	}
+	contentType, _, _ := mime.ParseMediaType(http.DetectContentType(data))
+	return contentType
+}
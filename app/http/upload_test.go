@@ -0,0 +1,156 @@
+package http
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pkarpovich/tg-relay-bot/app/config"
+	"github.com/pkarpovich/tg-relay-bot/app/events"
+)
+
+type uploadFile struct {
+	field, name, contentType, data string
+}
+
+func multipartBody(t *testing.T, fields map[string]string, files []uploadFile) (*bytes.Buffer, string) {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	for k, v := range fields {
+		require.NoError(t, mw.WriteField(k, v))
+	}
+	for _, f := range files {
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Disposition", `form-data; name="`+f.field+`"; filename="`+f.name+`"`)
+		if f.contentType != "" {
+			header.Set("Content-Type", f.contentType)
+		}
+		part, err := mw.CreatePart(header)
+		require.NoError(t, err)
+		_, err = part.Write([]byte(f.data))
+		require.NoError(t, err)
+	}
+	require.NoError(t, mw.Close())
+	return &buf, mw.FormDataContentType()
+}
+
+func TestSendUpload(t *testing.T) {
+	png := "\x89PNG\r\n\x1a\n" + "chart"
+	tests := []struct {
+		name            string
+		target          string
+		fields          map[string]string
+		files           []uploadFile
+		json            bool
+		maxUploadSize   int64
+		wantStatus      int
+		wantText        string
+		wantRoute       string
+		wantAttachments []events.Attachment
+	}{
+		{
+			name:       "photo with caption",
+			target:     "/send",
+			fields:     map[string]string{"caption": "<b>CPU</b>", "parse_mode": "HTML", "route": "ci"},
+			files:      []uploadFile{{field: "file", name: "cpu.png", data: png}},
+			wantStatus: http.StatusOK,
+			wantText:   "<b>CPU</b>",
+			wantRoute:  "ci",
+			wantAttachments: []events.Attachment{
+				{Name: "cpu.png", ContentType: "image/png", Data: []byte(png)},
+			},
+		},
+		{
+			name:   "several files keep their order",
+			target: "/send/file",
+			files: []uploadFile{
+				{field: "files", name: `C:\logs\app.log`, contentType: "text/plain; charset=utf-8", data: "boom"},
+				{field: "files", name: "dump.bin", contentType: "application/octet-stream", data: "\x00\x01"},
+			},
+			wantStatus: http.StatusOK,
+			wantAttachments: []events.Attachment{
+				{Name: "app.log", ContentType: "text/plain", Data: []byte("boom")},
+				{Name: "dump.bin", ContentType: "application/octet-stream", Data: []byte("\x00\x01")},
+			},
+		},
+		{
+			name:       "text only form",
+			target:     "/send",
+			fields:     map[string]string{"message": "hello"},
+			wantStatus: http.StatusOK,
+			wantText:   "hello",
+		},
+		{
+			name:       "file endpoint without a file",
+			target:     "/send/file",
+			fields:     map[string]string{"message": "hello"},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "file endpoint with json",
+			target:     "/send/file",
+			json:       true,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "empty form",
+			target:     "/send",
+			fields:     map[string]string{"route": "ci"},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:          "file over the limit",
+			target:        "/send/file",
+			files:         []uploadFile{{field: "file", name: "big.txt", data: string(make([]byte, 2048))}},
+			maxUploadSize: 1024,
+			wantStatus:    http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:       "invalid send_at",
+			target:     "/send/file",
+			fields:     map[string]string{"send_at": "tomorrow"},
+			files:      []uploadFile{{field: "file", name: "a.txt", data: "a"}},
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dispatcher := &mockDispatcher{}
+			srv := CreateServer(&config.Config{
+				Http:   config.HttpConfig{SecretApiKey: "test-secret", MaxUploadSize: tt.maxUploadSize},
+				Routes: map[string]config.RouteConfig{"ci": {ChatID: -1001}},
+			}, dispatcher, nil, nil, nil)
+
+			var req *http.Request
+			if tt.json {
+				req = httptest.NewRequest(http.MethodPost, tt.target, bytes.NewReader([]byte(`{"message": "hi"}`)))
+				req.Header.Set("Content-Type", "application/json")
+			} else {
+				body, contentType := multipartBody(t, tt.fields, tt.files)
+				req = httptest.NewRequest(http.MethodPost, tt.target, body)
+				req.Header.Set("Content-Type", contentType)
+			}
+			req.Header.Set("X-Secret", "test-secret")
+			rec := httptest.NewRecorder()
+			srv.server.Handler.ServeHTTP(rec, req)
+
+			require.Equal(t, tt.wantStatus, rec.Code, rec.Body.String())
+			if tt.wantStatus != http.StatusOK {
+				assert.Empty(t, dispatcher.payloads)
+				return
+			}
+			require.Len(t, dispatcher.payloads, 1)
+			payload := dispatcher.payloads[0]
+			assert.Equal(t, tt.wantText, payload.Text)
+			assert.Equal(t, tt.wantRoute, payload.Route)
+			assert.Equal(t, tt.wantAttachments, payload.Attachments)
+		})
+	}
+}
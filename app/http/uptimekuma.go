@@ -0,0 +1,77 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	tbapi "github.com/OvyFlash/telegram-bot-api"
+	"github.com/pkarpovich/tg-relay-bot/app/events"
+)
+
+// uptimeKumaStatuses names Uptime Kuma's heartbeat statuses.
+var uptimeKumaStatuses = map[int]string{0: "DOWN", 1: "UP", 2: "PENDING", 3: "MAINTENANCE"}
+
+// uptimeKumaPayload is the body of an Uptime Kuma webhook notification. Test
+// notifications only carry msg.
+type uptimeKumaPayload struct {
+	Msg       string `json:"msg"`
+	Heartbeat *struct {
+		Status int      `json:"status"`
+		Msg    string   `json:"msg"`
+		Ping   *float64 `json:"ping"`
+		Time   string   `json:"time"`
+	} `json:"heartbeat"`
+	Monitor *struct {
+		Name     string `json:"name"`
+		URL      string `json:"url"`
+		Hostname string `json:"hostname"`
+	} `json:"monitor"`
+}
+
+// convertUptimeKuma renders a monitor going up or down. Only monitors going down
+// notify; everything else is sent silently.
+func convertUptimeKuma(_ *http.Request, body []byte) (events.MessagePayload, error) {
+	var p uptimeKumaPayload
+	if err := json.Unmarshal(body, &p); err != nil {
+		return events.MessagePayload{}, err
+	}
+	if p.Heartbeat == nil || p.Monitor == nil {
+		if p.Msg == "" {
+			return events.MessagePayload{}, errors.New("not an uptime kuma notification")
+		}
+		return events.MessagePayload{Text: events.EscapeHTML(p.Msg), ParseMode: tbapi.ModeHTML, Silent: true}, nil
+	}
+
+	hb := p.Heartbeat
+	status, ok := uptimeKumaStatuses[hb.Status]
+	if !ok {
+		status = fmt.Sprintf("STATUS %d", hb.Status)
+	}
+
+	var sb strings.Builder
+	sb.WriteString("<b>" + events.EscapeHTML("["+status+"] "+p.Monitor.Name) + "</b>\n")
+	if hb.Msg != "" {
+		sb.WriteString(events.EscapeHTML(hb.Msg) + "\n")
+	}
+	if hb.Ping != nil && hb.Status == 1 {
+		sb.WriteString(fmt.Sprintf("Response time: %g ms\n", *hb.Ping))
+	}
+	if hb.Time != "" {
+		sb.WriteString("<i>" + events.EscapeHTML(hb.Time) + "</i>\n")
+	}
+	switch {
+	case p.Monitor.URL != "" && p.Monitor.URL != "https://":
+		sb.WriteString(htmlLink(p.Monitor.URL, p.Monitor.URL) + "\n")
+	case p.Monitor.Hostname != "":
+		sb.WriteString("<code>" + events.EscapeHTML(p.Monitor.Hostname) + "</code>\n")
+	}
+
+	return events.MessagePayload{
+		Text:      strings.TrimSpace(sb.String()),
+		ParseMode: tbapi.ModeHTML,
+		Silent:    hb.Status != 0,
+	}, nil
+}
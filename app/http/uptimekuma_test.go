@@ -0,0 +1,89 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pkarpovich/tg-relay-bot/app/config"
+)
+
+func TestConvertUptimeKuma(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		want       string
+		wantSilent bool
+		wantErr    bool
+	}{
+		{
+			name: "monitor down",
+			body: `{
+				"heartbeat": {"status": 0, "msg": "connect ECONNREFUSED 10.0.0.5:443", "ping": null, "time": "2026-10-17 08:00:00"},
+				"monitor": {"name": "API", "url": "https://api.example.com/health"},
+				"msg": "[API] [🔴 Down] connect ECONNREFUSED 10.0.0.5:443"
+			}`,
+			want: `<b>[DOWN] API</b>
+connect ECONNREFUSED 10.0.0.5:443
+<i>2026-10-17 08:00:00</i>
+<a href="https://api.example.com/health">https://api.example.com/health</a>`,
+		},
+		{
+			name: "monitor up",
+			body: `{
+				"heartbeat": {"status": 1, "msg": "200 - OK", "ping": 87, "time": "2026-10-17 08:05:00"},
+				"monitor": {"name": "DB", "url": "https://", "hostname": "db.internal"}
+			}`,
+			want: `<b>[UP] DB</b>
+200 - OK
+Response time: 87 ms
+<i>2026-10-17 08:05:00</i>
+<code>db.internal</code>`,
+			wantSilent: true,
+		},
+		{
+			name:       "test notification",
+			body:       `{"heartbeat": null, "monitor": null, "msg": "Uptime Kuma <test>"}`,
+			want:       `Uptime Kuma &lt;test&gt;`,
+			wantSilent: true,
+		},
+		{name: "empty", body: `{}`, wantErr: true},
+		{name: "invalid json", body: `nope`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload, err := convertUptimeKuma(nil, []byte(tt.body))
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, payload.Text)
+			assert.Equal(t, "HTML", payload.ParseMode)
+			assert.Equal(t, tt.wantSilent, payload.Silent)
+		})
+	}
+}
+
+func TestUptimeKumaReceiver(t *testing.T) {
+	dispatcher := &mockDispatcher{}
+	srv := CreateServer(&config.Config{
+		Routes:   map[string]config.RouteConfig{"ops": {ChatID: -1001}},
+		Webhooks: map[string]config.WebhookConfig{"uptime-kuma": {Route: "ops", Token: "tok3n"}},
+	}, dispatcher, nil, nil, nil)
+
+	body := `{"heartbeat": {"status": 0, "msg": "timeout"}, "monitor": {"name": "API"}}`
+	req := httptest.NewRequest(http.MethodPost, "/webhook/uptime-kuma/tok3n", strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	srv.server.Handler.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	require.Len(t, dispatcher.payloads, 1)
+	assert.Equal(t, "ops", dispatcher.payloads[0].Route)
+	assert.Contains(t, dispatcher.payloads[0].Text, "[DOWN] API")
+}
@@ -0,0 +1,97 @@
+package http
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/pkarpovich/tg-relay-bot/app/config"
+	"github.com/pkarpovich/tg-relay-bot/app/events"
+)
+
+const (
+	maxWebhookBody         = 1 << 20
+	defaultSignatureHeader = "X-Hub-Signature-256"
+)
+
+var (
+	errInvalidToken     = errors.New("invalid webhook token")
+	errInvalidSignature = errors.New("invalid webhook signature")
+)
+
+// authorizeWebhook resolves the name in a /webhook path and checks the request
+// against it, writing the error response on failure. Configured webhook sources are
+// checked with their token and HMAC signature; plain routes and /webhook itself need
+// an API key. It returns the route and the caller the request came from.
+func (s *Server) authorizeWebhook(w http.ResponseWriter, r *http.Request, name string, body []byte) (string, string, bool) {
+	source, ok := s.config.Webhooks[name]
+	if !ok {
+		if !s.hasRoute(name) {
+			s.respondWithError(w, fmt.Errorf("%w %q", events.ErrUnknownRoute, name), http.StatusNotFound)
+			return "", "", false
+		}
+		key, ok := s.authorize(w, r, endpointWebhook)
+		if !ok {
+			return "", "", false
+		}
+		if !key.allowsRoute(name) {
+			s.respondWithError(w, errRouteDenied, http.StatusForbidden)
+			return "", "", false
+		}
+		return name, keyCaller(key), true
+	}
+
+	if !s.authorizeSource(w, r, source, body) {
+		return "", "", false
+	}
+	return source.Route, sourceCaller(name), true
+}
+
+// authorizeSource checks the token and signature configured for a webhook source.
+func (s *Server) authorizeSource(w http.ResponseWriter, r *http.Request, source config.WebhookConfig, body []byte) bool {
+	if source.Token != "" && !validToken(r, source) {
+		s.respondWithError(w, errInvalidToken, http.StatusUnauthorized)
+		return false
+	}
+	if source.HMACSecret != "" && !validSignature(r, source, body) {
+		s.respondWithError(w, errInvalidSignature, http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+// validToken accepts the token as the last path segment, the token query parameter or
+// the source's token header.
+func validToken(r *http.Request, source config.WebhookConfig) bool {
+	token := r.PathValue("token")
+	if token == "" {
+		token = r.URL.Query().Get("token")
+	}
+	if token == "" && source.TokenHeader != "" {
+		token = r.Header.Get(source.TokenHeader)
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(source.Token)) == 1
+}
+
+// validSignature checks a hex HMAC-SHA256 of the body, optionally prefixed with
+// "sha256=" as GitHub does.
+func validSignature(r *http.Request, source config.WebhookConfig, body []byte) bool {
+	header := source.HMACHeader
+	if header == "" {
+		header = defaultSignatureHeader
+	}
+
+	signature, err := hex.DecodeString(strings.TrimPrefix(r.Header.Get(header), "sha256="))
+	if err != nil || len(signature) == 0 {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(source.HMACSecret))
+	mac.Write(body)
+	return hmac.Equal(signature, mac.Sum(nil))
+}
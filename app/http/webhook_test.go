@@ -0,0 +1,172 @@
+package http
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pkarpovich/tg-relay-bot/app/config"
+)
+
+func sign(secret, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestWebhookHandlerAuth(t *testing.T) {
+	const body = `{"content": "deployed"}`
+
+	tests := []struct {
+		name       string
+		target     string
+		secret     string
+		headers    map[string]string
+		wantStatus int
+		wantRoute  string
+	}{
+		{
+			name:       "shared secret on the default webhook",
+			target:     "/webhook",
+			secret:     "test-secret",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "missing shared secret",
+			target:     "/webhook",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "route needs the shared secret",
+			target:     "/webhook/ci",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "token in path",
+			target:     "/webhook/uptime/tok3n",
+			wantStatus: http.StatusOK,
+			wantRoute:  "ci",
+		},
+		{
+			name:       "token in query",
+			target:     "/webhook/uptime?token=tok3n",
+			wantStatus: http.StatusOK,
+			wantRoute:  "ci",
+		},
+		{
+			name:       "wrong token",
+			target:     "/webhook/uptime/nope",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "shared secret doesn't replace the source token",
+			target:     "/webhook/uptime",
+			secret:     "test-secret",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "valid signature",
+			target:     "/webhook/github",
+			headers:    map[string]string{"X-Hub-Signature-256": sign("hmac-key", body)},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "signature of another body",
+			target:     "/webhook/github",
+			headers:    map[string]string{"X-Hub-Signature-256": sign("hmac-key", "{}")},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "custom signature header",
+			target:     "/webhook/gitea/tok3n",
+			headers:    map[string]string{"X-Gitea-Signature": strings.TrimPrefix(sign("hmac-key", body), "sha256=")},
+			wantStatus: http.StatusOK,
+			wantRoute:  "ci",
+		},
+		{
+			name:       "token and signature both required",
+			target:     "/webhook/gitea",
+			headers:    map[string]string{"X-Gitea-Signature": strings.TrimPrefix(sign("hmac-key", body), "sha256=")},
+			wantStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dispatcher := &mockDispatcher{}
+			srv := CreateServer(&config.Config{
+				Http:   config.HttpConfig{SecretApiKey: "test-secret"},
+				Routes: map[string]config.RouteConfig{"ci": {ChatID: -100123}},
+				Webhooks: map[string]config.WebhookConfig{
+					"uptime": {Route: "ci", Token: "tok3n"},
+					"github": {HMACSecret: "hmac-key"},
+					"gitea":  {Route: "ci", Token: "tok3n", HMACSecret: "hmac-key", HMACHeader: "X-Gitea-Signature"},
+				},
+			}, dispatcher, nil, nil, nil)
+
+			req := httptest.NewRequest(http.MethodPost, tt.target, strings.NewReader(body))
+			if tt.secret != "" {
+				req.Header.Set("X-Secret", tt.secret)
+			}
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+
+			srv.server.Handler.ServeHTTP(rec, req)
+
+			require.Equal(t, tt.wantStatus, rec.Code, rec.Body.String())
+			if tt.wantStatus != http.StatusOK {
+				assert.Empty(t, dispatcher.payloads)
+				return
+			}
+			require.Len(t, dispatcher.payloads, 1)
+			assert.Equal(t, tt.wantRoute, dispatcher.payloads[0].Route)
+		})
+	}
+}
+
+func TestReceiverNamesKeepGenericWebhooks(t *testing.T) {
+	tests := []struct {
+		name      string
+		target    string
+		body      string
+		wantText  string
+		wantRoute string
+	}{
+		{name: "route named like a receiver", target: "/webhook/grafana", body: `{"content": "deployed"}`, wantText: "deployed", wantRoute: "grafana"},
+		{name: "template source named like a receiver", target: "/webhook/sentry/tok3n", body: `{"event": "deploy"}`, wantText: "sentry: deploy", wantRoute: "ops"},
+		{name: "receiver payloads still converted", target: "/webhook/uptime-kuma", body: `{"heartbeat": {"status": 1, "msg": "OK"}, "monitor": {"name": "api"}}`, wantText: "api"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dispatcher := &mockDispatcher{}
+			srv := CreateServer(&config.Config{
+				Http:   config.HttpConfig{SecretApiKey: "test-secret"},
+				Routes: map[string]config.RouteConfig{"grafana": {ChatID: -100123}, "ops": {ChatID: -100456}},
+				Webhooks: map[string]config.WebhookConfig{
+					"sentry": {Route: "ops", Token: "tok3n", Template: "sentry: {{ .event }}"},
+				},
+			}, dispatcher, nil, nil, nil)
+
+			req := httptest.NewRequest(http.MethodPost, tt.target, strings.NewReader(tt.body))
+			req.Header.Set("X-Secret", "test-secret")
+			rec := httptest.NewRecorder()
+
+			srv.server.Handler.ServeHTTP(rec, req)
+
+			require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+			require.Len(t, dispatcher.payloads, 1)
+			assert.Contains(t, dispatcher.payloads[0].Text, tt.wantText)
+			assert.Equal(t, tt.wantRoute, dispatcher.payloads[0].Route)
+		})
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"os"
 	"os/signal"
@@ -15,6 +16,7 @@ import (
 	"github.com/pkarpovich/tg-relay-bot/app/events"
 	"github.com/pkarpovich/tg-relay-bot/app/http"
 	"github.com/pkarpovich/tg-relay-bot/app/smtp_server"
+	bolt "go.etcd.io/bbolt"
 )
 
 func main() {
@@ -36,15 +38,52 @@ func run(cfg *config.Config) error {
 
 	var wg sync.WaitGroup
 
-	messagesForSend := make(chan events.MessagePayload, 100)
-	defer close(messagesForSend)
+	db, err := bolt.Open(cfg.Store.Path, 0o600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return fmt.Errorf("open store %s: %w", cfg.Store.Path, err)
+	}
+	defer db.Close()
+
+	queue, err := events.NewQueue(db)
+	if err != nil {
+		return fmt.Errorf("init message queue: %w", err)
+	}
+	deadLetters, err := events.NewDeadLetters(db, queue)
+	if err != nil {
+		return fmt.Errorf("init dead letters: %w", err)
+	}
+	deliveries, err := events.NewDeliveries(db)
+	if err != nil {
+		return fmt.Errorf("init deliveries: %w", err)
+	}
+	routes := make(map[string]events.Route, len(cfg.Routes))
+	for name, route := range cfg.Routes {
+		routes[name] = events.Route{ChatID: route.ChatID, ThreadID: route.ThreadID, Silent: route.Silent}
+	}
+	dispatcher := events.NewDispatcher(queue, deliveries, cfg.Telegram.SuperUsers, routes, cfg.Telegram.DocumentFallbackChunks)
+	scheduler, err := events.NewScheduler(db, dispatcher)
+	if err != nil {
+		return fmt.Errorf("init scheduler: %w", err)
+	}
 
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 
-	httpServer := startHttpServer(ctx, &wg, cfg, messagesForSend)
-	smtpServer := startMailServer(ctx, &wg, cfg, messagesForSend)
-	tgListener := startTelegramListener(ctx, &wg, cfg, messagesForSend)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		deliveries.Run(ctx, cfg.Store.DeliveryTTL)
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		scheduler.Run(ctx)
+	}()
+
+	httpServer := startHttpServer(ctx, &wg, cfg, dispatcher, deadLetters, deliveries, scheduler)
+	smtpServer := startMailServer(ctx, &wg, cfg, dispatcher)
+	tgListener := startTelegramListener(ctx, &wg, cfg, queue, deadLetters, deliveries, scheduler)
 
 	sig := <-sigChan
 	log.Printf("[INFO] Received shutdown signal: %v", sig)
@@ -71,9 +110,9 @@ func run(cfg *config.Config) error {
 	return nil
 }
 
-func startHttpServer(ctx context.Context, wg *sync.WaitGroup, cfg *config.Config, messagesForSend chan events.MessagePayload) *http.Server {
+func startHttpServer(ctx context.Context, wg *sync.WaitGroup, cfg *config.Config, dispatcher *events.Dispatcher, deadLetters *events.DeadLetters, deliveries *events.Deliveries, scheduler *events.Scheduler) *http.Server {
 	wg.Add(1)
-	httpServer := http.CreateServer(cfg, messagesForSend)
+	httpServer := http.CreateServer(cfg, dispatcher, deadLetters, deliveries, scheduler)
 	go func() {
 		defer wg.Done()
 		if err := httpServer.Start(ctx); err != nil {
@@ -83,9 +122,12 @@ func startHttpServer(ctx context.Context, wg *sync.WaitGroup, cfg *config.Config
 	return httpServer
 }
 
-func startMailServer(ctx context.Context, wg *sync.WaitGroup, cfg *config.Config, messagesForSend chan events.MessagePayload) *smtp_server.Server {
+func startMailServer(ctx context.Context, wg *sync.WaitGroup, cfg *config.Config, dispatcher *events.Dispatcher) *smtp_server.Server {
 	wg.Add(1)
-	mailServer := smtp_server.NewServer(cfg, messagesForSend)
+	mailServer, err := smtp_server.NewServer(cfg, dispatcher)
+	if err != nil {
+		log.Fatalf("[ERROR] Failed to create SMTP server: %s", err)
+	}
 	go func() {
 		defer wg.Done()
 		if err := mailServer.Start(ctx); err != nil {
@@ -95,7 +137,7 @@ func startMailServer(ctx context.Context, wg *sync.WaitGroup, cfg *config.Config
 	return mailServer
 }
 
-func startTelegramListener(ctx context.Context, wg *sync.WaitGroup, cfg *config.Config, messagesForSend chan events.MessagePayload) *events.TelegramListener {
+func startTelegramListener(ctx context.Context, wg *sync.WaitGroup, cfg *config.Config, queue *events.Queue, deadLetters *events.DeadLetters, deliveries *events.Deliveries, scheduler *events.Scheduler) *events.TelegramListener {
 	wg.Add(1)
 	botClient := bot.NewClient()
 
@@ -105,10 +147,23 @@ func startTelegramListener(ctx context.Context, wg *sync.WaitGroup, cfg *config.
 	}
 
 	tgListener := &events.TelegramListener{
-		SuperUsers:      cfg.Telegram.SuperUsers,
-		TbAPI:           tbAPI,
-		Bot:             botClient,
-		MessagesForSend: messagesForSend,
+		SuperUsers:  cfg.Telegram.SuperUsers,
+		TbAPI:       tbAPI,
+		Bot:         botClient,
+		Queue:       queue,
+		DeadLetters: deadLetters,
+		Deliveries:  deliveries,
+		Scheduler:   scheduler,
+		Retry: events.RetryPolicy{
+			MaxAttempts: cfg.Telegram.Retry.MaxAttempts,
+			BaseDelay:   cfg.Telegram.Retry.BaseDelay,
+			MaxDelay:    cfg.Telegram.Retry.MaxDelay,
+		},
+		Limiter: events.NewRateLimiter(
+			cfg.Telegram.RateLimit.Global,
+			cfg.Telegram.RateLimit.PerChat,
+			cfg.Telegram.RateLimit.PerGroup,
+		),
 	}
 
 	go func() {
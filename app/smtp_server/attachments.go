@@ -0,0 +1,81 @@
+package smtp_server
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/jhillyerd/enmime"
+	"github.com/pkarpovich/tg-relay-bot/app/config"
+	"github.com/pkarpovich/tg-relay-bot/app/events"
+)
+
+type attachmentFilter struct {
+	maxSize int
+	allow   []string
+	deny    []string
+}
+
+func newAttachmentFilter(cfg config.AttachmentConfig) attachmentFilter {
+	return attachmentFilter{
+		maxSize: cfg.MaxSize,
+		allow:   normalizeTypes(cfg.Allow),
+		deny:    normalizeTypes(cfg.Deny),
+	}
+}
+
+// filter keeps the parts that pass the size limit and MIME type lists and describes
+// why each of the others was dropped.
+func (f attachmentFilter) filter(parts []*enmime.Part) (attachments []events.Attachment, skipped []string) {
+	for i, part := range parts {
+		name := part.FileName
+		if name == "" {
+			name = fmt.Sprintf("attachment-%d", i+1)
+		}
+		contentType := strings.ToLower(part.ContentType)
+
+		if err := f.check(contentType, len(part.Content)); err != nil {
+			skipped = append(skipped, fmt.Sprintf("%s: %s", name, err))
+			continue
+		}
+
+		attachments = append(attachments, events.Attachment{
+			Name:        name,
+			ContentType: contentType,
+			Data:        part.Content,
+		})
+	}
+	return attachments, skipped
+}
+
+func (f attachmentFilter) check(contentType string, size int) error {
+	if matchesType(f.deny, contentType) {
+		return fmt.Errorf("type %s is denied", contentType)
+	}
+	if len(f.allow) > 0 && !matchesType(f.allow, contentType) {
+		return fmt.Errorf("type %s is not allowed", contentType)
+	}
+	if f.maxSize > 0 && size > f.maxSize {
+		return fmt.Errorf("%d bytes exceeds the %d bytes limit", size, f.maxSize)
+	}
+	return nil
+}
+
+func matchesType(patterns []string, contentType string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, contentType); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func normalizeTypes(types []string) []string {
+	normalized := make([]string, 0, len(types))
+	for _, t := range types {
+		if t = strings.ToLower(strings.TrimSpace(t)); t != "" {
+			normalized = append(normalized, t)
+		}
+	}
+	return normalized
+}
@@ -0,0 +1,70 @@
+package smtp_server
+
+import (
+	"testing"
+
+	"github.com/jhillyerd/enmime"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/pkarpovich/tg-relay-bot/app/config"
+)
+
+func TestAttachmentFilter(t *testing.T) {
+	parts := []*enmime.Part{
+		{FileName: "report.pdf", ContentType: "application/pdf", Content: []byte("pdf")},
+		{FileName: "screen.png", ContentType: "image/PNG", Content: []byte("png")},
+		{FileName: "setup.exe", ContentType: "application/x-msdownload", Content: []byte("exe")},
+		{FileName: "dump.csv", ContentType: "text/csv", Content: []byte("0123456789")},
+		{ContentType: "image/jpeg", Content: []byte("jpg")},
+	}
+
+	tests := []struct {
+		name        string
+		cfg         config.AttachmentConfig
+		wantNames   []string
+		wantSkipped int
+	}{
+		{
+			name:      "everything allowed",
+			cfg:       config.AttachmentConfig{},
+			wantNames: []string{"report.pdf", "screen.png", "setup.exe", "dump.csv", "attachment-5"},
+		},
+		{
+			name:        "deny list",
+			cfg:         config.AttachmentConfig{Deny: []string{"application/x-msdownload"}},
+			wantNames:   []string{"report.pdf", "screen.png", "dump.csv", "attachment-5"},
+			wantSkipped: 1,
+		},
+		{
+			name:        "allow list with wildcard",
+			cfg:         config.AttachmentConfig{Allow: []string{" image/* ", "application/pdf"}},
+			wantNames:   []string{"report.pdf", "screen.png", "attachment-5"},
+			wantSkipped: 2,
+		},
+		{
+			name:        "deny wins over allow",
+			cfg:         config.AttachmentConfig{Allow: []string{"image/*"}, Deny: []string{"image/png"}},
+			wantNames:   []string{"attachment-5"},
+			wantSkipped: 4,
+		},
+		{
+			name:        "size limit",
+			cfg:         config.AttachmentConfig{MaxSize: 5},
+			wantNames:   []string{"report.pdf", "screen.png", "setup.exe", "attachment-5"},
+			wantSkipped: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attachments, skipped := newAttachmentFilter(tt.cfg).filter(parts)
+
+			var names []string
+			for _, a := range attachments {
+				names = append(names, a.Name)
+			}
+			assert.Equal(t, tt.wantNames, names)
+			assert.Len(t, skipped, tt.wantSkipped)
+		})
+	}
+}
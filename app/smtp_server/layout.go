@@ -0,0 +1,27 @@
+package smtp_server
+
+import (
+	"fmt"
+
+	tbapi "github.com/OvyFlash/telegram-bot-api"
+)
+
+const layoutFormat = "{{if .Subject}}%s{{.Subject}}%s\n{{end}}" +
+	"{{if .From}}From: {{.From}}\n{{end}}" +
+	"{{if .To}}To: {{.To}}\n{{end}}" +
+	"{{if .Date}}Date: {{.Date}}\n{{end}}" +
+	"\n{{.Text}}"
+
+const dateLayout = "2006-01-02 15:04:05 -0700"
+
+// defaultLayout shows the subject in bold, then sender, recipients and date, then the body.
+func defaultLayout(parseMode string) string {
+	switch parseMode {
+	case tbapi.ModeHTML:
+		return fmt.Sprintf(layoutFormat, "<b>", "</b>")
+	case tbapi.ModeMarkdownV2:
+		return fmt.Sprintf(layoutFormat, "*", "*")
+	default:
+		return fmt.Sprintf(layoutFormat, "", "")
+	}
+}
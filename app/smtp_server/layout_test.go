@@ -0,0 +1,88 @@
+package smtp_server
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pkarpovich/tg-relay-bot/app/config"
+)
+
+const testEmail = "From: Backup Bot <backup@relay.local>\r\n" +
+	"To: ops@relay.local\r\n" +
+	"Subject: =?UTF-8?Q?Nightly_backup_<ok>?=\r\n" +
+	"Date: Fri, 16 Oct 2026 03:00:00 +0200\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/alternative; boundary=b\r\n" +
+	"\r\n" +
+	"--b\r\n" +
+	"Content-Type: text/plain; charset=utf-8\r\n" +
+	"\r\n" +
+	"Backup *done* in 5m.\r\n" +
+	"--b\r\n" +
+	"Content-Type: text/html; charset=utf-8\r\n" +
+	"\r\n" +
+	"<p>Backup <b>done</b> in 5m.</p>\r\n" +
+	"--b--\r\n"
+
+func TestEmailLayout(t *testing.T) {
+	tests := []struct {
+		name      string
+		parseMode string
+		layout    string
+		want      string
+	}{
+		{
+			name:      "html",
+			parseMode: "HTML",
+			want: "<b>Nightly backup &lt;ok&gt;</b>\n" +
+				"From: Backup Bot &lt;backup@relay.local&gt;\n" +
+				"To: ops@relay.local\n" +
+				"Date: 2026-10-16 03:00:00 +0200\n\n" +
+				"Backup <b>done</b> in 5m.",
+		},
+		{
+			name:      "markdown",
+			parseMode: "MarkdownV2",
+			want: "*Nightly backup <ok\\>*\n" +
+				"From: Backup Bot <backup@relay\\.local\\>\n" +
+				"To: ops@relay\\.local\n" +
+				"Date: 2026\\-10\\-16 03:00:00 \\+0200\n\n" +
+				"Backup \\*done\\* in 5m\\.",
+		},
+		{
+			name:      "plain",
+			parseMode: "",
+			want: "Nightly backup <ok>\n" +
+				"From: Backup Bot <backup@relay.local>\n" +
+				"To: ops@relay.local\n" +
+				"Date: 2026-10-16 03:00:00 +0200\n\n" +
+				"Backup *done* in 5m.",
+		},
+		{
+			name:      "custom layout",
+			parseMode: "HTML",
+			layout:    "{{.Subject}} ({{.Recipient}}): {{.Text}}",
+			want:      "Nightly backup &lt;ok&gt; (ops@relay.local): Backup <b>done</b> in 5m.",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, err := NewServer(&config.Config{Smtp: config.SmtpConfig{ParseMode: tt.parseMode, Layout: tt.layout}}, nil)
+			require.NoError(t, err)
+
+			e := envelope{from: "backup@relay.local", recipients: []string{"ops@relay.local"}}
+			email, err := srv.processEnvelope(e, strings.NewReader(testEmail))
+			require.NoError(t, err)
+
+			targets := srv.resolveTargets(e, email)
+			require.Len(t, targets, 1)
+			text, err := targets[0].render()
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, text)
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package smtp_server
+
+import (
+	"sync"
+	"time"
+)
+
+const pruneThreshold = 1024
+
+// clientLimiter counts events per client IP in fixed windows. A nil limiter allows
+// everything.
+type clientLimiter struct {
+	mu      sync.Mutex
+	limit   int
+	window  time.Duration
+	clients map[string]*clientWindow
+	now     func() time.Time
+}
+
+type clientWindow struct {
+	start time.Time
+	count int
+}
+
+func newClientLimiter(limit int, window time.Duration) *clientLimiter {
+	if limit <= 0 {
+		return nil
+	}
+	return &clientLimiter{
+		limit:   limit,
+		window:  window,
+		clients: make(map[string]*clientWindow),
+		now:     time.Now,
+	}
+}
+
+func (l *clientLimiter) allow(ip string) bool {
+	if l == nil {
+		return true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if len(l.clients) >= pruneThreshold {
+		l.prune(now)
+	}
+
+	w, ok := l.clients[ip]
+	if !ok || now.Sub(w.start) >= l.window {
+		w = &clientWindow{start: now}
+		l.clients[ip] = w
+	}
+	if w.count >= l.limit {
+		return false
+	}
+	w.count++
+	return true
+}
+
+func (l *clientLimiter) prune(now time.Time) {
+	for ip, w := range l.clients {
+		if now.Sub(w.start) >= l.window {
+			delete(l.clients, ip)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package smtp_server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/emersion/go-smtp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pkarpovich/tg-relay-bot/app/config"
+)
+
+func TestClientLimiter(t *testing.T) {
+	now := time.Now()
+	l := newClientLimiter(2, time.Minute)
+	l.now = func() time.Time { return now }
+
+	assert.True(t, l.allow("10.0.0.1"))
+	assert.True(t, l.allow("10.0.0.1"))
+	assert.False(t, l.allow("10.0.0.1"))
+	assert.True(t, l.allow("10.0.0.2"))
+
+	now = now.Add(time.Minute)
+	assert.True(t, l.allow("10.0.0.1"))
+
+	var disabled *clientLimiter = newClientLimiter(0, time.Minute)
+	assert.True(t, disabled.allow("10.0.0.1"))
+}
+
+func TestSessionRateLimits(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      config.SmtpRateLimitConfig
+		wantCode int
+	}{
+		{name: "connections", cfg: config.SmtpRateLimitConfig{Connections: 2}, wantCode: 421},
+		{name: "messages", cfg: config.SmtpRateLimitConfig{Messages: 2}, wantCode: 450},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr, dispatcher := startTestServer(t, config.SmtpConfig{RateLimit: tt.cfg})
+
+			require.NoError(t, sendTestMail(addr, nil, "ops@relay.local"))
+			require.NoError(t, sendTestMail(addr, nil, "ops@relay.local"))
+
+			err := sendTestMail(addr, nil, "ops@relay.local")
+			var smtpErr *smtp.SMTPError
+			require.ErrorAs(t, err, &smtpErr)
+			assert.Equal(t, tt.wantCode, smtpErr.Code)
+			assert.Len(t, dispatcher.routes(), 2)
+		})
+	}
+}
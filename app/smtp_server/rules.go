@@ -0,0 +1,144 @@
+package smtp_server
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"strings"
+	"text/template"
+
+	"github.com/pkarpovich/tg-relay-bot/app/config"
+	"github.com/pkarpovich/tg-relay-bot/app/events"
+)
+
+type EmailData struct {
+	From      string
+	To        string
+	Date      string
+	Subject   string
+	Recipient string
+	Tag       string
+	Text      string
+}
+
+type recipientRule struct {
+	match    string
+	route    string
+	template *template.Template
+}
+
+type recipientTarget struct {
+	route    string
+	template *template.Template
+	data     EmailData
+}
+
+func compileRules(rules []config.EmailRuleConfig, layout *template.Template) ([]recipientRule, error) {
+	compiled := make([]recipientRule, 0, len(rules))
+	for i, rule := range rules {
+		tmpl := layout
+		if rule.Template != "" {
+			var err error
+			if tmpl, err = template.New(rule.Match).Parse(rule.Template); err != nil {
+				return nil, fmt.Errorf("parse template of smtp rule %d: %w", i+1, err)
+			}
+		}
+		compiled = append(compiled, recipientRule{
+			match:    strings.ToLower(rule.Match),
+			route:    rule.Route,
+			template: tmpl,
+		})
+	}
+	return compiled, nil
+}
+
+// resolveTargets sends mail from a sender authenticated with a routed credential to
+// that route only; other mail is routed by its recipients.
+func (s *Server) resolveTargets(e envelope, email *FormattedEmail) []recipientTarget {
+	if e.route == "" {
+		return s.resolveRecipients(e.recipients, email)
+	}
+	return []recipientTarget{{
+		route:    e.route,
+		template: s.layout,
+		data:     newEmailData(strings.Join(e.recipients, ", "), "", email),
+	}}
+}
+
+// resolveRecipients picks a route and template for every recipient. Rules are tried in
+// order against the full address and then against the address without its +tag.
+// Recipients that match no rule fall back to the route named by their local part, and
+// to the super users after that. Recipients resolving to the same route are merged.
+func (s *Server) resolveRecipients(recipients []string, email *FormattedEmail) []recipientTarget {
+	var targets []recipientTarget
+	seen := make(map[string]bool)
+
+	for _, rcpt := range recipients {
+		address := strings.ToLower(rcpt)
+		local, host := address, ""
+		if at := strings.LastIndex(address, "@"); at >= 0 {
+			local, host = address[:at], address[at+1:]
+		}
+		user, tag, _ := strings.Cut(local, "+")
+
+		target := recipientTarget{
+			template: s.layout,
+			data:     newEmailData(address, tag, email),
+		}
+		if rule, ok := s.matchRule(address, user+"@"+host); ok {
+			target.route = rule.route
+			target.template = rule.template
+		} else if _, ok := s.routes[user]; ok {
+			target.route = user
+		}
+
+		if seen[target.route] {
+			continue
+		}
+		seen[target.route] = true
+		targets = append(targets, target)
+	}
+
+	if len(targets) == 0 {
+		targets = append(targets, recipientTarget{
+			template: s.layout,
+			data:     newEmailData("", "", email),
+		})
+	}
+	return targets
+}
+
+// newEmailData fills the template fields. Header values are escaped for the parse
+// mode of the body, so that the rendered message stays valid markup.
+func newEmailData(recipient, tag string, email *FormattedEmail) EmailData {
+	escape := func(s string) string { return events.Escape(s, email.ParseMode) }
+
+	return EmailData{
+		From:      escape(email.From),
+		To:        escape(email.To),
+		Date:      escape(email.Date),
+		Subject:   escape(email.Subject),
+		Recipient: escape(recipient),
+		Tag:       escape(tag),
+		Text:      email.Text,
+	}
+}
+
+func (s *Server) matchRule(addresses ...string) (recipientRule, bool) {
+	for _, rule := range s.rules {
+		for _, address := range addresses {
+			if ok, _ := path.Match(rule.match, address); ok {
+				return rule, true
+			}
+		}
+	}
+	return recipientRule{}, false
+}
+
+func (t recipientTarget) render() (string, error) {
+	var buf bytes.Buffer
+	if err := t.template.Execute(&buf, t.data); err != nil {
+		return "", fmt.Errorf("render email template: %w", err)
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
@@ -0,0 +1,113 @@
+package smtp_server
+
+import (
+	"testing"
+	"text/template"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pkarpovich/tg-relay-bot/app/config"
+)
+
+func TestResolveRecipients(t *testing.T) {
+	layout := template.Must(template.New("layout").Parse("{{.Text}}"))
+	rules, err := compileRules([]config.EmailRuleConfig{
+		{Match: "alerts+db@relay.local", Route: "db", Template: "[db] {{.Subject}}"},
+		{Match: "alerts@relay.local", Route: "ops", Template: "[{{.Tag}}] {{.Text}}"},
+		{Match: "*@ci.relay.local", Route: "ci"},
+	}, layout)
+	require.NoError(t, err)
+
+	srv := &Server{
+		routes: map[string]config.RouteConfig{
+			"db":      {ChatID: 1},
+			"ops":     {ChatID: 2},
+			"ci":      {ChatID: 3},
+			"billing": {ChatID: 4},
+		},
+		layout: layout,
+		rules:  rules,
+	}
+	email := &FormattedEmail{Subject: "Disk full", Text: "95% used"}
+
+	tests := []struct {
+		name      string
+		rcpt      []string
+		wantRoute []string
+		wantText  []string
+	}{
+		{
+			name:      "exact plus address",
+			rcpt:      []string{"alerts+db@relay.local"},
+			wantRoute: []string{"db"},
+			wantText:  []string{"[db] Disk full"},
+		},
+		{
+			name:      "plus tag falls back to the base address",
+			rcpt:      []string{"Alerts+Redis@Relay.Local"},
+			wantRoute: []string{"ops"},
+			wantText:  []string{"[redis] 95% used"},
+		},
+		{
+			name:      "wildcard",
+			rcpt:      []string{"builds@ci.relay.local"},
+			wantRoute: []string{"ci"},
+			wantText:  []string{"95% used"},
+		},
+		{
+			name:      "local part names a route",
+			rcpt:      []string{"billing+stripe@relay.local"},
+			wantRoute: []string{"billing"},
+			wantText:  []string{"95% used"},
+		},
+		{
+			name:      "no match goes to super users once",
+			rcpt:      []string{"someone@relay.local", "other@relay.local"},
+			wantRoute: []string{""},
+			wantText:  []string{"95% used"},
+		},
+		{
+			name:      "several recipients",
+			rcpt:      []string{"a@ci.relay.local", "b@ci.relay.local", "alerts@relay.local"},
+			wantRoute: []string{"ci", "ops"},
+			wantText:  []string{"95% used", "[] 95% used"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			targets := srv.resolveRecipients(tt.rcpt, email)
+
+			var routes, texts []string
+			for _, target := range targets {
+				text, err := target.render()
+				require.NoError(t, err)
+				routes = append(routes, target.route)
+				texts = append(texts, text)
+			}
+			assert.Equal(t, tt.wantRoute, routes)
+			assert.Equal(t, tt.wantText, texts)
+		})
+	}
+}
+
+func TestCompileRulesInvalidTemplate(t *testing.T) {
+	_, err := compileRules([]config.EmailRuleConfig{{Match: "*@relay.local", Template: "{{.Subject"}}, nil)
+	require.Error(t, err)
+}
+
+func TestEmailDataEscapesHeaders(t *testing.T) {
+	email := &FormattedEmail{Subject: "a < b & c", From: "<ops@relay.local>", Text: "<b>body</b>", ParseMode: "HTML"}
+	data := newEmailData("alerts@relay.local", "", email)
+	assert.Equal(t, "a &lt; b &amp; c", data.Subject)
+	assert.Equal(t, "&lt;ops@relay.local&gt;", data.From)
+	assert.Equal(t, "<b>body</b>", data.Text)
+
+	email.ParseMode = "MarkdownV2"
+	assert.Equal(t, "a < b & c", newEmailData("", "", email).Subject)
+	assert.Equal(t, `<ops@relay\.local\>`, newEmailData("", "", email).From)
+
+	email.ParseMode = ""
+	assert.Equal(t, "a < b & c", newEmailData("", "", email).Subject)
+}
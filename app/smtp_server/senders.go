@@ -0,0 +1,96 @@
+package smtp_server
+
+import (
+	"context"
+	"net"
+	"path"
+	"strings"
+	"time"
+
+	"blitiri.com.ar/go/spf"
+	"github.com/emersion/go-smtp"
+	"github.com/pkarpovich/tg-relay-bot/app/config"
+)
+
+const spfTimeout = 10 * time.Second
+
+var (
+	errSenderRejected = &smtp.SMTPError{
+		Code:         550,
+		EnhancedCode: smtp.EnhancedCode{5, 7, 1},
+		Message:      "Sender address rejected",
+	}
+	errSPFFail = &smtp.SMTPError{
+		Code:         550,
+		EnhancedCode: smtp.EnhancedCode{5, 7, 23},
+		Message:      "SPF validation failed",
+	}
+	errSPFTemporary = &smtp.SMTPError{
+		Code:         451,
+		EnhancedCode: smtp.EnhancedCode{4, 7, 24},
+		Message:      "SPF validation error, try again later",
+	}
+)
+
+type senderPolicy struct {
+	allow []string
+	deny  []string
+}
+
+func newSenderPolicy(cfg config.SenderConfig) senderPolicy {
+	return senderPolicy{allow: normalizePatterns(cfg.Allow), deny: normalizePatterns(cfg.Deny)}
+}
+
+// allows checks a MAIL FROM address. Patterns with an "@" match the whole address,
+// others match its domain; both may use wildcards. The deny list takes precedence.
+func (p senderPolicy) allows(address string) bool {
+	if matchesSender(p.deny, address) {
+		return false
+	}
+	return len(p.allow) == 0 || matchesSender(p.allow, address)
+}
+
+func matchesSender(patterns []string, address string) bool {
+	address = strings.ToLower(address)
+	domain := address[strings.LastIndex(address, "@")+1:]
+	for _, pattern := range patterns {
+		target := domain
+		if strings.Contains(pattern, "@") {
+			target = address
+		}
+		if ok, _ := path.Match(pattern, target); ok {
+			return true
+		}
+	}
+	return false
+}
+
+type spfCheck func(ip net.IP, helo, sender string) (spf.Result, error)
+
+// newSPFCheck returns nil when SPF checks are disabled. resolver is a DNS server
+// address; the system resolver is used when it's empty.
+func newSPFCheck(cfg config.SPFConfig) spfCheck {
+	if !cfg.Enabled {
+		return nil
+	}
+
+	var resolver spf.DNSResolver = net.DefaultResolver
+	if addr := cfg.Resolver; addr != "" {
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			addr = net.JoinHostPort(addr, "53")
+		}
+		resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, network, addr)
+			},
+		}
+	}
+
+	return func(ip net.IP, helo, sender string) (spf.Result, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), spfTimeout)
+		defer cancel()
+		return spf.CheckHostWithSender(ip, helo, sender, spf.WithContext(ctx), spf.WithResolver(resolver))
+	}
+}
@@ -0,0 +1,106 @@
+package smtp_server
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"blitiri.com.ar/go/spf"
+	"github.com/emersion/go-sasl"
+	"github.com/emersion/go-smtp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pkarpovich/tg-relay-bot/app/config"
+)
+
+func TestSenderPolicy(t *testing.T) {
+	tests := []struct {
+		name   string
+		cfg    config.SenderConfig
+		sender string
+		want   bool
+	}{
+		{name: "no lists", sender: "anyone@example.com", want: true},
+		{name: "allowed domain", cfg: config.SenderConfig{Allow: []string{"example.com"}}, sender: "Bob@Example.com", want: true},
+		{name: "domain not allowed", cfg: config.SenderConfig{Allow: []string{"example.com"}}, sender: "bob@other.com", want: false},
+		{name: "wildcard subdomain", cfg: config.SenderConfig{Allow: []string{"*.example.com"}}, sender: "ci@build.example.com", want: true},
+		{name: "exact address", cfg: config.SenderConfig{Allow: []string{"nas@home.lan"}}, sender: "nas@home.lan", want: true},
+		{name: "other address in the domain", cfg: config.SenderConfig{Allow: []string{"nas@home.lan"}}, sender: "tv@home.lan", want: false},
+		{name: "null sender with allow list", cfg: config.SenderConfig{Allow: []string{"example.com"}}, sender: "", want: false},
+		{name: "denied address", cfg: config.SenderConfig{Deny: []string{"spam*@*"}}, sender: "spammer@example.com", want: false},
+		{name: "deny wins over allow", cfg: config.SenderConfig{Allow: []string{"example.com"}, Deny: []string{"bad@example.com"}}, sender: "bad@example.com", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, newSenderPolicy(tt.cfg).allows(tt.sender))
+		})
+	}
+}
+
+func TestSessionSenderChecks(t *testing.T) {
+	users := []config.SmtpUserConfig{{Username: "ci", Password: "secret"}}
+
+	tests := []struct {
+		name     string
+		from     string
+		auth     sasl.Client
+		result   spf.Result
+		soft     bool
+		wantCode int
+	}{
+		{name: "spf pass", from: "app@relay.local", result: spf.Pass},
+		{name: "spf fail", from: "app@relay.local", result: spf.Fail, wantCode: 550},
+		{name: "spf softfail is accepted", from: "app@relay.local", result: spf.SoftFail},
+		{name: "spf softfail rejected when configured", from: "app@relay.local", result: spf.SoftFail, soft: true, wantCode: 550},
+		{name: "spf temporary error", from: "app@relay.local", result: spf.TempError, wantCode: 451},
+		{name: "authenticated sender skips spf", from: "app@relay.local", auth: sasl.NewPlainClient("", "ci", "secret"), result: spf.Fail},
+		{name: "denied sender", from: "spam@relay.local", result: spf.Pass, wantCode: 550},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var checked []string
+			addr, dispatcher := startTestServer(t, config.SmtpConfig{
+				Auth:    config.SmtpAuthConfig{Users: users},
+				Senders: config.SenderConfig{Deny: []string{"spam@*"}},
+				SPF:     config.SPFConfig{RejectSoftFail: tt.soft},
+			}, func(s *Server) {
+				s.spfCheck = func(ip net.IP, helo, sender string) (spf.Result, error) {
+					checked = append(checked, ip.String()+" "+sender)
+					if tt.result != spf.Pass {
+						return tt.result, errors.New("spf")
+					}
+					return tt.result, nil
+				}
+			})
+
+			err := sendTestMailFrom(addr, tt.auth, tt.from, "ops@relay.local")
+			if tt.wantCode != 0 {
+				var smtpErr *smtp.SMTPError
+				require.ErrorAs(t, err, &smtpErr)
+				assert.Equal(t, tt.wantCode, smtpErr.Code)
+				assert.Empty(t, dispatcher.routes())
+				return
+			}
+			require.NoError(t, err)
+			assert.Len(t, dispatcher.routes(), 1)
+			if tt.auth == nil {
+				assert.Equal(t, []string{"127.0.0.1 " + tt.from}, checked)
+			} else {
+				assert.Empty(t, checked)
+			}
+		})
+	}
+}
+
+func TestSessionMessageSize(t *testing.T) {
+	addr, dispatcher := startTestServer(t, config.SmtpConfig{MaxMessageSize: 16})
+
+	err := sendTestMail(addr, nil, "ops@relay.local")
+	var smtpErr *smtp.SMTPError
+	require.ErrorAs(t, err, &smtpErr)
+	assert.Equal(t, 552, smtpErr.Code)
+	assert.Empty(t, dispatcher.routes())
+}
@@ -2,115 +2,232 @@ package smtp_server
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"io"
 	"log"
-
-	"github.com/flashmob/go-guerrilla"
-	"github.com/flashmob/go-guerrilla/backends"
-	"github.com/flashmob/go-guerrilla/mail"
+	"os"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+
+	tbapi "github.com/OvyFlash/telegram-bot-api"
+	"github.com/emersion/go-smtp"
 	"github.com/jhillyerd/enmime"
 	"github.com/pkarpovich/tg-relay-bot/app/config"
 	"github.com/pkarpovich/tg-relay-bot/app/events"
 )
 
+const ioTimeout = time.Minute
+
+var errQueueUnavailable = errors.New("message queue unavailable")
+
 type FormattedEmail struct {
-	Subject string
-	Text    string
+	Subject     string
+	From        string
+	To          string
+	Date        string
+	Text        string
+	ParseMode   string
+	Attachments []events.Attachment
+	Skipped     []string
+}
+
+type Dispatcher interface {
+	Dispatch(payload events.MessagePayload) (string, error)
+}
+
+// envelope is the SMTP transaction of a single message. route is set when the
+// sender authenticated with a credential bound to a route.
+type envelope struct {
+	from       string
+	recipients []string
+	route      string
 }
 
 type Server struct {
-	messagesForSend chan events.MessagePayload
-	daemon          guerrilla.Daemon
-	quit            chan struct{}
+	dispatcher   Dispatcher
+	routes       map[string]config.RouteConfig
+	parseMode    string
+	layout       *template.Template
+	rules        []recipientRule
+	filter       attachmentFilter
+	allowedHosts []string
+	users        map[string]config.SmtpUserConfig
+	authRequired bool
+	implicitTLS  bool
+	senders      senderPolicy
+	spfCheck     spfCheck
+	rejectSoft   bool
+	connections  *clientLimiter
+	messages     *clientLimiter
+	smtp         *smtp.Server
 }
 
-func NewServer(cfg *config.Config, messagesForSend chan events.MessagePayload) *Server {
-	appCfg := guerrilla.AppConfig{
-		AllowedHosts: cfg.Smtp.AllowedHosts,
+func NewServer(cfg *config.Config, dispatcher Dispatcher) (*Server, error) {
+	layoutText := cfg.Smtp.Layout
+	if layoutText == "" {
+		layoutText = defaultLayout(cfg.Smtp.ParseMode)
+	}
+	layout, err := template.New("layout").Parse(layoutText)
+	if err != nil {
+		return nil, fmt.Errorf("parse smtp layout: %w", err)
 	}
-	sc := guerrilla.ServerConfig{
-		ListenInterface: cfg.Smtp.ListenAddr,
-		IsEnabled:       true,
+
+	rules, err := compileRules(cfg.Smtp.Rules, layout)
+	if err != nil {
+		return nil, err
 	}
-	bc := backends.BackendConfig{
-		"save_process": "HeadersParser|Header|Hasher|TelegramBot",
+
+	users := make(map[string]config.SmtpUserConfig, len(cfg.Smtp.Auth.Users))
+	for _, user := range cfg.Smtp.Auth.Users {
+		users[user.Username] = user
 	}
-	appCfg.Servers = append(appCfg.Servers, sc)
-	appCfg.BackendConfig = bc
 
-	d := guerrilla.Daemon{
-		Config: &appCfg,
+	s := &Server{
+		dispatcher:   dispatcher,
+		routes:       cfg.Routes,
+		parseMode:    cfg.Smtp.ParseMode,
+		layout:       layout,
+		rules:        rules,
+		filter:       newAttachmentFilter(cfg.Smtp.Attachments),
+		allowedHosts: normalizePatterns(cfg.Smtp.AllowedHosts),
+		users:        users,
+		authRequired: cfg.Smtp.Auth.Required,
+		implicitTLS:  cfg.Smtp.TLS.Implicit,
+		senders:      newSenderPolicy(cfg.Smtp.Senders),
+		spfCheck:     newSPFCheck(cfg.Smtp.SPF),
+		rejectSoft:   cfg.Smtp.SPF.RejectSoftFail,
+		connections:  newClientLimiter(cfg.Smtp.RateLimit.Connections, time.Minute),
+		messages:     newClientLimiter(cfg.Smtp.RateLimit.Messages, time.Minute),
 	}
 
-	return &Server{
-		messagesForSend: messagesForSend,
-		daemon:          d,
-		quit:            make(chan struct{}),
+	s.smtp = smtp.NewServer(s)
+	s.smtp.Addr = cfg.Smtp.ListenAddr
+	s.smtp.Domain, _ = os.Hostname()
+	s.smtp.MaxMessageBytes = cfg.Smtp.MaxMessageSize
+	s.smtp.ReadTimeout = ioTimeout
+	s.smtp.WriteTimeout = ioTimeout
+	s.smtp.AllowInsecureAuth = cfg.Smtp.Auth.AllowInsecure
+	s.smtp.ErrorLog = log.Default()
+
+	if cfg.Smtp.TLS.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.Smtp.TLS.CertFile, cfg.Smtp.TLS.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load smtp tls certificate: %w", err)
+		}
+		s.smtp.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
 	}
+
+	return s, nil
 }
 
 func (s *Server) Start(ctx context.Context) error {
-	s.daemon.AddProcessor("TelegramBot", s.telegramBotProcessorFactory())
-
-	if err := s.daemon.Start(); err != nil {
-		return fmt.Errorf("start smtp daemon: %w", err)
-	}
+	errChan := make(chan error, 1)
+	go func() {
+		defer close(errChan)
+		log.Printf("[INFO] Starting SMTP server on %s (implicit TLS: %t, auth required: %t)", s.smtp.Addr, s.implicitTLS, s.authRequired)
+
+		serve := s.smtp.ListenAndServe
+		if s.implicitTLS {
+			serve = s.smtp.ListenAndServeTLS
+		}
+		if err := serve(); err != nil && !errors.Is(err, smtp.ErrServerClosed) {
+			errChan <- fmt.Errorf("smtp server error: %w", err)
+		}
+	}()
 
 	select {
+	case err := <-errChan:
+		return err
 	case <-ctx.Done():
 		return fmt.Errorf("smtp server context done: %w", ctx.Err())
-	case <-s.quit:
-		return nil
 	}
 }
 
 func (s *Server) Shutdown() error {
-	close(s.quit)
-	s.daemon.Shutdown()
-
-	return nil
-}
-
-func (s *Server) telegramBotProcessorFactory() func() backends.Decorator {
-	return func() backends.Decorator {
-		return func(p backends.Processor) backends.Processor {
-			return backends.ProcessWith(
-				func(e *mail.Envelope, task backends.SelectTask) (backends.Result, error) {
-					if task == backends.TaskSaveMail {
-						err := s.sendEmailToTelegram(e)
-						if err != nil {
-							return backends.NewResult(fmt.Sprintf("554 Error: %s", err)), err
-						}
-						return p.Process(e, task)
-					}
-					return p.Process(e, task)
-				},
-			)
-		}
+	if err := s.smtp.Close(); err != nil && !errors.Is(err, smtp.ErrServerClosed) {
+		return fmt.Errorf("close smtp server: %w", err)
 	}
+	return nil
 }
 
-func (s *Server) sendEmailToTelegram(e *mail.Envelope) error {
-	formattedEmail, err := processEnvelope(e)
+func (s *Server) sendEmailToTelegram(e envelope, r io.Reader) error {
+	formattedEmail, err := s.processEnvelope(e, r)
 	if err != nil {
 		return err
 	}
+	for _, skipped := range formattedEmail.Skipped {
+		log.Printf("[WARN] Skipped attachment %s", skipped)
+	}
 
 	log.Printf("[INFO] Received email with subject: %s", formattedEmail.Subject)
-	s.messagesForSend <- events.MessagePayload{Text: formattedEmail.Text}
+	for _, target := range s.resolveTargets(e, formattedEmail) {
+		text, err := target.render()
+		if err != nil {
+			return err
+		}
+		if len(formattedEmail.Skipped) > 0 {
+			skipped := events.Escape(strings.Join(formattedEmail.Skipped, "\n"), formattedEmail.ParseMode)
+			text += "\n\nSkipped attachments:\n" + skipped
+		}
+
+		payload := events.MessagePayload{
+			Text:        text,
+			ParseMode:   formattedEmail.ParseMode,
+			Route:       target.route,
+			Attachments: formattedEmail.Attachments,
+		}
+		if _, err := s.dispatcher.Dispatch(payload); err != nil {
+			return fmt.Errorf("%w: %w", errQueueUnavailable, err)
+		}
+	}
 
 	return nil
 }
 
-func processEnvelope(e *mail.Envelope) (*FormattedEmail, error) {
-	reader := e.NewReader()
-	env, err := enmime.ReadEnvelope(reader)
+func (s *Server) processEnvelope(e envelope, r io.Reader) (*FormattedEmail, error) {
+	env, err := enmime.ReadEnvelope(r)
 	if err != nil {
-		return nil, fmt.Errorf("%s\n\nError occurred during email parsing: %w", e, err)
+		return nil, fmt.Errorf("parse email from %s: %w", e.from, err)
 	}
 
+	attachments, skipped := s.filter.filter(slices.Concat(env.Attachments, env.Inlines))
+
 	return &FormattedEmail{
-		Subject: e.Subject,
-		Text:    env.Text,
+		Subject:     env.GetHeader("Subject"),
+		From:        headerOr(env, "From", e.from),
+		To:          headerOr(env, "To", strings.Join(e.recipients, ", ")),
+		Date:        formatDate(env),
+		Text:        s.formatBody(env),
+		ParseMode:   s.parseMode,
+		Attachments: attachments,
+		Skipped:     skipped,
 	}, nil
 }
+
+// formatBody renders the body for the configured parse mode. HTML parts are converted
+// to Telegram HTML; otherwise the plain-text part is escaped.
+func (s *Server) formatBody(env *enmime.Envelope) string {
+	if s.parseMode == tbapi.ModeHTML && env.HTML != "" {
+		return events.ConvertHTML(env.HTML)
+	}
+	return events.Escape(env.Text, s.parseMode)
+}
+
+func headerOr(env *enmime.Envelope, name, fallback string) string {
+	if v := env.GetHeader(name); v != "" {
+		return v
+	}
+	return fallback
+}
+
+func formatDate(env *enmime.Envelope) string {
+	date, err := env.Date()
+	if err != nil {
+		return env.GetHeader("Date")
+	}
+	return date.Format(dateLayout)
+}
@@ -0,0 +1,231 @@
+package smtp_server
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"path"
+	"strings"
+
+	"blitiri.com.ar/go/spf"
+	"github.com/emersion/go-sasl"
+	"github.com/emersion/go-smtp"
+	"github.com/pkarpovich/tg-relay-bot/app/config"
+)
+
+var (
+	errRelayDenied = &smtp.SMTPError{
+		Code:         550,
+		EnhancedCode: smtp.EnhancedCode{5, 7, 1},
+		Message:      "Relay access denied",
+	}
+	errTooManyConnections = &smtp.SMTPError{
+		Code:         421,
+		EnhancedCode: smtp.EnhancedCode{4, 7, 0},
+		Message:      "Too many connections, try again later",
+	}
+	errTooManyMessages = &smtp.SMTPError{
+		Code:         450,
+		EnhancedCode: smtp.EnhancedCode{4, 7, 1},
+		Message:      "Too many messages, try again later",
+	}
+)
+
+type session struct {
+	server *Server
+	conn   *smtp.Conn
+	ip     string
+	remote string
+	user   *config.SmtpUserConfig
+	from   string
+	rcpt   []string
+}
+
+func (s *Server) NewSession(c *smtp.Conn) (smtp.Session, error) {
+	remote := c.Conn().RemoteAddr().String()
+	ip, _, err := net.SplitHostPort(remote)
+	if err != nil {
+		ip = remote
+	}
+	if !s.connections.allow(ip) {
+		log.Printf("[WARN] Too many SMTP connections from %s", ip)
+		return nil, errTooManyConnections
+	}
+	return &session{server: s, conn: c, ip: ip, remote: remote}, nil
+}
+
+func (ss *session) AuthMechanisms() []string {
+	if len(ss.server.users) == 0 {
+		return nil
+	}
+	return []string{sasl.Plain, sasl.Login}
+}
+
+func (ss *session) Auth(mech string) (sasl.Server, error) {
+	if len(ss.server.users) == 0 {
+		return nil, smtp.ErrAuthUnsupported
+	}
+
+	switch mech {
+	case sasl.Plain:
+		return sasl.NewPlainServer(func(identity, username, password string) error {
+			if identity != "" && identity != username {
+				return smtp.ErrAuthFailed
+			}
+			return ss.login(username, password)
+		}), nil
+	case sasl.Login:
+		return &loginServer{authenticate: ss.login}, nil
+	default:
+		return nil, smtp.ErrAuthUnknownMechanism
+	}
+}
+
+func (ss *session) login(username, password string) error {
+	user, ok := ss.server.users[username]
+	// compare against the username itself for unknown users, so the timing doesn't reveal them
+	expected := user.Password
+	if !ok {
+		expected = username
+	}
+	if subtle.ConstantTimeCompare([]byte(password), []byte(expected)) != 1 || !ok {
+		log.Printf("[WARN] SMTP authentication failed for %q from %s", username, ss.remote)
+		return smtp.ErrAuthFailed
+	}
+
+	ss.user = &user
+	return nil
+}
+
+func (ss *session) Mail(from string, _ *smtp.MailOptions) error {
+	if ss.server.authRequired && ss.user == nil {
+		return smtp.ErrAuthRequired
+	}
+	if !ss.server.messages.allow(ss.ip) {
+		log.Printf("[WARN] Too many SMTP messages from %s", ss.ip)
+		return errTooManyMessages
+	}
+	if !ss.server.senders.allows(from) {
+		log.Printf("[WARN] Rejected sender %q from %s", from, ss.remote)
+		return errSenderRejected
+	}
+	if err := ss.checkSPF(from); err != nil {
+		return err
+	}
+
+	ss.from = from
+	return nil
+}
+
+// checkSPF verifies that the client may send mail for the sender's domain.
+// Authenticated clients are trusted and skip the check.
+func (ss *session) checkSPF(from string) error {
+	if ss.server.spfCheck == nil || ss.user != nil {
+		return nil
+	}
+
+	result, err := ss.server.spfCheck(net.ParseIP(ss.ip), ss.conn.Hostname(), from)
+	switch {
+	case result == spf.Fail, result == spf.SoftFail && ss.server.rejectSoft:
+		log.Printf("[WARN] SPF %s for %q from %s: %v", result, from, ss.ip, err)
+		return errSPFFail
+	case result == spf.TempError:
+		log.Printf("[WARN] SPF %s for %q from %s: %v", result, from, ss.ip, err)
+		return errSPFTemporary
+	}
+	return nil
+}
+
+func (ss *session) Rcpt(to string, _ *smtp.RcptOptions) error {
+	if !ss.server.allowsHost(to) {
+		log.Printf("[WARN] Rejected recipient %s from %s", to, ss.remote)
+		return errRelayDenied
+	}
+	ss.rcpt = append(ss.rcpt, to)
+	return nil
+}
+
+func (ss *session) Data(r io.Reader) error {
+	e := envelope{from: ss.from, recipients: ss.rcpt}
+	if ss.user != nil {
+		e.route = ss.user.Route
+	}
+
+	err := ss.server.sendEmailToTelegram(e, r)
+	if errors.Is(err, smtp.ErrDataTooLarge) {
+		log.Printf("[WARN] Rejected oversized message from %s", ss.remote)
+		return smtp.ErrDataTooLarge
+	}
+	if errors.Is(err, errQueueUnavailable) {
+		return &smtp.SMTPError{Code: 451, EnhancedCode: smtp.EnhancedCode{4, 3, 0}, Message: err.Error()}
+	}
+	if err != nil {
+		return &smtp.SMTPError{Code: 554, EnhancedCode: smtp.EnhancedCode{5, 6, 0}, Message: err.Error()}
+	}
+	return nil
+}
+
+func (ss *session) Reset() {
+	ss.from = ""
+	ss.rcpt = nil
+}
+
+func (ss *session) Logout() error {
+	return nil
+}
+
+// allowsHost checks the domain of a recipient against SMTP_ALLOWED_HOSTS. A single
+// "." allows any domain, and entries may use wildcards such as "*.example.com".
+func (s *Server) allowsHost(address string) bool {
+	host := strings.ToLower(address[strings.LastIndex(address, "@")+1:])
+	for _, allowed := range s.allowedHosts {
+		if allowed == "." {
+			return true
+		}
+		if ok, _ := path.Match(allowed, host); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func normalizePatterns(hosts []string) []string {
+	normalized := make([]string, 0, len(hosts))
+	for _, h := range hosts {
+		if h = strings.ToLower(strings.TrimSpace(h)); h != "" {
+			normalized = append(normalized, h)
+		}
+	}
+	return normalized
+}
+
+// loginServer implements the server side of the LOGIN mechanism, which go-sasl
+// only provides as a client. The username may arrive as the initial response.
+type loginServer struct {
+	authenticate func(username, password string) error
+	username     []byte
+	step         int
+}
+
+func (l *loginServer) Next(response []byte) ([]byte, bool, error) {
+	switch l.step {
+	case 0:
+		if response == nil {
+			l.step = 1
+			return []byte("Username:"), false, nil
+		}
+		fallthrough
+	case 1:
+		l.step = 2
+		l.username = bytes.Clone(response)
+		return []byte("Password:"), false, nil
+	case 2:
+		l.step++
+		return nil, true, l.authenticate(string(l.username), string(response))
+	default:
+		return nil, true, sasl.ErrUnexpectedClientResponse
+	}
+}
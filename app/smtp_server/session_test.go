@@ -0,0 +1,184 @@
+package smtp_server
+
+import (
+	"net"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/emersion/go-sasl"
+	"github.com/emersion/go-smtp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pkarpovich/tg-relay-bot/app/config"
+	"github.com/pkarpovich/tg-relay-bot/app/events"
+)
+
+type mockDispatcher struct {
+	mu       sync.Mutex
+	payloads []events.MessagePayload
+}
+
+func (m *mockDispatcher) Dispatch(payload events.MessagePayload) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.payloads = append(m.payloads, payload)
+	return "id", nil
+}
+
+func (m *mockDispatcher) routes() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var routes []string
+	for _, p := range m.payloads {
+		routes = append(routes, p.Route)
+	}
+	return routes
+}
+
+func startTestServer(t *testing.T, cfg config.SmtpConfig, configure ...func(*Server)) (string, *mockDispatcher) {
+	t.Helper()
+	cfg.AllowedHosts = []string{"relay.local", "*.relay.local"}
+	cfg.Auth.AllowInsecure = true
+	dispatcher := &mockDispatcher{}
+	srv, err := NewServer(&config.Config{
+		Smtp:   cfg,
+		Routes: map[string]config.RouteConfig{"ci": {ChatID: 1}, "ops": {ChatID: 2}},
+	}, dispatcher)
+	require.NoError(t, err)
+	for _, fn := range configure {
+		fn(srv)
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() { _ = srv.smtp.Serve(l) }()
+	t.Cleanup(func() { _ = srv.Shutdown() })
+
+	return l.Addr().String(), dispatcher
+}
+
+func sendTestMail(addr string, auth sasl.Client, rcpt string) error {
+	return sendTestMailFrom(addr, auth, "app@relay.local", rcpt)
+}
+
+func sendTestMailFrom(addr string, auth sasl.Client, from, rcpt string) error {
+	c, err := smtp.Dial(addr)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if auth != nil {
+		if err = c.Auth(auth); err != nil {
+			return err
+		}
+	}
+	return c.SendMail(from, []string{rcpt}, strings.NewReader("Subject: hi\r\n\r\nbody\r\n"))
+}
+
+func TestSessionAuth(t *testing.T) {
+	users := []config.SmtpUserConfig{
+		{Username: "ci", Password: "secret", Route: "ci"},
+		{Username: "app", Password: "hunter2"},
+	}
+
+	tests := []struct {
+		name      string
+		required  bool
+		auth      sasl.Client
+		rcpt      string
+		wantCode  int
+		wantRoute []string
+	}{
+		{
+			name:      "plain with routed credential",
+			required:  true,
+			auth:      sasl.NewPlainClient("", "ci", "secret"),
+			rcpt:      "ops@relay.local",
+			wantRoute: []string{"ci"},
+		},
+		{
+			name:      "login without route uses recipients",
+			required:  true,
+			auth:      sasl.NewLoginClient("app", "hunter2"),
+			rcpt:      "ops@relay.local",
+			wantRoute: []string{"ops"},
+		},
+		{
+			name:     "wrong password",
+			required: true,
+			auth:     sasl.NewPlainClient("", "ci", "wrong"),
+			rcpt:     "ops@relay.local",
+			wantCode: 535,
+		},
+		{
+			name:     "unknown user",
+			required: true,
+			auth:     sasl.NewLoginClient("nobody", "secret"),
+			rcpt:     "ops@relay.local",
+			wantCode: 535,
+		},
+		{
+			name:     "unauthenticated sender is rejected",
+			required: true,
+			rcpt:     "ops@relay.local",
+			wantCode: 502,
+		},
+		{
+			name:      "unauthenticated sender allowed when auth is optional",
+			rcpt:      "ops@relay.local",
+			wantRoute: []string{"ops"},
+		},
+		{
+			name:     "recipient domain is not allowed",
+			auth:     sasl.NewPlainClient("", "ci", "secret"),
+			rcpt:     "ops@example.com",
+			wantCode: 550,
+		},
+		{
+			name:      "wildcard recipient domain",
+			rcpt:      "ops@mail.relay.local",
+			wantRoute: []string{"ops"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr, dispatcher := startTestServer(t, config.SmtpConfig{Auth: config.SmtpAuthConfig{Required: tt.required, Users: users}})
+
+			err := sendTestMail(addr, tt.auth, tt.rcpt)
+			if tt.wantCode != 0 {
+				var smtpErr *smtp.SMTPError
+				require.ErrorAs(t, err, &smtpErr)
+				assert.Equal(t, tt.wantCode, smtpErr.Code)
+				assert.Empty(t, dispatcher.routes())
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantRoute, dispatcher.routes())
+		})
+	}
+}
+
+func TestLoginServerInitialResponse(t *testing.T) {
+	var got []string
+	l := &loginServer{authenticate: func(username, password string) error {
+		got = []string{username, password}
+		return nil
+	}}
+
+	challenge, done, err := l.Next([]byte("ci"))
+	require.NoError(t, err)
+	assert.False(t, done)
+	assert.Equal(t, "Password:", string(challenge))
+
+	_, done, err = l.Next([]byte("secret"))
+	require.NoError(t, err)
+	assert.True(t, done)
+	assert.Equal(t, []string{"ci", "secret"}, got)
+
+	_, _, err = l.Next([]byte("again"))
+	require.ErrorIs(t, err, sasl.ErrUnexpectedClientResponse)
+}
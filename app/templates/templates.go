@@ -0,0 +1,67 @@
+// Package templates holds the helpers available to webhook templates.
+package templates
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"text/template"
+
+	"github.com/pkarpovich/tg-relay-bot/app/events"
+)
+
+// Funcs are the helpers available to webhook templates.
+var Funcs = template.FuncMap{
+	"json": func(v any) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+	"escapeHTML":     func(v any) string { return events.EscapeHTML(toString(v)) },
+	"escapeMarkdown": func(v any) string { return events.EscapeMarkdownV2(toString(v)) },
+	"truncate":       truncate,
+	"default":        defaultValue,
+}
+
+// Parse parses a webhook template with Funcs.
+func Parse(name, text string) (*template.Template, error) {
+	tmpl, err := template.New(name).Funcs(Funcs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("parse template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// truncate shortens a value to at most n characters, ending with an ellipsis when cut.
+func truncate(n int, v any) string {
+	runes := []rune(toString(v))
+	if n <= 0 || len(runes) <= n {
+		return string(runes)
+	}
+	return string(runes[:n-1]) + "…"
+}
+
+// defaultValue returns fallback when v is missing, empty or zero.
+func defaultValue(fallback, v any) any {
+	if v == nil {
+		return fallback
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map:
+		if rv.Len() == 0 {
+			return fallback
+		}
+	default:
+		if rv.IsZero() {
+			return fallback
+		}
+	}
+	return v
+}
+
+func toString(v any) string {
+	if v == nil {
+		return ""
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,15 @@
+package templates
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseInvalid(t *testing.T) {
+	_, err := Parse("broken", `{{.a`)
+	assert.Error(t, err)
+
+	_, err = Parse("unknown-function", `{{nope .a}}`)
+	assert.ErrorContains(t, err, `function "nope" not defined`)
+}